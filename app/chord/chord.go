@@ -1,6 +1,7 @@
 package chord
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -21,22 +22,28 @@ import (
 	"x.io/xrpc/protocol/chordpb"
 )
 
+// checkNodeTimeout 从连接池获取节点连接的最长等待时间
+const checkNodeTimeout = 3 * time.Second
+
 func NewChord(host string, port int, h chordpb.Hasher, store chordpb.KVStore) *chordImpl {
 	addr := fmt.Sprintf("%s:%d", host, port)
 	var id chordpb.NodeID = h.Hash([]byte(addr))
 	c := &chordImpl{
-		host:          host,
-		port:          port,
-		id:            id,
-		self:          &chordpb.Node{Id: id, Host: host, Port: port},
-		remoteNodes:   map[chordpb.NodeID]chordpb.ChordClient{},
-		activeRecords: map[chordpb.NodeID]time.Time{},
-		conns:         map[chordpb.NodeID]*xrpc.ClientConn{},
-		amu:           &sync.Mutex{},
+		host: host,
+		port: port,
+		id:   id,
+		self: &chordpb.Node{Id: id, Host: host, Port: port},
+		amu:  &sync.Mutex{},
 
 		h:     h,
 		store: store,
 	}
+	c.pool = xrpc.NewPool("tcp", xrpc.PoolOptions{
+		MaxIdle:     8,
+		IdleTimeout: 3 * time.Minute,
+		HealthCheck: c.heartBeat,
+		DialOptions: []xrpc.DialOption{xrpc.WithInsecure(), xrpc.WithJsonCodec()},
+	})
 	size := h.Size()
 	c.fingerTable = make([]*Finger, h.Size(), h.Size())
 	for i := 0; i < size; i++ {
@@ -95,9 +102,8 @@ type chordImpl struct {
 	id   chordpb.NodeID
 	self *chordpb.Node
 
-	remoteNodes   map[chordpb.NodeID]chordpb.ChordClient
-	activeRecords map[chordpb.NodeID]time.Time
-	conns         map[chordpb.NodeID]*xrpc.ClientConn
+	// pool 与其他节点的连接池，连接空闲3分钟后关闭
+	pool *xrpc.Pool
 
 	amu *sync.Mutex
 
@@ -133,12 +139,13 @@ func (c *chordImpl) Join(ctx *xrpc.XContext, req *chordpb.Message) (reply *chord
 		return
 	}
 
-	next, err := c.checkNode(finger)
+	next, release, err := c.checkNode(ctx, finger)
 	if err != nil {
 		reply.Purpose = chordpb.StatusError
 		reply.Errors = append(reply.Errors, c.wrapErr("can't find remote node by id: "+finger.Id.String()))
 		return
 	}
+	defer release()
 	reply = next.Join(ctx, req)
 	return
 }
@@ -173,12 +180,13 @@ func (c *chordImpl) Leave(ctx *xrpc.XContext, req *chordpb.Message) (reply *chor
 		}
 		return reply
 	}
-	next, err := c.checkNode(finger)
+	next, release, err := c.checkNode(ctx, finger)
 	if err != nil {
 		reply.Purpose = chordpb.StatusError
 		reply.Errors = append(reply.Errors, c.wrapErr("can't find remote node by id: "+finger.Id.String()))
 		return reply
 	}
+	defer release()
 	reply = next.Leave(ctx, req)
 	return
 }
@@ -213,12 +221,13 @@ func (c *chordImpl) Lookup(ctx *xrpc.XContext, req *chordpb.Message) (reply *cho
 		}
 		return reply
 	}
-	next, err := c.checkNode(finger)
+	next, release, err := c.checkNode(ctx, finger)
 	if err != nil {
 		reply.Purpose = chordpb.StatusError
 		reply.Errors = append(reply.Errors, c.wrapErr("can't find remote node by id: "+finger.Id.String()))
 		return reply
 	}
+	defer release()
 	reply = next.Lookup(ctx, req)
 	return
 }
@@ -251,12 +260,13 @@ func (c *chordImpl) FindSuccessor(ctx *xrpc.XContext, req *chordpb.Message) (rep
 		}
 		return
 	}
-	next, err := c.checkNode(finger)
+	next, release, err := c.checkNode(ctx, finger)
 	if err != nil {
 		reply.Purpose = chordpb.StatusError
 		reply.Errors = append(reply.Errors, c.wrapErr("can't find remote node by id: "+finger.Id.String()))
 		return reply
 	}
+	defer release()
 	reply = next.FindSuccessor(ctx, req)
 	return
 }
@@ -281,12 +291,13 @@ func (c *chordImpl) Notify(ctx *xrpc.XContext, req *chordpb.Message) (reply *cho
 		}
 		return
 	}
-	next, err := c.checkNode(finger)
+	next, release, err := c.checkNode(ctx, finger)
 	if err != nil {
 		reply.Purpose = chordpb.StatusError
 		reply.Errors = append(reply.Errors, c.wrapErr("can't find remote node by id: "+finger.Id.String()))
 		return
 	}
+	defer release()
 	reply = next.Notify(ctx, req)
 	return
 }
@@ -306,12 +317,13 @@ func (c *chordImpl) HeartBeat(ctx *xrpc.XContext, req *chordpb.Message) (reply *
 	if finger.Id == c.id {
 		return reply
 	}
-	next, err := c.checkNode(finger)
+	next, release, err := c.checkNode(ctx, finger)
 	if err != nil {
 		reply.Purpose = chordpb.StatusError
 		reply.Errors = append(reply.Errors, c.wrapErr("can't find remote node by id: "+finger.Id.String()))
 		return reply
 	}
+	defer release()
 	reply = next.HeartBeat(ctx, req)
 	return
 }
@@ -338,12 +350,13 @@ func (c *chordImpl) Set(ctx *xrpc.XContext, req *chordpb.Message) (reply *chordp
 		}
 		return reply
 	}
-	next, err := c.checkNode(finger)
+	next, release, err := c.checkNode(ctx, finger)
 	if err != nil {
 		reply.Purpose = chordpb.StatusError
 		reply.Errors = append(reply.Errors, c.wrapErr("can't find remote node by id: "+finger.Id.String()))
 		return reply
 	}
+	defer release()
 	reply = next.Set(ctx, req)
 	return
 }
@@ -372,12 +385,13 @@ func (c *chordImpl) Get(ctx *xrpc.XContext, req *chordpb.Message) (reply *chordp
 
 		return reply
 	}
-	next, err := c.checkNode(finger)
+	next, release, err := c.checkNode(ctx, finger)
 	if err != nil {
 		reply.Purpose = chordpb.StatusError
 		reply.Errors = append(reply.Errors, c.wrapErr("can't find remote node by id: "+finger.Id.String()))
 		return reply
 	}
+	defer release()
 	reply = next.Get(ctx, req)
 	return
 }
@@ -404,12 +418,13 @@ func (c *chordImpl) Del(ctx *xrpc.XContext, req *chordpb.Message) (reply *chordp
 		}
 		return reply
 	}
-	next, err := c.checkNode(finger)
+	next, release, err := c.checkNode(ctx, finger)
 	if err != nil {
 		reply.Purpose = chordpb.StatusError
 		reply.Errors = append(reply.Errors, c.wrapErr("can't find remote node by id: "+finger.Id.String()))
 		return reply
 	}
+	defer release()
 	reply = next.Del(ctx, req)
 	return
 }
@@ -422,11 +437,12 @@ func (c *chordImpl) JoinNode(addr string) error {
 		Host: host,
 		Port: port,
 	}
-	next, err := c.checkNode(node)
+	ctx := c.newXCtx()
+	next, release, err := c.checkNode(ctx, node)
 	if err != nil {
 		return err
 	}
-	ctx := c.newXCtx()
+	defer release()
 	reply := next.Join(ctx, c.NewMessage(chordpb.NodeJoin, c.id, nil, nil))
 	if reply == nil {
 		return errors.New("join node failed")
@@ -458,10 +474,11 @@ func (c *chordImpl) wrapErr(err string) string {
 }
 
 func (c *chordImpl) sendMessage(ctx *xrpc.XContext, finger *chordpb.Node, req *chordpb.Message) (reply *chordpb.Message, err error) {
-	next, err := c.checkNode(finger)
+	next, release, err := c.checkNode(ctx, finger)
 	if err != nil {
 		return
 	}
+	defer release()
 
 	switch req.Purpose {
 	case chordpb.NodeJoin:
@@ -492,11 +509,12 @@ func (c *chordImpl) sendMessage(ctx *xrpc.XContext, finger *chordpb.Node, req *c
 
 func (c *chordImpl) notify() error {
 	println("set successor to: ", c.successor.String())
-	next, err := c.checkNode(c.successor)
+	ctx := c.newXCtx()
+	next, release, err := c.checkNode(ctx, c.successor)
 	if err != nil {
 		return err
 	}
-	ctx := c.newXCtx()
+	defer release()
 	notify := c.NewMessage(chordpb.NodeNotify, c.successor.Id, nil, nil)
 	notify.Target = *(c.successor)
 	next.Notify(ctx, notify)
@@ -568,29 +586,25 @@ func setupClient(cc *xrpc.ClientConn) {
 	cc.SetHeaderArg(cryptop.Key, sessionID)
 }
 
-func (c *chordImpl) checkNode(node *chordpb.Node) (cc chordpb.ChordClient, err error) {
-	var ok bool
-	cc, ok = c.remoteNodes[node.Id]
-	ctx := c.newXCtx()
-	if ok {
-		reply := cc.HeartBeat(ctx, c.NewMessage(chordpb.HeartBeat, c.id, nil, nil))
-		if reply != nil && reply.Purpose == chordpb.StatusOk {
-			return
-		}
-	}
-	conn, err := xrpc.Dial("tcp", fmt.Sprintf("%s:%d", node.Host, node.Port), xrpc.WithInsecure(), xrpc.WithJsonCodec())
+// checkNode 从连接池取出到node的连接，release将连接放回连接池。
+// 等待空闲连接或拨号最多checkNodeTimeout，ctx取消时提前返回
+func (c *chordImpl) checkNode(ctx context.Context, node *chordpb.Node) (cc chordpb.ChordClient, release func(), err error) {
+	ctx, cancel := context.WithTimeout(ctx, checkNodeTimeout)
+	defer cancel()
+	conn, err := c.pool.Get(ctx, fmt.Sprintf("%s:%d", node.Host, node.Port))
 	if err != nil {
 		return
 	}
-	c.amu.Lock()
-	defer c.amu.Unlock()
+	return chordpb.NewChordClient(conn), func() { c.pool.Put(conn) }, nil
+}
 
-	//setupClient(conn)
-	cc = chordpb.NewChordClient(conn)
-	c.remoteNodes[node.Id] = cc
-	c.activeRecords[node.Id] = time.Now()
-	c.conns[node.Id] = conn
-	return
+// heartBeat 检查池中的空闲连接是否可用
+func (c *chordImpl) heartBeat(conn *xrpc.ClientConn) error {
+	reply := chordpb.NewChordClient(conn).HeartBeat(c.newXCtx(), c.NewMessage(chordpb.HeartBeat, c.id, nil, nil))
+	if reply == nil || reply.Purpose != chordpb.StatusOk {
+		return errors.New("heart beat failed")
+	}
+	return nil
 }
 
 func (c *chordImpl) fixFingerTable() {
@@ -617,11 +631,12 @@ func (c *chordImpl) updateSuccessor() {
 		return
 	}
 
-	next, err := c.checkNode(c.successor)
+	next, release, err := c.checkNode(ctx, c.successor)
 	if err != nil {
 		c.successor = nil
 		return
 	}
+	defer release()
 	reply := next.Lookup(ctx, c.NewMessage(chordpb.PredReq, c.successor.Id, nil, nil))
 	if reply.Body == nil {
 		return
@@ -637,34 +652,14 @@ func (c *chordImpl) updateSuccessor() {
 	}
 }
 
-func (c *chordImpl) checkConns(exp time.Time) {
-	timeout := time.Minute * 3
-	c.amu.Lock()
-	defer c.amu.Unlock()
-	for id, at := range c.activeRecords {
-		if exp.Sub(at) > timeout {
-			c.conns[id].Close()
-			delete(c.conns, id)
-			delete(c.remoteNodes, id)
-		}
-		host, port := parseAddr(c.conns[id].Addr())
-		c.checkNode(&chordpb.Node{
-			Id:   id,
-			Host: host,
-			Port: port,
-		})
-	}
-}
-
 func (c *chordImpl) stabilize() {
 	ticker := time.NewTicker(time.Second * 2)
 	n := 0
 	for {
 		select {
-		case exp := <-ticker.C:
+		case <-ticker.C:
 			n++
-			//log.Debugf("start stabilize[%d] at: %s", n, exp.String())
-			c.checkConns(exp)
+			//log.Debugf("start stabilize[%d] at: %s", n, time.Now().String())
 			c.updateSuccessor()
 			c.fixFingerTable()
 			//log.Debugf("finish stabilize[%d] at: %s", n, time.Now().String())
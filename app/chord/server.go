@@ -48,7 +48,7 @@ func newServer(protocol, addr string) (lis net.Listener, svr *xrpc.Server) {
 	s := xrpc.NewServer()
 	_, port := parseAddr(addr)
 	if enablePlugin {
-		promPlugin := prom.New(port + 2)
+		promPlugin := prom.New(nil, port+2)
 		//logPlugin := logp.New()
 		//promPlugin.Collect(logPlugin.Logger().EnableCounter())
 		whitelistPlugin := whitelist.New(map[string]bool{"127.0.0.1": true}, nil)
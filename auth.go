@@ -1,9 +1,29 @@
 package xrpc
 
-import "errors"
+import (
+	"context"
 
+	"x.io/xrpc/pkg/auth"
+	"x.io/xrpc/pkg/codes"
+	"x.io/xrpc/pkg/peer"
+	"x.io/xrpc/pkg/status"
+	"x.io/xrpc/types"
+)
+
+// Authenticator authenticates the streams opened on the server, ctx carries
+// the peer of the session, see peer.FromContext. It returns the identity of
+// the caller, which is put into the context of the handler, see
+// auth.FromContext. The stream fails with Unauthenticated, or the code of
+// the status returned, if Authenticate returns an error.
 type Authenticator interface {
-	Authenticate(args map[string]interface{}) error
+	Authenticate(ctx context.Context, req *auth.Request) (*auth.Identity, error)
+}
+
+// Authorizer authorizes the identity returned by the Authenticator to call
+// fullMethod. The stream fails with PermissionDenied, or the code of the
+// status returned, if Authorize returns an error.
+type Authorizer interface {
+	Authorize(ctx context.Context, id *auth.Identity, fullMethod string) error
 }
 
 func NewEmptyAuthenticator() Authenticator {
@@ -12,8 +32,8 @@ func NewEmptyAuthenticator() Authenticator {
 
 type emptyAuthenticator struct{}
 
-func (a *emptyAuthenticator) Authenticate(args map[string]interface{}) (err error) {
-	return nil
+func (a *emptyAuthenticator) Authenticate(ctx context.Context, req *auth.Request) (*auth.Identity, error) {
+	return nil, nil
 }
 
 func NewAdminAuthenticator(user, pass string) Authenticator {
@@ -23,26 +43,58 @@ func NewAdminAuthenticator(user, pass string) Authenticator {
 	}
 }
 
+// AdminAuthenticator authenticates the user and pass metadata, which the
+// client sets by SetHeaderArg.
 type AdminAuthenticator struct {
 	user string
 	pass string
 }
 
-func (a *AdminAuthenticator) Authenticate(args map[string]interface{}) (err error) {
-	var user, pass string
-	var ok bool
-	if user, ok = args["user"].(string); !ok {
-		err = errors.New("admin_auth: get user failed")
-		return
+func (a *AdminAuthenticator) Authenticate(ctx context.Context, req *auth.Request) (*auth.Identity, error) {
+	user := req.MD.Get("user")
+	if len(user) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "admin_auth: get user failed")
+	}
+	pass := req.MD.Get("pass")
+	if len(pass) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "admin_auth: get pass failed")
+	}
+	if a.user != user[0] || a.pass != pass[0] {
+		return nil, status.Error(codes.Unauthenticated, "admin_auth: user or pass is incorrect")
+	}
+	return &auth.Identity{Subject: a.user}, nil
+}
+
+// errIdentityExpired fails the calls on a stream after the identity which
+// opened it has expired.
+var errIdentityExpired = status.Error(codes.Unauthenticated, "xrpc: the identity of the caller has expired")
+
+// authenticate authenticates and authorizes the stream opened by header on
+// the session of the peer p, the error returned is a status.
+func (s *Server) authenticate(p *peer.Peer, header *types.StreamHeader) (*auth.Identity, error) {
+	ctx := peer.NewContext(s.ctx, p)
+	req := &auth.Request{Peer: p, FullMethod: header.FullMethod, MD: types.MD{}}
+	for k, v := range header.Args {
+		if vv, ok := v.(string); ok {
+			req.MD.Append(k, vv)
+		}
 	}
-	if pass, ok = args["pass"].(string); !ok {
-		err = errors.New("admin_auth: get pass failed")
-		return
+	id, err := s.auth.Authenticate(ctx, req)
+	if err != nil {
+		return nil, toStatusError(err, codes.Unauthenticated)
 	}
-	ok = a.user == user && a.pass == pass
-	if !ok {
-		err = errors.New("admin_auth: user or pass is incorrect")
-		return
+	if s.authz != nil {
+		if err = s.authz.Authorize(ctx, id, header.FullMethod); err != nil {
+			return nil, toStatusError(err, codes.PermissionDenied)
+		}
+	}
+	return id, nil
+}
+
+// toStatusError returns err if it is a status, or a status of code c.
+func toStatusError(err error, c codes.Code) error {
+	if _, ok := status.FromError(err); ok {
+		return err
 	}
-	return err
+	return status.Error(c, err.Error())
 }
@@ -0,0 +1,139 @@
+package xrpc_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"x.io/xrpc"
+	"x.io/xrpc/pkg/auth"
+	"x.io/xrpc/pkg/codes"
+	"x.io/xrpc/pkg/net"
+	"x.io/xrpc/pkg/status"
+
+	"github.com/stretchr/testify/assert"
+	greeter_pb "x.io/xrpc/protocol/greeter"
+)
+
+const tokenAuthAddr = "localhost:9919"
+
+// identityGreeter replies with the subject of the caller.
+type identityGreeter struct {
+	greeter_pb.UnimplementedGreeterServer
+}
+
+func (g *identityGreeter) SayHello(ctx context.Context, req *greeter_pb.HelloRequest) (*greeter_pb.HelloReply, error) {
+	id, ok := auth.FromContext(ctx)
+	if !ok {
+		return &greeter_pb.HelloReply{Message: "anonymous"}, nil
+	}
+	return &greeter_pb.HelloReply{Message: id.Subject}, nil
+}
+
+func (g *identityGreeter) SayHi(ctx context.Context, req *greeter_pb.HelloRequest) (*greeter_pb.HelloReply, error) {
+	return g.SayHello(ctx, req)
+}
+
+// swapToken is the bearer token which may be replaced between the calls.
+type swapToken struct {
+	mu    sync.Mutex
+	token string
+}
+
+func (s *swapToken) set(h *auth.HMAC, subject string) {
+	token, _ := h.Sign(&auth.Claims{Subject: subject, ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	s.mu.Lock()
+	s.token = token
+	s.mu.Unlock()
+}
+
+func (s *swapToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return auth.NewBearerToken(s.token, false).GetRequestMetadata(ctx, uri...)
+}
+
+func (s *swapToken) RequireTransportSecurity() bool {
+	return false
+}
+
+func TestTokenAuth(t *testing.T) {
+	h := auth.NewHMAC([]byte("secret"))
+	lis, err := net.Listen(context.Background(), net.TCP, tokenAuthAddr)
+	assert.Equal(t, nil, err)
+	s := xrpc.NewServer()
+	s.SetAuthenticator(h)
+	s.SetAuthorizer(auth.NewPolicy(map[string][]string{
+		"admin": {"*"},
+		"guest": {"/greeter.Greeter/SayHello"},
+	}))
+	greeter_pb.RegisterGreeterServer(s, &identityGreeter{})
+	go s.Serve(lis)
+	defer s.Stop()
+
+	dial := func(subject string, ttl time.Duration, opts ...xrpc.DialOption) greeter_pb.GreeterClient {
+		token, err := h.Sign(&auth.Claims{Subject: subject, ExpiresAt: time.Now().Add(ttl).Unix()})
+		assert.Equal(t, nil, err)
+		opts = append(opts, xrpc.WithInsecure(), xrpc.WithPerRPCCredentials(auth.NewBearerToken(token, false)))
+		conn, err := xrpc.Dial(net.TCP, tokenAuthAddr, opts...)
+		assert.Equal(t, nil, err)
+		t.Cleanup(func() { conn.Close() })
+		return greeter_pb.NewGreeterClient(conn)
+	}
+	req := &greeter_pb.HelloRequest{Name: "auth"}
+
+	admin := dial("admin", time.Hour)
+	r, err := admin.SayHi(ctx, req)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "admin", r.GetMessage())
+
+	// the policy allows the guest to call SayHello only
+	guest := dial("guest", time.Hour)
+	r, err = guest.SayHello(ctx, req)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "guest", r.GetMessage())
+	_, err = guest.SayHi(ctx, req)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = dial("nobody", time.Hour).SayHello(ctx, req)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// the client without a valid token is rejected
+	conn, err := xrpc.Dial(net.TCP, tokenAuthAddr, xrpc.WithInsecure())
+	assert.Equal(t, nil, err)
+	defer conn.Close()
+	_, err = greeter_pb.NewGreeterClient(conn).SayHello(ctx, req)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	forged, _ := auth.NewHMAC([]byte("guess")).Sign(&auth.Claims{Subject: "admin"})
+	conn.Close()
+	conn, err = xrpc.Dial(net.TCP, tokenAuthAddr, xrpc.WithInsecure(), xrpc.WithPerRPCCredentials(auth.NewBearerToken(forged, false)))
+	assert.Equal(t, nil, err)
+	_, err = greeter_pb.NewGreeterClient(conn).SayHello(ctx, req)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// every call is authenticated with the token of its own
+	token := &swapToken{}
+	token.set(h, "admin")
+	swapConn, err := xrpc.Dial(net.TCP, tokenAuthAddr, xrpc.WithInsecure(), xrpc.WithPerRPCCredentials(token))
+	assert.Equal(t, nil, err)
+	defer swapConn.Close()
+	swapped := greeter_pb.NewGreeterClient(swapConn)
+	_, err = swapped.SayHi(ctx, req)
+	assert.Equal(t, nil, err)
+	token.set(h, "guest")
+	_, err = swapped.SayHi(ctx, req)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// the calls with an expired token are rejected
+	short := dial("guest", 1500*time.Millisecond)
+	_, err = short.SayHello(ctx, req)
+	assert.Equal(t, nil, err)
+	time.Sleep(2 * time.Second)
+	_, err = short.SayHello(ctx, req)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// the bearer tokens which require the transport security are not sent
+	// over an insecure connection
+	_, err = xrpc.Dial(net.TCP, tokenAuthAddr, xrpc.WithPerRPCCredentials(auth.NewBearerToken("token", true)))
+	assert.NotEqual(t, nil, err)
+}
@@ -0,0 +1,98 @@
+package xrpc_test
+
+import (
+	"context"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"x.io/xrpc"
+	"x.io/xrpc/pkg/balancer"
+	"x.io/xrpc/pkg/net"
+	"x.io/xrpc/pkg/resolver"
+
+	"github.com/stretchr/testify/assert"
+	greeter_pb "x.io/xrpc/protocol/greeter"
+)
+
+var backendAddrs = []string{"localhost:9902", "localhost:9903"}
+
+// addrGreeter replies with the address of its server.
+type addrGreeter struct {
+	greeter_pb.UnimplementedGreeterServer
+	addr string
+}
+
+func (g *addrGreeter) SayHello(ctx context.Context, req *greeter_pb.HelloRequest) (*greeter_pb.HelloReply, error) {
+	return &greeter_pb.HelloReply{Message: g.addr}, nil
+}
+
+// weightedResolverBuilder resolves weighted:/// to the backends, the weight
+// of the first one is 3.
+type weightedResolverBuilder struct{}
+
+func (weightedResolverBuilder) Build(target resolver.Target, cc resolver.ClientConn) (resolver.Resolver, error) {
+	cc.UpdateState(resolver.State{Addresses: []resolver.Address{
+		{Addr: backendAddrs[0], Attributes: map[string]interface{}{balancer.WeightKey: 3}},
+		{Addr: backendAddrs[1]},
+	}})
+	return weightedResolver{}, nil
+}
+
+func (weightedResolverBuilder) Scheme() string { return "weighted" }
+
+type weightedResolver struct{}
+
+func (weightedResolver) ResolveNow() {}
+func (weightedResolver) Close()      {}
+
+var backendOnce sync.Once
+
+func newBackendClient(t *testing.T, target string, typ balancer.Type) greeter_pb.GreeterClient {
+	backendOnce.Do(func() {
+		resolver.Register(weightedResolverBuilder{})
+		for _, addr := range backendAddrs {
+			lis, err := net.Listen(context.Background(), "tcp", addr)
+			if err != nil {
+				log.Fatal(err)
+			}
+			s := xrpc.NewServer()
+			greeter_pb.RegisterGreeterServer(s, &addrGreeter{addr: addr})
+			go s.Serve(lis)
+		}
+	})
+	conn, err := xrpc.Dial("tcp", target, xrpc.WithInsecure(), xrpc.WithBalancer(typ))
+	assert.Equal(t, nil, err)
+	// Dial returns when the first backend is ready, let the other one follow
+	time.Sleep(50 * time.Millisecond)
+	return greeter_pb.NewGreeterClient(conn)
+}
+
+// sayHellos makes n calls and counts the calls served by each backend.
+func sayHellos(t *testing.T, client greeter_pb.GreeterClient, n int) map[string]int {
+	picks := map[string]int{}
+	for i := 0; i < n; i++ {
+		r, err := client.SayHello(ctx, &greeter_pb.HelloRequest{Name: name})
+		assert.Equal(t, nil, err)
+		picks[r.Message]++
+	}
+	return picks
+}
+
+func TestBalancerPickFirst(t *testing.T) {
+	client := newBackendClient(t, "static:///"+backendAddrs[0]+","+backendAddrs[1], balancer.PickFirst)
+	assert.Equal(t, map[string]int{backendAddrs[0]: 10}, sayHellos(t, client, 10))
+}
+
+func TestBalancerRound(t *testing.T) {
+	client := newBackendClient(t, "static:///"+backendAddrs[0]+","+backendAddrs[1], balancer.Round)
+	picks := sayHellos(t, client, 10)
+	assert.Equal(t, map[string]int{backendAddrs[0]: 5, backendAddrs[1]: 5}, picks)
+}
+
+func TestBalancerWeightedRound(t *testing.T) {
+	client := newBackendClient(t, "weighted:///", balancer.WeightedRound)
+	picks := sayHellos(t, client, 40)
+	assert.Equal(t, map[string]int{backendAddrs[0]: 30, backendAddrs[1]: 10}, picks)
+}
@@ -2,13 +2,19 @@ package xrpc
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
+	"x.io/xrpc/pkg/balancer"
+	"x.io/xrpc/pkg/codes"
+	"x.io/xrpc/pkg/connectivity"
 	"x.io/xrpc/pkg/encoding"
 	"x.io/xrpc/pkg/net"
+	"x.io/xrpc/pkg/resolver"
+	"x.io/xrpc/pkg/status"
 	"x.io/xrpc/plugin"
 	_ "x.io/xrpc/plugin/chord"
 	"x.io/xrpc/types"
@@ -16,53 +22,128 @@ import (
 	"github.com/xtaci/smux"
 )
 
+// maxIdleStreams is the maximum number of idle cached streams of a method.
+const maxIdleStreams = 64
+
 type ClientConn struct {
-	dopts       *dialOptions
-	protocol    net.Network
-	session     *smux.Session
-	conn        net.Conn
-	streamCache map[string]types.ClientStream
+	dopts    *dialOptions
+	protocol net.Network
+	target   string
+
+	// stateMu guards the connectivity state, the resolver and the addrConns
+	// of the resolved addresses, the ClientConn keeps one addrConn per
+	// address. The picker of the balancer picks among the ready ones.
+	stateMu     sync.Mutex
+	state       connectivity.State
+	stateCh     chan struct{}
+	resolver    resolver.Resolver
+	resolved    bool
+	resolverErr error
+	conns       []*addrConn
+	balancer    balancer.Balancer
+	ready       []*addrConn
+	picker      balancer.Picker
+	closed      chan struct{}
+	closeOnce   sync.Once
+	// ctx is canceled by Close, it aborts the connections being set up.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// streamCache holds the idle unary streams of each method, a unary call
+	// takes one of them for itself and puts it back when the call succeeds.
+	mu          sync.Mutex
+	streamCache map[string][]*clientStream
+	// kpTime is the interval of the keepalive pings, it is doubled by each
+	// goaway for too many pings. It is guarded by mu.
+	kpTime time.Duration
 
 	args map[string]interface{}
 	pioc plugin.Container
 }
 
-type CallOption struct {
+// Dial creates a ClientConn to target. The target is either an address of
+// network or an URI of a registered resolver, e.g. static:///a,b,c or
+// dns:///host:port, whose resolved addresses use network unless they name
+// their own. The ClientConn keeps a connection to each address and
+// reconnects with exponential backoff when one is lost, the calls fail fast
+// with Unavailable while no connection is ready unless they are sent with
+// WaitForReady. Dial fails if no address can be connected at first.
+func Dial(network net.Network, target string, opts ...DialOption) (cc *ClientConn, err error) {
+	return DialContext(context.Background(), network, target, opts...)
 }
 
-func Dial(network net.Network, addr string, opts ...DialOption) (cc *ClientConn, err error) {
-	conn, err := net.Dial(context.Background(), network, addr)
-	if err != nil {
-		return
+// DialContext is Dial which gives up waiting for the first connection when
+// ctx is done, the ClientConn is closed and ctx.Err() is returned then.
+func DialContext(ctx context.Context, network net.Network, target string, opts ...DialOption) (cc *ClientConn, err error) {
+	dopts := &dialOptions{
+		copts:          ConnectOptions{dialer: net.GetDialer(network)},
+		codec:          "proto",
+		compressor:     "gzip",
+		bs:             DefaultBackoffConfig,
+		balancer:       balancer.PickFirst,
+		maxRecvMsgSize: defaultClientMaxRecvMsgSize,
+		smuxConfig:     smux.DefaultConfig(),
 	}
-	session, err := smux.Client(conn, nil)
-	if err != nil {
-		return
+	for _, opt := range opts {
+		opt.apply(dopts)
 	}
-	n, err := conn.Write([]byte(types.Preface))
-	if err != nil {
-		return
+	if dopts.insecure && dopts.creds != nil {
+		return nil, errors.New("xrpc: WithInsecure and WithTransportCredentials are both set")
 	}
-	if n != len(types.Preface) {
-		return nil, errors.New("wrote Preface length isn't match")
+	for _, c := range dopts.perRPCCreds {
+		if c.RequireTransportSecurity() && dopts.creds == nil {
+			return nil, errors.New("xrpc: the per RPC credentials require WithTransportCredentials")
+		}
 	}
-	dopts := &dialOptions{
-		copts:      ConnectOptions{dialer: net.GetDialer(network)},
-		codec:      "proto",
-		compressor: "gzip",
+	b := balancer.Get(dopts.balancer)
+	if b == nil {
+		return nil, fmt.Errorf("xrpc: unknown balancer %v", dopts.balancer)
 	}
-	for _, opt := range opts {
-		opt.apply(dopts)
+	if err = dopts.initServiceConfig(); err != nil {
+		return nil, err
 	}
+	chainUnaryClientInterceptors(dopts)
+	chainStreamClientInterceptors(dopts)
 	cc = &ClientConn{
 		dopts:       dopts,
 		protocol:    network,
-		session:     session,
-		conn:        conn,
-		streamCache: map[string]types.ClientStream{},
+		target:      target,
+		balancer:    b,
+		picker:      b.Build(nil),
+		state:       connectivity.Connecting,
+		stateCh:     make(chan struct{}),
+		closed:      make(chan struct{}),
+		streamCache: map[string][]*clientStream{},
+		kpTime:      dopts.kp.Time,
 		args:        map[string]interface{}{},
 		pioc:        plugin.NewPluginContainer(),
 	}
+	cc.ctx, cc.cancel = context.WithCancel(context.Background())
+	if t, ok := resolver.ParseTarget(target); ok && resolver.Get(t.Scheme) != nil {
+		r, err := resolver.Get(t.Scheme).Build(t, ccResolverWrapper{cc})
+		if err != nil {
+			cc.Close()
+			return nil, err
+		}
+		cc.stateMu.Lock()
+		cc.resolver = r
+		cc.stateMu.Unlock()
+	} else {
+		cc.updateAddresses([]resolver.Address{{Network: network, Addr: target}})
+	}
+	if !cc.WaitForStateChange(ctx, connectivity.Connecting) {
+		cc.Close()
+		return nil, ctx.Err()
+	}
+	cc.stateMu.Lock()
+	if cc.state == connectivity.TransientFailure {
+		err = cc.lastErrLocked()
+	}
+	cc.stateMu.Unlock()
+	if err != nil {
+		cc.Close()
+		return nil, err
+	}
 	return
 }
 
@@ -89,20 +170,32 @@ func (rc *RawClient) RawCall(ctx context.Context, method string, reply interface
 		return errors.New("method name should be: xxx.xxx")
 	}
 	fullMethod := fmt.Sprintf("/%s.%s/%s", customPrefix, arr[0], arr[1])
-	cs, err := rc.cc.NewStream(ctx, types.RawRPC, nil, fullMethod)
+	if rc.cc.dopts.unaryInt != nil {
+		return rc.cc.dopts.unaryInt(ctx, fullMethod, &args, reply, rc.cc, rawInvoke)
+	}
+	return rawInvoke(ctx, fullMethod, &args, reply, rc.cc)
+}
+
+func rawInvoke(ctx context.Context, method string, req, reply interface{}, cc *ClientConn, opts ...CallOption) (err error) {
+	cs, err := cc.newStream(ctx, types.RawRPC, nil, method)
 	if err != nil {
 		return
 	}
-	for k, v := range rc.cc.args {
+	s := cs.(*clientStream)
+	s.newCall()
+	defer cc.release(s, &err)
+	for k, v := range cc.args {
 		if vv, ok := v.(string); ok {
 			ctx = types.SetCookie(ctx, k, vv)
 		}
 	}
-	if err = cs.SendMsg(ctx, &args); err != nil {
+	if err = cs.SendMsg(ctx, req); err != nil {
 		return
 	}
-	ctx, err = cs.RecvMsg(ctx, reply)
-	return
+	if ctx, err = cs.RecvMsg(ctx, reply); err != nil {
+		return
+	}
+	return s.recvTrailer()
 }
 
 func (cc *ClientConn) ApplyPlugins(plugins ...plugin.Plugin) {
@@ -110,32 +203,108 @@ func (cc *ClientConn) ApplyPlugins(plugins ...plugin.Plugin) {
 		cc.pioc.Add(pp)
 	}
 }
+
+// ApplyPluginWithPriority applies the plugin with priority instead of the one
+// it declares, the lower runs first.
+func (cc *ClientConn) ApplyPluginWithPriority(p plugin.Plugin, priority int) {
+	cc.pioc.AddWithPriority(p, priority)
+}
+
+// PluginChain returns the plugins of the ClientConn in the order their hooks
+// of the replies run, the hooks of the requests run in the reverse order.
+func (cc *ClientConn) PluginChain() []plugin.Plugin {
+	return cc.pioc.Chain()
+}
 func (cc *ClientConn) SetHeaderArg(key string, value interface{}) {
 	cc.args[key] = value
 }
 
+// Invoke sends the unary call to the server and receives the reply, the call
+// goes through the unary interceptor of the ClientConn if there is one.
 func (cc *ClientConn) Invoke(ctx context.Context, method string, args, reply interface{}, opts ...CallOption) error {
-	handler := func() error {
-		return invoke(ctx, method, args, reply, cc, opts...)
+	opts = combine(cc.dopts.callOptions, opts)
+	opts = combine(cc.dopts.sc.callOptions(method), opts)
+	if cc.dopts.unaryInt != nil {
+		return cc.dopts.unaryInt(ctx, method, args, reply, cc, invokeWithRetry, opts...)
+	}
+	return invokeWithRetry(ctx, method, args, reply, cc, opts...)
+}
+
+// combine returns the default call options followed by the options of the call.
+func combine(o1 []CallOption, o2 []CallOption) []CallOption {
+	if len(o1) == 0 {
+		return o2
+	} else if len(o2) == 0 {
+		return o1
 	}
-	return handler()
+	ret := make([]CallOption, len(o1)+len(o2))
+	copy(ret, o1)
+	copy(ret[len(o1):], o2)
+	return ret
 }
 
 func genStreamKey(network net.Network, addr string, method string) string {
 	return fmt.Sprintf("%s://%s%s", network, addr, method)
 }
 
-func (cc *ClientConn) NewStream(ctx context.Context, rpc types.Rpc, desc *types.StreamDesc, method string, opts ...CallOption) (cs types.ClientStream, err error) {
+// NewStream creates a new stream for the method, the stream goes through the
+// stream interceptor of the ClientConn if there is one.
+func (cc *ClientConn) NewStream(ctx context.Context, rpc types.Rpc, desc *types.StreamDesc, method string, opts ...CallOption) (types.ClientStream, error) {
+	opts = combine(cc.dopts.callOptions, opts)
+	opts = combine(cc.dopts.sc.callOptions(method), opts)
+	if cc.dopts.streamInt != nil {
+		return cc.dopts.streamInt(ctx, rpc, desc, cc, method, newClientStream, opts...)
+	}
+	return cc.newStream(ctx, rpc, desc, method, opts...)
+}
+
+func newClientStream(ctx context.Context, rpc types.Rpc, desc *types.StreamDesc, cc *ClientConn, method string, opts ...CallOption) (types.ClientStream, error) {
+	return cc.newStream(ctx, rpc, desc, method, opts...)
+}
+
+// newStream creates a new stream for the method. Unary calls (desc is nil)
+// without a deadline, cancellation or per-RPC credentials reuse the idle
+// cached streams of the method, the stream belongs to the call until it is released. The other
+// calls own their stream until the call ends and abort it when ctx is done.
+func (cc *ClientConn) newStream(ctx context.Context, rpc types.Rpc, desc *types.StreamDesc, method string, opts ...CallOption) (cs types.ClientStream, err error) {
 	var stream net.Conn
-	var ok bool
-	streamKey := genStreamKey(cc.protocol, cc.session.RemoteAddr().String(), method)
-	if cs, ok = cc.streamCache[streamKey]; ok {
+	if err = ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	c := defaultCallInfo()
+	for _, o := range opts {
+		if err = o.before(c); err != nil {
+			return
+		}
+	}
+	ac, session, p, err := cc.readySession(ctx, c.failFast, method)
+	if err != nil {
 		return
 	}
+	// the per-RPC credentials are verified when a stream is opened, a cached
+	// stream would serve the later calls with the credentials of the first
+	cached := desc == nil && ctx.Done() == nil && len(cc.dopts.perRPCCreds) == 0
+	streamKey := genStreamKey(ac.addr.Network, ac.addr.Addr, method)
+	if cached {
+		if cs := cc.getStream(streamKey, session); cs != nil {
+			cs.startCall(ac)
+			return cs, nil
+		}
+	}
 
-	s, err := cc.session.OpenStream()
+	md := map[string]string{}
+	for _, c := range cc.dopts.perRPCCreds {
+		m, err := c.GetRequestMetadata(ctx, method)
+		if err != nil {
+			return nil, toStatusError(err, codes.Unauthenticated)
+		}
+		for k, v := range m {
+			md[k] = v
+		}
+	}
+	s, err := session.OpenStream()
 	if err != nil {
-		return nil, err
+		return nil, status.Error(codes.Unavailable, err.Error())
 	}
 	stream = &streamConn{s}
 
@@ -158,61 +327,169 @@ func (cc *ClientConn) NewStream(ctx context.Context, rpc types.Rpc, desc *types.
 	for k, v := range cc.args {
 		args[k] = v
 	}
-	header := &types.streamHeader{
+	for k, v := range md {
+		args[k] = v
+	}
+	header := &types.StreamHeader{
 		Cmd:        types.Init,
 		FullMethod: method,
 		RpcType:    rpc,
 		Args:       args,
 	}
-	headerJson, err := json.Marshal(&header)
-	if err != nil {
-		return nil, err
+	if deadline, ok := ctx.Deadline(); ok {
+		header.Timeout = time.Until(deadline)
 	}
-	hdr := types.msgHeader(headerJson, false)
-	hdr[0] = byte(types.cmdHeader)
-	if _, err = stream.Write(hdr); err != nil {
+	if err = sendCmd(stream, header); err != nil {
 		return nil, err
 	}
-	if _, err = stream.Write(headerJson); err != nil {
-		return nil, err
+	for k, v := range cc.args {
+		if vv, ok := v.(string); ok {
+			ctx = types.SetCookie(ctx, k, vv)
+		}
 	}
-	cs = &clientStream{
-		stream: stream,
-		header: header,
-		codec:  encoding.GetCodec(cc.dopts.codec),
-		cp:     encoding.GetCompressor(cc.dopts.compressor),
-		pioc:   cc.pioc,
+	cstream := &clientStream{
+		ctx:            ctx,
+		stream:         stream,
+		header:         header,
+		codec:          encoding.GetCodec(cc.dopts.codec),
+		cp:             encoding.GetCompressor(cc.dopts.compressor),
+		pioc:           cc.pioc,
+		cached:         cached,
+		key:            streamKey,
+		session:        session,
+		peer:           p,
+		singleReply:    desc != nil && !desc.ServerStreams,
+		recvSem:        make(chan struct{}, 1),
+		headerReady:    make(chan struct{}),
+		closed:         make(chan struct{}),
+		maxRecvMsgSize: cc.dopts.maxRecvMsgSize,
 	}
-	cc.streamCache[streamKey] = cs
-	return cs, err
+	cstream.startCall(ac)
+	if !cached && ctx.Done() != nil {
+		go cstream.watch(ctx)
+	}
+	return cstream, nil
 }
 
-func (cc *ClientConn) Close() (err error) {
-	err = cc.session.Close()
-	return
+// getStream takes an idle cached stream of the key on the session, it returns
+// nil if there is none.
+func (cc *ClientConn) getStream(streamKey string, session *smux.Session) *clientStream {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	idle := cc.streamCache[streamKey]
+	for len(idle) > 0 {
+		cs := idle[len(idle)-1]
+		idle = idle[:len(idle)-1]
+		if cs.session == session {
+			cc.streamCache[streamKey] = idle
+			return cs
+		}
+		// the stream belongs to a lost connection
+		cs.Close()
+	}
+	cc.streamCache[streamKey] = idle
+	return nil
+}
+
+// dropStreams closes the idle cached streams of the session after its goaway.
+func (cc *ClientConn) dropStreams(session *smux.Session) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	for key, idle := range cc.streamCache {
+		kept := idle[:0]
+		for _, cs := range idle {
+			if cs.session == session {
+				cs.Close()
+			} else {
+				kept = append(kept, cs)
+			}
+		}
+		cc.streamCache[key] = kept
+	}
 }
 
+// release ends a unary call on the stream. A cached stream goes back to the
+// idle streams if the call succeeded, otherwise the stream is closed, a failed
+// call may leave it closed by the server or out of step with it.
+func (cc *ClientConn) release(cs *clientStream, err *error) {
+	ac := cs.endCall()
+	if cs.cached && *err == nil && ac != nil {
+		cc.mu.Lock()
+		idle := cc.streamCache[cs.key]
+		// the session which got a goaway is closed by the server once its
+		// streams are closed
+		if len(idle) < maxIdleStreams && ac.hasSession(cs.session) {
+			cc.streamCache[cs.key] = append(idle, cs)
+			cc.mu.Unlock()
+			return
+		}
+		cc.mu.Unlock()
+	}
+	cs.Close()
+}
+
+// Close tears down the ClientConn, it moves to Shutdown, stops the resolver
+// and closes the connections to all the addresses.
+func (cc *ClientConn) Close() error {
+	cc.closeOnce.Do(func() {
+		cc.stateMu.Lock()
+		defer cc.stateMu.Unlock()
+		cc.setStateLocked(connectivity.Shutdown)
+		close(cc.closed)
+		cc.cancel()
+		if cc.resolver != nil {
+			cc.resolver.Close()
+		}
+		for _, ac := range cc.conns {
+			ac.tearDown()
+		}
+		cc.conns = nil
+	})
+	return nil
+}
+
+// Network returns the network passed to Dial.
 func (cc *ClientConn) Network() string {
-	return cc.conn.RemoteAddr().Network()
+	return cc.protocol
 }
 
+// Addr returns the target passed to Dial.
 func (cc *ClientConn) Addr() string {
-	return cc.conn.RemoteAddr().String()
+	return cc.target
 }
 
 func invoke(ctx context.Context, method string, req, reply interface{}, cc *ClientConn, opts ...CallOption) (err error) {
-	cs, err := cc.NewStream(ctx, types.XRPC, nil, method, opts...)
+	c := defaultCallInfo()
+	for _, o := range opts {
+		if err = o.before(c); err != nil {
+			return
+		}
+	}
+	cs, err := cc.newStream(ctx, types.XRPC, nil, method, opts...)
 	if err != nil {
 		return
 	}
+	s := cs.(*clientStream)
+	s.newCall()
+	defer cc.release(s, &err)
+	defer func() {
+		s.mu.Lock()
+		c.header, c.trailer = s.headerMD, s.trailerMD
+		s.mu.Unlock()
+		for _, o := range opts {
+			o.after(c)
+		}
+	}()
 	for k, v := range cc.args {
 		if vv, ok := v.(string); ok {
 			ctx = types.SetCookie(ctx, k, vv)
 		}
 	}
-	if err := cs.SendMsg(ctx, req); err != nil {
-		return err
+	if err = cs.SendMsg(ctx, req); err != nil {
+		return
 	}
-	ctx, err = cs.RecvMsg(ctx, reply)
-	return
+	if ctx, err = cs.RecvMsg(ctx, reply); err != nil {
+		return
+	}
+	return s.recvTrailer()
 }
@@ -0,0 +1,193 @@
+package xrpc_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"x.io/xrpc"
+	"x.io/xrpc/pkg/auth"
+	"x.io/xrpc/pkg/codes"
+	"x.io/xrpc/pkg/credentials"
+	"x.io/xrpc/pkg/net"
+	"x.io/xrpc/pkg/peer"
+	"x.io/xrpc/pkg/status"
+
+	"github.com/stretchr/testify/assert"
+	greeter_pb "x.io/xrpc/protocol/greeter"
+)
+
+const (
+	tlsAddr  = "localhost:9917"
+	mtlsAddr = "localhost:9918"
+)
+
+// testCA issues the certificates of the tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Equal(t, nil, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "xrpc test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.Equal(t, nil, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Equal(t, nil, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue returns a certificate of the SANs dnsName and uri.
+func (ca *testCA) issue(t *testing.T, dnsName, uri string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Equal(t, nil, err)
+	u, err := url.Parse(uri)
+	assert.Equal(t, nil, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: dnsName},
+		DNSNames:     []string{dnsName},
+		URIs:         []*url.URL{u},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	assert.Equal(t, nil, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// peerGreeter replies with the auth type and the URI SAN of the peer.
+type peerGreeter struct {
+	greeter_pb.UnimplementedGreeterServer
+}
+
+func (g *peerGreeter) SayHello(ctx context.Context, req *greeter_pb.HelloRequest) (*greeter_pb.HelloReply, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.AuthInfo == nil {
+		return &greeter_pb.HelloReply{Message: "insecure"}, nil
+	}
+	msg := p.AuthInfo.AuthType()
+	if cert, err := credentials.PeerCertificate(p.AuthInfo); err == nil {
+		msg += " " + cert.URIs[0].String()
+	}
+	return &greeter_pb.HelloReply{Message: msg}, nil
+}
+
+// sanAuthenticator accepts the clients whose certificate has the DNS SAN name.
+type sanAuthenticator struct {
+	name string
+}
+
+func (a sanAuthenticator) Authenticate(ctx context.Context, req *auth.Request) (*auth.Identity, error) {
+	cert, err := credentials.PeerCertificate(req.Peer.AuthInfo)
+	if err != nil {
+		return nil, err
+	}
+	if err = cert.VerifyHostname(a.name); err != nil {
+		return nil, errors.New("the client is not " + a.name)
+	}
+	return &auth.Identity{Subject: a.name}, nil
+}
+
+func serveTLS(t *testing.T, network, addr string, creds credentials.TransportCredentials, opts ...xrpc.ServerOption) *xrpc.Server {
+	lis, err := net.Listen(context.Background(), network, addr)
+	assert.Equal(t, nil, err)
+	s := xrpc.NewServer(append(opts, xrpc.Creds(creds))...)
+	greeter_pb.RegisterGreeterServer(s, &peerGreeter{})
+	go s.Serve(lis)
+	return s
+}
+
+func sayHello(network, addr string, opts ...xrpc.DialOption) (string, error) {
+	conn, err := xrpc.Dial(network, addr, opts...)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	r, err := greeter_pb.NewGreeterClient(conn).SayHello(ctx, &greeter_pb.HelloRequest{Name: "tls"})
+	return r.GetMessage(), err
+}
+
+func TestTLS(t *testing.T) {
+	ca := newTestCA(t)
+	cert := ca.issue(t, "localhost", "spiffe://xrpc/server")
+	sock := filepath.Join(os.TempDir(), "xrpc_tls.sock")
+	os.Remove(sock)
+	for network, addr := range map[string]string{net.TCP: tlsAddr, net.UNIX: sock} {
+		s := serveTLS(t, network, addr, credentials.NewServerTLSFromCert(&cert))
+		// the name of the server is verified, the socket path is no name
+		creds := credentials.NewClientTLSFromCert(ca.pool, "localhost")
+		msg, err := sayHello(network, addr, xrpc.WithTransportCredentials(creds))
+		assert.Equal(t, nil, err)
+		assert.Equal(t, "tls", msg)
+
+		// an unknown server is rejected
+		_, err = sayHello(network, addr, xrpc.WithTransportCredentials(credentials.NewClientTLSFromCert(x509.NewCertPool(), "localhost")))
+		assert.NotEqual(t, nil, err)
+		// an insecure client cannot talk to the server
+		_, err = sayHello(network, addr, xrpc.WithInsecure())
+		assert.NotEqual(t, nil, err)
+		s.Stop()
+	}
+
+	_, err := xrpc.Dial(net.TCP, tlsAddr, xrpc.WithInsecure(),
+		xrpc.WithTransportCredentials(credentials.NewClientTLSFromCert(ca.pool, "")))
+	assert.NotEqual(t, nil, err)
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert := ca.issue(t, "localhost", "spiffe://xrpc/server")
+	s := serveTLS(t, net.TCP, mtlsAddr, credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    ca.pool,
+	}), xrpc.ConnectionTimeout(time.Second))
+	s.SetAuthenticator(sanAuthenticator{name: "admin.xrpc"})
+	defer s.Stop()
+
+	clientCreds := func(cert ...tls.Certificate) xrpc.DialOption {
+		return xrpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+			Certificates: cert,
+			RootCAs:      ca.pool,
+		}))
+	}
+	// the handler sees the certificate of the client
+	msg, err := sayHello(net.TCP, mtlsAddr, clientCreds(ca.issue(t, "admin.xrpc", "spiffe://xrpc/admin")))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "tls spiffe://xrpc/admin", msg)
+
+	// the Authenticator rejects the other clients
+	_, err = sayHello(net.TCP, mtlsAddr, clientCreds(ca.issue(t, "guest.xrpc", "spiffe://xrpc/guest")))
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// a client without certificate fails the handshake
+	_, err = sayHello(net.TCP, mtlsAddr, clientCreds())
+	assert.NotEqual(t, nil, err)
+}
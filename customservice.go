@@ -13,19 +13,25 @@ import (
 
 	"x.io/xrpc/plugin"
 
+	"x.io/xrpc/pkg/codes"
 	"x.io/xrpc/pkg/encoding"
 	_ "x.io/xrpc/pkg/encoding/json"
+	"x.io/xrpc/pkg/status"
 )
 
 const (
 	customPrefix = "custom"
 )
 
-// ServiceInfo service info.
+// ServiceInfo describes a service registered on a Server.
 type ServiceInfo struct {
-	Name    string
+	Name string
+	// PkgPath is the package path of the implementation of the service.
 	PkgPath string
 	Methods []*MethodInfo
+	// FileDescriptor is the proto encoded FileDescriptorProto of the proto
+	// file which defines a proto service.
+	FileDescriptor []byte `json:",omitempty"`
 }
 
 type UnaryHandler func(ctx context.Context, req interface{}) (interface{}, error)
@@ -34,12 +40,18 @@ type StdHandler func(srv interface{}, ctx context.Context, dec func(interface{})
 
 type CustomHandler func(srv interface{}, ctx context.Context)
 
+// MethodInfo describes a method of a service. ReqName and ReplyName are the
+// full names of the messages of a proto method, the Go types of the arguments
+// and results of the other methods, whose json schemas are Req and Reply.
 type MethodInfo struct {
 	Name      string
 	ReqName   string
-	Req       string
+	Req       string `json:",omitempty"`
 	ReplyName string
-	Reply     string
+	Reply     string `json:",omitempty"`
+	// IsClientStream and IsServerStream are set on the streaming methods.
+	IsClientStream bool
+	IsServerStream bool
 }
 
 func Call(f reflect.Value, params ...interface{}) (out []interface{}, err error) {
@@ -147,6 +159,16 @@ func (r *CustomServer) RegisterFunction(serviceName string, fname string, fn int
 	return
 }
 
+// hasMethod reports whether the method of the service is registered.
+func (r *CustomServer) hasMethod(service, method string) bool {
+	srv, ok := r.m[service]
+	if !ok {
+		return false
+	}
+	_, ok = srv.md[method]
+	return ok
+}
+
 func (r *CustomServer) RpcCall(ctx context.Context, service, method string, dec func(interface{}) error, interceptor types.UnaryServerInterceptor) (reply interface{}, err error) {
 	srv, knownService := r.m[service]
 	if knownService {
@@ -179,9 +201,10 @@ func (r *CustomServer) RpcCall(ctx context.Context, service, method string, dec
 				}
 				reply, err = interceptor(ctx, ins, info, handler)
 			}
+			return
 		}
 	}
-	return
+	return nil, status.Errorf(codes.Unimplemented, "xrpc: unknown method %v for service %v", method, service)
 }
 
 func (r *CustomServer) DirectCall(method string, data []byte) (result interface{}, err error) {
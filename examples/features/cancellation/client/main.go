@@ -26,20 +26,22 @@ import (
 	"log"
 	"time"
 
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	pb "google.golang.org/grpc/examples/features/proto/echo"
-	"google.golang.org/grpc/status"
+	"x.io/xrpc"
+	"x.io/xrpc/pkg/codes"
+	_ "x.io/xrpc/pkg/encoding/gzip"
+	_ "x.io/xrpc/pkg/encoding/proto"
+	"x.io/xrpc/pkg/status"
+	pb "x.io/xrpc/protocol/routeguide"
 )
 
 var addr = flag.String("addr", "localhost:50051", "the address to connect to")
 
-func sendMessage(stream pb.Echo_BidirectionalStreamingEchoClient, msg string) error {
+func sendMessage(stream pb.RouteGuide_RouteChatClient, msg string) error {
 	fmt.Printf("sending message %q\n", msg)
-	return stream.Send(&pb.EchoRequest{Message: msg})
+	return stream.Send(&pb.RouteNote{Message: msg})
 }
 
-func recvMessage(stream pb.Echo_BidirectionalStreamingEchoClient, wantErrCode codes.Code) {
+func recvMessage(stream pb.RouteGuide_RouteChatClient, wantErrCode codes.Code) {
 	res, err := stream.Recv()
 	if status.Code(err) != wantErrCode {
 		log.Fatalf("stream.Recv() = %v, %v; want _, status.Code(err)=%v", res, err, wantErrCode)
@@ -55,17 +57,17 @@ func main() {
 	flag.Parse()
 
 	// Set up a connection to the server.
-	conn, err := grpc.Dial(*addr, grpc.WithInsecure())
+	conn, err := xrpc.Dial("tcp", *addr, xrpc.WithInsecure())
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
 	defer conn.Close()
 
-	c := pb.NewEchoClient(conn)
+	c := pb.NewRouteGuideClient(conn)
 
 	// Initiate the stream with a context that supports cancellation.
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	stream, err := c.BidirectionalStreamingEcho(ctx)
+	stream, err := c.RouteChat(ctx)
 	if err != nil {
 		log.Fatalf("error creating stream: %v", err)
 	}
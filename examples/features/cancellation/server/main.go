@@ -20,24 +20,32 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io"
 	"log"
-	"net"
 
-	"google.golang.org/grpc"
+	"x.io/xrpc"
+	_ "x.io/xrpc/pkg/encoding/gzip"
+	_ "x.io/xrpc/pkg/encoding/proto"
+	"x.io/xrpc/pkg/net"
 
-	pb "google.golang.org/grpc/examples/features/proto/echo"
+	pb "x.io/xrpc/protocol/routeguide"
 )
 
 var port = flag.Int("port", 50051, "the port to serve on")
 
 type server struct {
-	pb.UnimplementedEchoServer
+	pb.UnimplementedRouteGuideServer
 }
 
-func (s *server) BidirectionalStreamingEcho(stream pb.Echo_BidirectionalStreamingEchoServer) error {
+func (s *server) RouteChat(stream pb.RouteGuide_RouteChatServer) error {
+	// the context of the stream is canceled when the client gives up the call
+	go func() {
+		<-stream.Context().Done()
+		fmt.Printf("server: stream context done: %v\n", stream.Context().Err())
+	}()
 	for {
 		in, err := stream.Recv()
 		if err != nil {
@@ -48,19 +56,19 @@ func (s *server) BidirectionalStreamingEcho(stream pb.Echo_BidirectionalStreamin
 			return err
 		}
 		fmt.Printf("echoing message %q\n", in.Message)
-		stream.Send(&pb.EchoResponse{Message: in.Message})
+		stream.Send(in)
 	}
 }
 
 func main() {
 	flag.Parse()
 
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *port))
+	lis, err := net.Listen(context.Background(), "tcp", fmt.Sprintf(":%d", *port))
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
 	fmt.Printf("server listening at port %v\n", lis.Addr())
-	s := grpc.NewServer()
-	pb.RegisterEchoServer(s, &server{})
+	s := xrpc.NewServer()
+	pb.RegisterRouteGuideServer(s, &server{})
 	s.Serve(lis)
 }
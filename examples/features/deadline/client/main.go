@@ -26,38 +26,41 @@ import (
 	"log"
 	"time"
 
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	pb "google.golang.org/grpc/examples/features/proto/echo"
-	"google.golang.org/grpc/status"
+	"x.io/xrpc"
+	"x.io/xrpc/pkg/codes"
+	_ "x.io/xrpc/pkg/encoding/gzip"
+	_ "x.io/xrpc/pkg/encoding/proto"
+	"x.io/xrpc/pkg/status"
+	pb "x.io/xrpc/protocol/greeter"
+	rgpb "x.io/xrpc/protocol/routeguide"
 )
 
 var addr = flag.String("addr", "localhost:50052", "the address to connect to")
 
-func unaryCall(c pb.EchoClient, requestID int, message string, want codes.Code) {
+func unaryCall(c pb.GreeterClient, requestID int, message string, want codes.Code) {
 	// Creates a context with a one second deadline for the RPC.
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
-	req := &pb.EchoRequest{Message: message}
+	req := &pb.HelloRequest{Name: message}
 
-	_, err := c.UnaryEcho(ctx, req)
+	_, err := c.SayHello(ctx, req)
 	got := status.Code(err)
 	fmt.Printf("[%v] wanted = %v, got = %v\n", requestID, want, got)
 }
 
-func streamingCall(c pb.EchoClient, requestID int, message string, want codes.Code) {
+func streamingCall(c rgpb.RouteGuideClient, requestID int, message string, want codes.Code) {
 	// Creates a context with a one second deadline for the RPC.
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
-	stream, err := c.BidirectionalStreamingEcho(ctx)
+	stream, err := c.RouteChat(ctx)
 	if err != nil {
 		log.Printf("Stream err: %v", err)
 		return
 	}
 
-	err = stream.Send(&pb.EchoRequest{Message: message})
+	err = stream.Send(&rgpb.RouteNote{Message: message})
 	if err != nil {
 		log.Printf("Send error: %v", err)
 		return
@@ -72,13 +75,14 @@ func streamingCall(c pb.EchoClient, requestID int, message string, want codes.Co
 func main() {
 	flag.Parse()
 
-	conn, err := grpc.Dial(*addr, grpc.WithInsecure(), grpc.WithBlock())
+	conn, err := xrpc.Dial("tcp", *addr, xrpc.WithInsecure())
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
 	defer conn.Close()
 
-	c := pb.NewEchoClient(conn)
+	c := pb.NewGreeterClient(conn)
+	rc := rgpb.NewRouteGuideClient(conn)
 
 	// A successful request
 	unaryCall(c, 1, "world", codes.OK)
@@ -89,7 +93,7 @@ func main() {
 	// Exceeds propagated deadline
 	unaryCall(c, 4, "[propagate me][propagate me]world", codes.DeadlineExceeded)
 	// Receives a response from the stream successfully.
-	streamingCall(c, 5, "[propagate me]world", codes.OK)
+	streamingCall(rc, 5, "[propagate me]world", codes.OK)
 	// Exceeds propagated deadline before receiving a response
-	streamingCall(c, 6, "[propagate me][propagate me]world", codes.DeadlineExceeded)
+	streamingCall(rc, 6, "[propagate me][propagate me]world", codes.DeadlineExceeded)
 }
@@ -25,42 +25,48 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"net"
 	"strings"
 	"time"
 
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"x.io/xrpc"
+	"x.io/xrpc/pkg/codes"
+	_ "x.io/xrpc/pkg/encoding/gzip"
+	_ "x.io/xrpc/pkg/encoding/proto"
+	"x.io/xrpc/pkg/net"
+	"x.io/xrpc/pkg/status"
 
-	pb "google.golang.org/grpc/examples/features/proto/echo"
+	pb "x.io/xrpc/protocol/greeter"
+	rgpb "x.io/xrpc/protocol/routeguide"
 )
 
 var port = flag.Int("port", 50052, "port number")
 
-// server is used to implement EchoServer.
+// server is used to implement GreeterServer and RouteGuideServer, it calls
+// itself to propagate the deadlines.
 type server struct {
-	pb.UnimplementedEchoServer
-	client pb.EchoClient
-	cc     *grpc.ClientConn
+	pb.UnimplementedGreeterServer
+	rgpb.UnimplementedRouteGuideServer
+	client pb.GreeterClient
+	cc     *xrpc.ClientConn
 }
 
-func (s *server) UnaryEcho(ctx context.Context, req *pb.EchoRequest) (*pb.EchoResponse, error) {
-	message := req.Message
+func (s *server) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	message := req.Name
 	if strings.HasPrefix(message, "[propagate me]") {
 		time.Sleep(800 * time.Millisecond)
 		message = strings.TrimPrefix(message, "[propagate me]")
-		return s.client.UnaryEcho(ctx, &pb.EchoRequest{Message: message})
+		// the deadline of ctx goes along with the call
+		return s.client.SayHello(ctx, &pb.HelloRequest{Name: message})
 	}
 
 	if message == "delay" {
 		time.Sleep(1500 * time.Millisecond)
 	}
 
-	return &pb.EchoResponse{Message: req.Message}, nil
+	return &pb.HelloReply{Message: req.Name}, nil
 }
 
-func (s *server) BidirectionalStreamingEcho(stream pb.Echo_BidirectionalStreamingEchoServer) error {
+func (s *server) RouteChat(stream rgpb.RouteGuide_RouteChatServer) error {
 	for {
 		req, err := stream.Recv()
 		if err == io.EOF {
@@ -74,17 +80,17 @@ func (s *server) BidirectionalStreamingEcho(stream pb.Echo_BidirectionalStreamin
 		if strings.HasPrefix(message, "[propagate me]") {
 			time.Sleep(800 * time.Millisecond)
 			message = strings.TrimPrefix(message, "[propagate me]")
-			res, err := s.client.UnaryEcho(stream.Context(), &pb.EchoRequest{Message: message})
+			res, err := s.client.SayHello(stream.Context(), &pb.HelloRequest{Name: message})
 			if err != nil {
 				return err
 			}
-			stream.Send(res)
+			stream.Send(&rgpb.RouteNote{Message: res.Message})
 		}
 
 		if message == "delay" {
 			time.Sleep(1500 * time.Millisecond)
 		}
-		stream.Send(&pb.EchoResponse{Message: message})
+		stream.Send(&rgpb.RouteNote{Message: message})
 	}
 }
 
@@ -92,31 +98,36 @@ func (s *server) Close() {
 	s.cc.Close()
 }
 
-func newEchoServer() *server {
+// dial connects the server to itself once it is serving.
+func (s *server) dial() {
 	target := fmt.Sprintf("localhost:%v", *port)
-	cc, err := grpc.Dial(target, grpc.WithInsecure())
+	cc, err := xrpc.Dial("tcp", target, xrpc.WithInsecure())
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
-	return &server{client: pb.NewEchoClient(cc), cc: cc}
+	s.client, s.cc = pb.NewGreeterClient(cc), cc
 }
 
 func main() {
 	flag.Parse()
 
 	address := fmt.Sprintf(":%v", *port)
-	lis, err := net.Listen("tcp", address)
+	lis, err := net.Listen(context.Background(), "tcp", address)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
-	echoServer := newEchoServer()
-	defer echoServer.Close()
-
-	grpcServer := grpc.NewServer()
-	pb.RegisterEchoServer(grpcServer, echoServer)
+	echoServer := &server{}
+	xrpcServer := xrpc.NewServer()
+	pb.RegisterGreeterServer(xrpcServer, echoServer)
+	rgpb.RegisterRouteGuideServer(xrpcServer, echoServer)
 
-	if err := grpcServer.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
-	}
+	go func() {
+		if err := xrpcServer.Serve(lis); err != nil {
+			log.Fatalf("failed to serve: %v", err)
+		}
+	}()
+	echoServer.dial()
+	defer echoServer.Close()
+	xrpcServer.Start()
 }
@@ -26,15 +26,17 @@ import (
 	"log"
 	"time"
 
-	"google.golang.org/grpc"
-	pb "google.golang.org/grpc/examples/features/proto/echo"
-	"google.golang.org/grpc/keepalive"
+	"x.io/xrpc"
+	_ "x.io/xrpc/pkg/encoding/gzip"
+	_ "x.io/xrpc/pkg/encoding/proto"
+	"x.io/xrpc/pkg/keepalive"
+	pb "x.io/xrpc/protocol/greeter"
 )
 
 var addr = flag.String("addr", "localhost:50052", "the address to connect to")
 
 var kacp = keepalive.ClientParameters{
-	Time:                10 * time.Second, // send pings every 10 seconds if there is no activity
+	Time:                10 * time.Second, // send pings every 10 seconds
 	Timeout:             time.Second,      // wait 1 second for ping ack before considering the connection dead
 	PermitWithoutStream: true,             // send pings even without active streams
 }
@@ -42,21 +44,25 @@ var kacp = keepalive.ClientParameters{
 func main() {
 	flag.Parse()
 
-	conn, err := grpc.Dial(*addr, grpc.WithInsecure(), grpc.WithKeepaliveParams(kacp))
+	conn, err := xrpc.Dial("tcp", *addr, xrpc.WithInsecure(), xrpc.WithKeepaliveParams(kacp))
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
 	defer conn.Close()
 
-	c := pb.NewEchoClient(conn)
+	c := pb.NewGreeterClient(conn)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
 	defer cancel()
 	fmt.Println("Performing unary request")
-	res, err := c.UnaryEcho(ctx, &pb.EchoRequest{Message: "keepalive demo"})
+	res, err := c.SayHello(ctx, &pb.HelloRequest{Name: "keepalive demo"})
 	if err != nil {
-		log.Fatalf("unexpected error from UnaryEcho: %v", err)
+		log.Fatalf("unexpected error from SayHello: %v", err)
 	}
 	fmt.Println("RPC response:", res)
-	select {} // Block forever; run with GODEBUG=http2debug=2 to observe ping frames and GOAWAYs due to idleness.
+	// Watch the connection go away for idleness and age and come back.
+	for state := conn.GetState(); ; state = conn.GetState() {
+		conn.WaitForStateChange(context.Background(), state)
+		fmt.Println(time.Now().Format("15:04:05"), "connection state:", conn.GetState())
+	}
 }
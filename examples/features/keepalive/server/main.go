@@ -24,13 +24,15 @@ import (
 	"flag"
 	"fmt"
 	"log"
-	"net"
 	"time"
 
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/keepalive"
+	"x.io/xrpc"
+	_ "x.io/xrpc/pkg/encoding/gzip"
+	_ "x.io/xrpc/pkg/encoding/proto"
+	"x.io/xrpc/pkg/keepalive"
+	"x.io/xrpc/pkg/net"
 
-	pb "google.golang.org/grpc/examples/features/proto/echo"
+	pb "x.io/xrpc/protocol/greeter"
 )
 
 var port = flag.Int("port", 50052, "port number")
@@ -44,30 +46,30 @@ var kasp = keepalive.ServerParameters{
 	MaxConnectionIdle:     15 * time.Second, // If a client is idle for 15 seconds, send a GOAWAY
 	MaxConnectionAge:      30 * time.Second, // If any connection is alive for more than 30 seconds, send a GOAWAY
 	MaxConnectionAgeGrace: 5 * time.Second,  // Allow 5 seconds for pending RPCs to complete before forcibly closing connections
-	Time:                  5 * time.Second,  // Ping the client if it is idle for 5 seconds to ensure the connection is still active
+	Time:                  5 * time.Second,  // Ping the client every 5 seconds to ensure the connection is still active
 	Timeout:               1 * time.Second,  // Wait 1 second for the ping ack before assuming the connection is dead
 }
 
-// server implements EchoServer.
+// server implements GreeterServer.
 type server struct {
-	pb.UnimplementedEchoServer
+	pb.UnimplementedGreeterServer
 }
 
-func (s *server) UnaryEcho(ctx context.Context, req *pb.EchoRequest) (*pb.EchoResponse, error) {
-	return &pb.EchoResponse{Message: req.Message}, nil
+func (s *server) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	return &pb.HelloReply{Message: req.Name}, nil
 }
 
 func main() {
 	flag.Parse()
 
 	address := fmt.Sprintf(":%v", *port)
-	lis, err := net.Listen("tcp", address)
+	lis, err := net.Listen(context.Background(), "tcp", address)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
-	s := grpc.NewServer(grpc.KeepaliveEnforcementPolicy(kaep), grpc.KeepaliveParams(kasp))
-	pb.RegisterEchoServer(s, &server{})
+	s := xrpc.NewServer(xrpc.KeepaliveEnforcementPolicy(kaep), xrpc.KeepaliveParams(kasp))
+	pb.RegisterGreeterServer(s, &server{})
 
 	if err := s.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
@@ -25,65 +25,68 @@ import (
 	"log"
 	"time"
 
-	"google.golang.org/grpc"
-	ecpb "google.golang.org/grpc/examples/features/proto/echo"
-	"google.golang.org/grpc/resolver"
+	"x.io/xrpc"
+	"x.io/xrpc/pkg/balancer"
+	_ "x.io/xrpc/pkg/encoding/gzip"
+	_ "x.io/xrpc/pkg/encoding/proto"
+	"x.io/xrpc/pkg/resolver"
+	pb "x.io/xrpc/protocol/greeter"
 )
 
 const (
 	exampleScheme      = "example"
-	exampleServiceName = "lb.example.grpc.io"
+	exampleServiceName = "lb.example.xrpc.io"
 )
 
 var addrs = []string{"localhost:50051", "localhost:50052"}
 
-func callUnaryEcho(c ecpb.EchoClient, message string) {
+func callSayHello(c pb.GreeterClient, message string) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
-	r, err := c.UnaryEcho(ctx, &ecpb.EchoRequest{Message: message})
+	r, err := c.SayHello(ctx, &pb.HelloRequest{Name: message})
 	if err != nil {
 		log.Fatalf("could not greet: %v", err)
 	}
 	fmt.Println(r.Message)
 }
 
-func makeRPCs(cc *grpc.ClientConn, n int) {
-	hwc := ecpb.NewEchoClient(cc)
+func makeRPCs(cc *xrpc.ClientConn, n int) {
+	hwc := pb.NewGreeterClient(cc)
 	for i := 0; i < n; i++ {
-		callUnaryEcho(hwc, "this is examples/load_balancing")
+		callSayHello(hwc, "this is examples/load_balancing")
 	}
 }
 
 func main() {
-	pickfirstConn, err := grpc.Dial(
+	pickfirstConn, err := xrpc.Dial(
+		"tcp",
 		fmt.Sprintf("%s:///%s", exampleScheme, exampleServiceName),
-		// grpc.WithBalancerName("pick_first"), // "pick_first" is the default, so this DialOption is not necessary.
-		grpc.WithInsecure(),
-		grpc.WithBlock(),
+		// xrpc.WithBalancer(balancer.PickFirst), // balancer.PickFirst is the default, so this DialOption is not necessary.
+		xrpc.WithInsecure(),
 	)
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
 	defer pickfirstConn.Close()
 
-	fmt.Println("--- calling helloworld.Greeter/SayHello with pick_first ---")
+	fmt.Println("--- calling greeter.Greeter/SayHello with PickFirst ---")
 	makeRPCs(pickfirstConn, 10)
 
 	fmt.Println()
 
-	// Make another ClientConn with round_robin policy.
-	roundrobinConn, err := grpc.Dial(
+	// Make another ClientConn with Round policy.
+	roundrobinConn, err := xrpc.Dial(
+		"tcp",
 		fmt.Sprintf("%s:///%s", exampleScheme, exampleServiceName),
-		grpc.WithBalancerName("round_robin"), // This sets the initial balancing policy.
-		grpc.WithInsecure(),
-		grpc.WithBlock(),
+		xrpc.WithBalancer(balancer.Round), // This sets the balancing policy.
+		xrpc.WithInsecure(),
 	)
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
 	defer roundrobinConn.Close()
 
-	fmt.Println("--- calling helloworld.Greeter/SayHello with round_robin ---")
+	fmt.Println("--- calling greeter.Greeter/SayHello with Round ---")
 	makeRPCs(roundrobinConn, 10)
 }
 
@@ -92,7 +95,7 @@ func main() {
 
 type exampleResolverBuilder struct{}
 
-func (*exampleResolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+func (*exampleResolverBuilder) Build(target resolver.Target, cc resolver.ClientConn) (resolver.Resolver, error) {
 	r := &exampleResolver{
 		target: target,
 		cc:     cc,
@@ -119,8 +122,8 @@ func (r *exampleResolver) start() {
 	}
 	r.cc.UpdateState(resolver.State{Addresses: addrs})
 }
-func (*exampleResolver) ResolveNow(o resolver.ResolveNowOptions) {}
-func (*exampleResolver) Close()                                  {}
+func (*exampleResolver) ResolveNow() {}
+func (*exampleResolver) Close()      {}
 
 func init() {
 	resolver.Register(&exampleResolverBuilder{})
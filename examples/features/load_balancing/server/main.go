@@ -23,34 +23,36 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"net"
 	"sync"
 
-	"google.golang.org/grpc"
+	"x.io/xrpc"
+	_ "x.io/xrpc/pkg/encoding/gzip"
+	_ "x.io/xrpc/pkg/encoding/proto"
+	"x.io/xrpc/pkg/net"
 
-	pb "google.golang.org/grpc/examples/features/proto/echo"
+	pb "x.io/xrpc/protocol/greeter"
 )
 
 var (
 	addrs = []string{":50051", ":50052"}
 )
 
-type ecServer struct {
-	pb.UnimplementedEchoServer
+type hwServer struct {
+	pb.UnimplementedGreeterServer
 	addr string
 }
 
-func (s *ecServer) UnaryEcho(ctx context.Context, req *pb.EchoRequest) (*pb.EchoResponse, error) {
-	return &pb.EchoResponse{Message: fmt.Sprintf("%s (from %s)", req.Message, s.addr)}, nil
+func (s *hwServer) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	return &pb.HelloReply{Message: fmt.Sprintf("%s (from %s)", req.Name, s.addr)}, nil
 }
 
 func startServer(addr string) {
-	lis, err := net.Listen("tcp", addr)
+	lis, err := net.Listen(context.Background(), "tcp", addr)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
-	s := grpc.NewServer()
-	pb.RegisterEchoServer(s, &ecServer{addr: addr})
+	s := xrpc.NewServer()
+	pb.RegisterGreeterServer(s, &hwServer{addr: addr})
 	log.Printf("serving on %s\n", addr)
 	if err := s.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
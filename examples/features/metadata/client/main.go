@@ -27,9 +27,11 @@ import (
 	"log"
 	"time"
 
-	"google.golang.org/grpc"
-	pb "google.golang.org/grpc/examples/features/proto/echo"
-	"google.golang.org/grpc/metadata"
+	"x.io/xrpc"
+	_ "x.io/xrpc/pkg/encoding/gzip"
+	_ "x.io/xrpc/pkg/encoding/proto"
+	pb "x.io/xrpc/protocol/routeguide"
+	"x.io/xrpc/types"
 )
 
 var addr = flag.String("addr", "localhost:50051", "the address to connect to")
@@ -39,58 +41,49 @@ const (
 	streamingCount  = 10
 )
 
-func unaryCallWithMetadata(c pb.EchoClient, message string) {
+// setTimestamp sets the timestamp sent with the next call, the header args
+// are sent when a stream is opened.
+func setTimestamp(conn *xrpc.ClientConn) {
+	conn.SetHeaderArg("timestamp", time.Now().Format(timestampFormat))
+}
+
+// printMD prints the values of key in md, it fails if there is none.
+func printMD(md types.MD, key, from string) {
+	v := md.Get(key)
+	if len(v) == 0 {
+		log.Fatalf("%s expected but doesn't exist in %s", key, from)
+	}
+	fmt.Printf("%s from %s:\n", key, from)
+	for i, e := range v {
+		fmt.Printf(" %d. %s\n", i, e)
+	}
+}
+
+func unaryCallWithMetadata(conn *xrpc.ClientConn, c pb.RouteGuideClient) {
 	fmt.Printf("--- unary ---\n")
-	// Create metadata and context.
-	md := metadata.Pairs("timestamp", time.Now().Format(timestampFormat))
-	ctx := metadata.NewOutgoingContext(context.Background(), md)
+	setTimestamp(conn)
 
-	// Make RPC using the context with the metadata.
-	var header, trailer metadata.MD
-	r, err := c.UnaryEcho(ctx, &pb.EchoRequest{Message: message}, grpc.Header(&header), grpc.Trailer(&trailer))
+	// Make RPC with the options which receive the metadata.
+	var header, trailer types.MD
+	r, err := c.GetFeature(context.Background(), &pb.Point{Latitude: 1, Longitude: 1}, xrpc.Header(&header), xrpc.Trailer(&trailer))
 	if err != nil {
-		log.Fatalf("failed to call UnaryEcho: %v", err)
+		log.Fatalf("failed to call GetFeature: %v", err)
 	}
 
-	if t, ok := header["timestamp"]; ok {
-		fmt.Printf("timestamp from header:\n")
-		for i, e := range t {
-			fmt.Printf(" %d. %s\n", i, e)
-		}
-	} else {
-		log.Fatal("timestamp expected but doesn't exist in header")
-	}
-	if l, ok := header["location"]; ok {
-		fmt.Printf("location from header:\n")
-		for i, e := range l {
-			fmt.Printf(" %d. %s\n", i, e)
-		}
-	} else {
-		log.Fatal("location expected but doesn't exist in header")
-	}
+	printMD(header, "timestamp", "header")
+	printMD(header, "location", "header")
 	fmt.Printf("response:\n")
-	fmt.Printf(" - %s\n", r.Message)
-
-	if t, ok := trailer["timestamp"]; ok {
-		fmt.Printf("timestamp from trailer:\n")
-		for i, e := range t {
-			fmt.Printf(" %d. %s\n", i, e)
-		}
-	} else {
-		log.Fatal("timestamp expected but doesn't exist in trailer")
-	}
+	fmt.Printf(" - %v\n", r)
+	printMD(trailer, "timestamp", "trailer")
 }
 
-func serverStreamingWithMetadata(c pb.EchoClient, message string) {
+func serverStreamingWithMetadata(conn *xrpc.ClientConn, c pb.RouteGuideClient) {
 	fmt.Printf("--- server streaming ---\n")
-	// Create metadata and context.
-	md := metadata.Pairs("timestamp", time.Now().Format(timestampFormat))
-	ctx := metadata.NewOutgoingContext(context.Background(), md)
+	setTimestamp(conn)
 
-	// Make RPC using the context with the metadata.
-	stream, err := c.ServerStreamingEcho(ctx, &pb.EchoRequest{Message: message})
+	stream, err := c.ListFeatures(context.Background(), &pb.Rectangle{Lo: &pb.Point{}, Hi: &pb.Point{}})
 	if err != nil {
-		log.Fatalf("failed to call ServerStreamingEcho: %v", err)
+		log.Fatalf("failed to call ListFeatures: %v", err)
 	}
 
 	// Read the header when the header arrives.
@@ -98,23 +91,8 @@ func serverStreamingWithMetadata(c pb.EchoClient, message string) {
 	if err != nil {
 		log.Fatalf("failed to get header from stream: %v", err)
 	}
-	// Read metadata from server's header.
-	if t, ok := header["timestamp"]; ok {
-		fmt.Printf("timestamp from header:\n")
-		for i, e := range t {
-			fmt.Printf(" %d. %s\n", i, e)
-		}
-	} else {
-		log.Fatal("timestamp expected but doesn't exist in header")
-	}
-	if l, ok := header["location"]; ok {
-		fmt.Printf("location from header:\n")
-		for i, e := range l {
-			fmt.Printf(" %d. %s\n", i, e)
-		}
-	} else {
-		log.Fatal("location expected but doesn't exist in header")
-	}
+	printMD(header, "timestamp", "header")
+	printMD(header, "location", "header")
 
 	// Read all the responses.
 	var rpcStatus error
@@ -125,35 +103,23 @@ func serverStreamingWithMetadata(c pb.EchoClient, message string) {
 			rpcStatus = err
 			break
 		}
-		fmt.Printf(" - %s\n", r.Message)
+		fmt.Printf(" - %v\n", r)
 	}
 	if rpcStatus != io.EOF {
 		log.Fatalf("failed to finish server streaming: %v", rpcStatus)
 	}
 
 	// Read the trailer after the RPC is finished.
-	trailer := stream.Trailer()
-	// Read metadata from server's trailer.
-	if t, ok := trailer["timestamp"]; ok {
-		fmt.Printf("timestamp from trailer:\n")
-		for i, e := range t {
-			fmt.Printf(" %d. %s\n", i, e)
-		}
-	} else {
-		log.Fatal("timestamp expected but doesn't exist in trailer")
-	}
+	printMD(stream.Trailer(), "timestamp", "trailer")
 }
 
-func clientStreamWithMetadata(c pb.EchoClient, message string) {
+func clientStreamWithMetadata(conn *xrpc.ClientConn, c pb.RouteGuideClient) {
 	fmt.Printf("--- client streaming ---\n")
-	// Create metadata and context.
-	md := metadata.Pairs("timestamp", time.Now().Format(timestampFormat))
-	ctx := metadata.NewOutgoingContext(context.Background(), md)
+	setTimestamp(conn)
 
-	// Make RPC using the context with the metadata.
-	stream, err := c.ClientStreamingEcho(ctx)
+	stream, err := c.RecordRoute(context.Background())
 	if err != nil {
-		log.Fatalf("failed to call ClientStreamingEcho: %v\n", err)
+		log.Fatalf("failed to call RecordRoute: %v\n", err)
 	}
 
 	// Read the header when the header arrives.
@@ -161,27 +127,12 @@ func clientStreamWithMetadata(c pb.EchoClient, message string) {
 	if err != nil {
 		log.Fatalf("failed to get header from stream: %v", err)
 	}
-	// Read metadata from server's header.
-	if t, ok := header["timestamp"]; ok {
-		fmt.Printf("timestamp from header:\n")
-		for i, e := range t {
-			fmt.Printf(" %d. %s\n", i, e)
-		}
-	} else {
-		log.Fatal("timestamp expected but doesn't exist in header")
-	}
-	if l, ok := header["location"]; ok {
-		fmt.Printf("location from header:\n")
-		for i, e := range l {
-			fmt.Printf(" %d. %s\n", i, e)
-		}
-	} else {
-		log.Fatal("location expected but doesn't exist in header")
-	}
+	printMD(header, "timestamp", "header")
+	printMD(header, "location", "header")
 
 	// Send all requests to the server.
 	for i := 0; i < streamingCount; i++ {
-		if err := stream.Send(&pb.EchoRequest{Message: message}); err != nil {
+		if err := stream.Send(&pb.Point{Latitude: int32(i), Longitude: int32(i)}); err != nil {
 			log.Fatalf("failed to send streaming: %v\n", err)
 		}
 	}
@@ -192,31 +143,19 @@ func clientStreamWithMetadata(c pb.EchoClient, message string) {
 		log.Fatalf("failed to CloseAndRecv: %v\n", err)
 	}
 	fmt.Printf("response:\n")
-	fmt.Printf(" - %s\n\n", r.Message)
+	fmt.Printf(" - %v\n\n", r)
 
 	// Read the trailer after the RPC is finished.
-	trailer := stream.Trailer()
-	// Read metadata from server's trailer.
-	if t, ok := trailer["timestamp"]; ok {
-		fmt.Printf("timestamp from trailer:\n")
-		for i, e := range t {
-			fmt.Printf(" %d. %s\n", i, e)
-		}
-	} else {
-		log.Fatal("timestamp expected but doesn't exist in trailer")
-	}
+	printMD(stream.Trailer(), "timestamp", "trailer")
 }
 
-func bidirectionalWithMetadata(c pb.EchoClient, message string) {
+func bidirectionalWithMetadata(conn *xrpc.ClientConn, c pb.RouteGuideClient) {
 	fmt.Printf("--- bidirectional ---\n")
-	// Create metadata and context.
-	md := metadata.Pairs("timestamp", time.Now().Format(timestampFormat))
-	ctx := metadata.NewOutgoingContext(context.Background(), md)
+	setTimestamp(conn)
 
-	// Make RPC using the context with the metadata.
-	stream, err := c.BidirectionalStreamingEcho(ctx)
+	stream, err := c.RouteChat(context.Background())
 	if err != nil {
-		log.Fatalf("failed to call BidirectionalStreamingEcho: %v\n", err)
+		log.Fatalf("failed to call RouteChat: %v\n", err)
 	}
 
 	go func() {
@@ -225,27 +164,12 @@ func bidirectionalWithMetadata(c pb.EchoClient, message string) {
 		if err != nil {
 			log.Fatalf("failed to get header from stream: %v", err)
 		}
-		// Read metadata from server's header.
-		if t, ok := header["timestamp"]; ok {
-			fmt.Printf("timestamp from header:\n")
-			for i, e := range t {
-				fmt.Printf(" %d. %s\n", i, e)
-			}
-		} else {
-			log.Fatal("timestamp expected but doesn't exist in header")
-		}
-		if l, ok := header["location"]; ok {
-			fmt.Printf("location from header:\n")
-			for i, e := range l {
-				fmt.Printf(" %d. %s\n", i, e)
-			}
-		} else {
-			log.Fatal("location expected but doesn't exist in header")
-		}
+		printMD(header, "timestamp", "header")
+		printMD(header, "location", "header")
 
 		// Send all requests to the server.
 		for i := 0; i < streamingCount; i++ {
-			if err := stream.Send(&pb.EchoRequest{Message: message}); err != nil {
+			if err := stream.Send(&pb.RouteNote{Message: message}); err != nil {
 				log.Fatalf("failed to send streaming: %v\n", err)
 			}
 		}
@@ -264,21 +188,11 @@ func bidirectionalWithMetadata(c pb.EchoClient, message string) {
 		fmt.Printf(" - %s\n", r.Message)
 	}
 	if rpcStatus != io.EOF {
-		log.Fatalf("failed to finish server streaming: %v", rpcStatus)
+		log.Fatalf("failed to finish bidirectional streaming: %v", rpcStatus)
 	}
 
 	// Read the trailer after the RPC is finished.
-	trailer := stream.Trailer()
-	// Read metadata from server's trailer.
-	if t, ok := trailer["timestamp"]; ok {
-		fmt.Printf("timestamp from trailer:\n")
-		for i, e := range t {
-			fmt.Printf(" %d. %s\n", i, e)
-		}
-	} else {
-		log.Fatal("timestamp expected but doesn't exist in trailer")
-	}
-
+	printMD(stream.Trailer(), "timestamp", "trailer")
 }
 
 const message = "this is examples/metadata"
@@ -286,22 +200,22 @@ const message = "this is examples/metadata"
 func main() {
 	flag.Parse()
 	// Set up a connection to the server.
-	conn, err := grpc.Dial(*addr, grpc.WithInsecure(), grpc.WithBlock())
+	conn, err := xrpc.Dial("tcp", *addr, xrpc.WithInsecure())
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
 	defer conn.Close()
 
-	c := pb.NewEchoClient(conn)
+	c := pb.NewRouteGuideClient(conn)
 
-	unaryCallWithMetadata(c, message)
+	unaryCallWithMetadata(conn, c)
 	time.Sleep(1 * time.Second)
 
-	serverStreamingWithMetadata(c, message)
+	serverStreamingWithMetadata(conn, c)
 	time.Sleep(1 * time.Second)
 
-	clientStreamWithMetadata(c, message)
+	clientStreamWithMetadata(conn, c)
 	time.Sleep(1 * time.Second)
 
-	bidirectionalWithMetadata(c, message)
+	bidirectionalWithMetadata(conn, c)
 }
@@ -25,16 +25,15 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"math/rand"
-	"net"
 	"time"
 
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/metadata"
-	"google.golang.org/grpc/status"
+	"x.io/xrpc"
+	_ "x.io/xrpc/pkg/encoding/gzip"
+	_ "x.io/xrpc/pkg/encoding/proto"
+	"x.io/xrpc/pkg/net"
+	"x.io/xrpc/types"
 
-	pb "google.golang.org/grpc/examples/features/proto/echo"
+	pb "x.io/xrpc/protocol/routeguide"
 )
 
 var port = flag.Int("port", 50051, "the port to serve on")
@@ -45,68 +44,59 @@ const (
 )
 
 type server struct {
-	pb.UnimplementedEchoServer
+	pb.UnimplementedRouteGuideServer
 }
 
-func (s *server) UnaryEcho(ctx context.Context, in *pb.EchoRequest) (*pb.EchoResponse, error) {
-	fmt.Printf("--- UnaryEcho ---\n")
-	// Create trailer in defer to record function return time.
-	defer func() {
-		trailer := metadata.Pairs("timestamp", time.Now().Format(timestampFormat))
-		grpc.SetTrailer(ctx, trailer)
-	}()
-
-	// Read metadata from client.
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return nil, status.Errorf(codes.DataLoss, "UnaryEcho: failed to get metadata")
-	}
-	if t, ok := md["timestamp"]; ok {
+// printTimestamp prints the timestamp the client sent with the call, the
+// header args of the client are the cookies of the handler context.
+func printTimestamp(ctx context.Context) {
+	if t := types.GetCookie(ctx, "timestamp"); t != "" {
 		fmt.Printf("timestamp from metadata:\n")
-		for i, e := range t {
-			fmt.Printf(" %d. %s\n", i, e)
-		}
+		fmt.Printf(" 0. %s\n", t)
 	}
+}
+
+func newHeader() types.MD {
+	return types.NewMD(map[string]string{"location": "MTV", "timestamp": time.Now().Format(timestampFormat)})
+}
+
+func newTrailer() types.MD {
+	return types.Pairs("timestamp", time.Now().Format(timestampFormat))
+}
+
+func (s *server) GetFeature(ctx context.Context, in *pb.Point) (*pb.Feature, error) {
+	fmt.Printf("--- GetFeature ---\n")
+	// Create trailer in defer to record function return time.
+	defer xrpc.SetTrailer(ctx, newTrailer())
+
+	printTimestamp(ctx)
 
 	// Create and send header.
-	header := metadata.New(map[string]string{"location": "MTV", "timestamp": time.Now().Format(timestampFormat)})
-	grpc.SendHeader(ctx, header)
+	xrpc.SendHeader(ctx, newHeader())
 
-	fmt.Printf("request received: %v, sending echo\n", in)
+	fmt.Printf("request received: %v, sending feature\n", in)
 
-	return &pb.EchoResponse{Message: in.Message}, nil
+	return &pb.Feature{Name: "metadata", Location: in}, nil
 }
 
-func (s *server) ServerStreamingEcho(in *pb.EchoRequest, stream pb.Echo_ServerStreamingEchoServer) error {
-	fmt.Printf("--- ServerStreamingEcho ---\n")
+func (s *server) ListFeatures(in *pb.Rectangle, stream pb.RouteGuide_ListFeaturesServer) error {
+	fmt.Printf("--- ListFeatures ---\n")
 	// Create trailer in defer to record function return time.
 	defer func() {
-		trailer := metadata.Pairs("timestamp", time.Now().Format(timestampFormat))
-		stream.SetTrailer(trailer)
+		stream.SetTrailer(newTrailer())
 	}()
 
-	// Read metadata from client.
-	md, ok := metadata.FromIncomingContext(stream.Context())
-	if !ok {
-		return status.Errorf(codes.DataLoss, "ServerStreamingEcho: failed to get metadata")
-	}
-	if t, ok := md["timestamp"]; ok {
-		fmt.Printf("timestamp from metadata:\n")
-		for i, e := range t {
-			fmt.Printf(" %d. %s\n", i, e)
-		}
-	}
+	printTimestamp(stream.Context())
 
 	// Create and send header.
-	header := metadata.New(map[string]string{"location": "MTV", "timestamp": time.Now().Format(timestampFormat)})
-	stream.SendHeader(header)
+	stream.SendHeader(newHeader())
 
 	fmt.Printf("request received: %v\n", in)
 
-	// Read requests and send responses.
+	// Send responses.
 	for i := 0; i < streamingCount; i++ {
-		fmt.Printf("echo message %v\n", in.Message)
-		err := stream.Send(&pb.EchoResponse{Message: in.Message})
+		fmt.Printf("send feature %v\n", i)
+		err := stream.Send(&pb.Feature{Name: "metadata", Location: in.Lo})
 		if err != nil {
 			return err
 		}
@@ -114,70 +104,45 @@ func (s *server) ServerStreamingEcho(in *pb.EchoRequest, stream pb.Echo_ServerSt
 	return nil
 }
 
-func (s *server) ClientStreamingEcho(stream pb.Echo_ClientStreamingEchoServer) error {
-	fmt.Printf("--- ClientStreamingEcho ---\n")
+func (s *server) RecordRoute(stream pb.RouteGuide_RecordRouteServer) error {
+	fmt.Printf("--- RecordRoute ---\n")
 	// Create trailer in defer to record function return time.
 	defer func() {
-		trailer := metadata.Pairs("timestamp", time.Now().Format(timestampFormat))
-		stream.SetTrailer(trailer)
+		stream.SetTrailer(newTrailer())
 	}()
 
-	// Read metadata from client.
-	md, ok := metadata.FromIncomingContext(stream.Context())
-	if !ok {
-		return status.Errorf(codes.DataLoss, "ClientStreamingEcho: failed to get metadata")
-	}
-	if t, ok := md["timestamp"]; ok {
-		fmt.Printf("timestamp from metadata:\n")
-		for i, e := range t {
-			fmt.Printf(" %d. %s\n", i, e)
-		}
-	}
+	printTimestamp(stream.Context())
 
 	// Create and send header.
-	header := metadata.New(map[string]string{"location": "MTV", "timestamp": time.Now().Format(timestampFormat)})
-	stream.SendHeader(header)
+	stream.SendHeader(newHeader())
 
-	// Read requests and send responses.
-	var message string
+	// Read requests and send the summary.
+	var count int32
 	for {
 		in, err := stream.Recv()
 		if err == io.EOF {
-			fmt.Printf("echo last received message\n")
-			return stream.SendAndClose(&pb.EchoResponse{Message: message})
+			fmt.Printf("summarize the received points\n")
+			return stream.SendAndClose(&pb.RouteSummary{PointCount: count})
 		}
-		message = in.Message
-		fmt.Printf("request received: %v, building echo\n", in)
 		if err != nil {
 			return err
 		}
+		count++
+		fmt.Printf("request received: %v, building summary\n", in)
 	}
 }
 
-func (s *server) BidirectionalStreamingEcho(stream pb.Echo_BidirectionalStreamingEchoServer) error {
-	fmt.Printf("--- BidirectionalStreamingEcho ---\n")
+func (s *server) RouteChat(stream pb.RouteGuide_RouteChatServer) error {
+	fmt.Printf("--- RouteChat ---\n")
 	// Create trailer in defer to record function return time.
 	defer func() {
-		trailer := metadata.Pairs("timestamp", time.Now().Format(timestampFormat))
-		stream.SetTrailer(trailer)
+		stream.SetTrailer(newTrailer())
 	}()
 
-	// Read metadata from client.
-	md, ok := metadata.FromIncomingContext(stream.Context())
-	if !ok {
-		return status.Errorf(codes.DataLoss, "BidirectionalStreamingEcho: failed to get metadata")
-	}
-
-	if t, ok := md["timestamp"]; ok {
-		fmt.Printf("timestamp from metadata:\n")
-		for i, e := range t {
-			fmt.Printf(" %d. %s\n", i, e)
-		}
-	}
+	printTimestamp(stream.Context())
 
 	// Create and send header.
-	header := metadata.New(map[string]string{"location": "MTV", "timestamp": time.Now().Format(timestampFormat)})
-	stream.SendHeader(header)
+	stream.SendHeader(newHeader())
 
 	// Read requests and send responses.
 	for {
@@ -189,7 +154,7 @@ func (s *server) BidirectionalStreamingEcho(stream pb.Echo_BidirectionalStreamin
 			return err
 		}
 		fmt.Printf("request received %v, sending echo\n", in)
-		if err := stream.Send(&pb.EchoResponse{Message: in.Message}); err != nil {
+		if err := stream.Send(in); err != nil {
 			return err
 		}
 	}
@@ -197,14 +162,13 @@ func (s *server) BidirectionalStreamingEcho(stream pb.Echo_BidirectionalStreamin
 
 func main() {
 	flag.Parse()
-	rand.Seed(time.Now().UnixNano())
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *port))
+	lis, err := net.Listen(context.Background(), "tcp", fmt.Sprintf(":%d", *port))
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
 	fmt.Printf("server listening at %v\n", lis.Addr())
 
-	s := grpc.NewServer()
-	pb.RegisterEchoServer(s, &server{})
+	s := xrpc.NewServer()
+	pb.RegisterRouteGuideServer(s, &server{})
 	s.Serve(lis)
 }
@@ -0,0 +1,53 @@
+// Binary client lists the services of the example server and describes
+// their methods by the reflection service.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"x.io/xrpc"
+	_ "x.io/xrpc/pkg/encoding/gzip"
+	"x.io/xrpc/pkg/reflection"
+)
+
+var addr = flag.String("addr", "localhost:50051", "the address to connect to")
+
+func main() {
+	flag.Parse()
+	rc, err := xrpc.NewRawClient("tcp", *addr, xrpc.WithInsecure(), xrpc.WithJsonCodec())
+	if err != nil {
+		log.Fatalf("did not connect: %v", err)
+	}
+	client := reflection.NewClient(rc)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	names, err := client.ListServices(ctx)
+	if err != nil {
+		log.Fatalf("failed to list the services: %v", err)
+	}
+	for _, name := range names {
+		info, err := client.ServiceInfo(ctx, name)
+		if err != nil {
+			log.Fatalf("failed to describe %s: %v", name, err)
+		}
+		fmt.Printf("service %s\n", name)
+		for _, m := range info.Methods {
+			req, reply := m.ReqName, m.ReplyName
+			if m.IsClientStream {
+				req = "stream " + req
+			}
+			if m.IsServerStream {
+				reply = "stream " + reply
+			}
+			fmt.Printf("  rpc %s(%s) returns (%s)\n", m.Name, req, reply)
+			if m.Req != "" {
+				fmt.Printf("    request schema: %s\n    reply schema: %s\n", m.Req, m.Reply)
+			}
+		}
+	}
+}
@@ -24,52 +24,57 @@ import (
 	"flag"
 	"fmt"
 	"log"
-	"net"
 
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/reflection"
+	"x.io/xrpc"
+	_ "x.io/xrpc/pkg/encoding/gzip"
+	_ "x.io/xrpc/pkg/encoding/proto"
+	"x.io/xrpc/pkg/net"
+	"x.io/xrpc/pkg/reflection"
 
-	ecpb "google.golang.org/grpc/examples/features/proto/echo"
-	hwpb "google.golang.org/grpc/examples/helloworld/helloworld"
+	hwpb "x.io/xrpc/protocol/greeter"
+	rgpb "x.io/xrpc/protocol/routeguide"
 )
 
 var port = flag.Int("port", 50051, "the port to serve on")
 
-// hwServer is used to implement helloworld.GreeterServer.
+// hwServer is used to implement greeter.GreeterServer.
 type hwServer struct {
 	hwpb.UnimplementedGreeterServer
 }
 
-// SayHello implements helloworld.GreeterServer
+// SayHello implements greeter.GreeterServer
 func (s *hwServer) SayHello(ctx context.Context, in *hwpb.HelloRequest) (*hwpb.HelloReply, error) {
 	return &hwpb.HelloReply{Message: "Hello " + in.Name}, nil
 }
 
-type ecServer struct {
-	ecpb.UnimplementedEchoServer
-}
+// calculator is a custom service, its methods are described by json schemas.
+type calculator struct{}
 
-func (s *ecServer) UnaryEcho(ctx context.Context, req *ecpb.EchoRequest) (*ecpb.EchoResponse, error) {
-	return &ecpb.EchoResponse{Message: req.Message}, nil
+func (calculator) Add(a, b int) int {
+	return a + b
 }
 
 func main() {
 	flag.Parse()
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *port))
+	address := fmt.Sprintf(":%d", *port)
+	lis, err := net.Listen(context.Background(), "tcp", address)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
-	fmt.Printf("server listening at %v\n", lis.Addr())
+	fmt.Printf("server listening at %v\n", address)
 
-	s := grpc.NewServer()
+	s := xrpc.NewServer()
 
 	// Register Greeter on the server.
 	hwpb.RegisterGreeterServer(s, &hwServer{})
 
 	// Register RouteGuide on the same server.
-	ecpb.RegisterEchoServer(s, &ecServer{})
+	rgpb.RegisterRouteGuideServer(s, &rgpb.UnimplementedRouteGuideServer{})
+
+	// Register a custom service on the same server.
+	s.RegisterCustomService("calculator", calculator{})
 
-	// Register reflection service on gRPC server.
+	// Register reflection service on xRPC server.
 	reflection.Register(s)
 
 	if err := s.Serve(lis); err != nil {
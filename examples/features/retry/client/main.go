@@ -25,8 +25,10 @@ import (
 	"log"
 	"time"
 
-	"google.golang.org/grpc"
-	pb "google.golang.org/grpc/examples/features/proto/echo"
+	"x.io/xrpc"
+	_ "x.io/xrpc/pkg/encoding/gzip"
+	_ "x.io/xrpc/pkg/encoding/proto"
+	pb "x.io/xrpc/protocol/greeter"
 )
 
 var (
@@ -34,7 +36,7 @@ var (
 	// see https://github.com/grpc/grpc/blob/master/doc/service_config.md to know more about service config
 	retryPolicy = `{
 		"methodConfig": [{
-		  "name": [{"service": "grpc.examples.echo.Echo"}],
+		  "name": [{"service": "greeter.Greeter"}],
 		  "waitForReady": true,
 		  "retryPolicy": {
 			  "MaxAttempts": 4,
@@ -46,9 +48,9 @@ var (
 		}]}`
 )
 
-// use grpc.WithDefaultServiceConfig() to set service config
-func retryDial() (*grpc.ClientConn, error) {
-	return grpc.Dial(*addr, grpc.WithInsecure(), grpc.WithDefaultServiceConfig(retryPolicy))
+// use xrpc.WithDefaultServiceConfig() to set service config
+func retryDial() (*xrpc.ClientConn, error) {
+	return xrpc.Dial("tcp", *addr, xrpc.WithInsecure(), xrpc.WithDefaultServiceConfig(retryPolicy))
 }
 
 func main() {
@@ -65,14 +67,15 @@ func main() {
 		}
 	}()
 
-	c := pb.NewEchoClient(conn)
+	c := pb.NewGreeterClient(conn)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
 
-	reply, err := c.UnaryEcho(ctx, &pb.EchoRequest{Message: "Try and Success"})
+	var attempts int
+	reply, err := c.SayHello(ctx, &pb.HelloRequest{Name: "Try and Success"}, xrpc.Attempts(&attempts))
 	if err != nil {
-		log.Fatalf("UnaryEcho error: %v", err)
+		log.Fatalf("SayHello error: %v", err)
 	}
-	log.Printf("UnaryEcho reply: %v", reply)
+	log.Printf("SayHello reply: %v after %d attempts", reply, attempts)
 }
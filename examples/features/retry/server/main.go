@@ -24,20 +24,22 @@ import (
 	"flag"
 	"fmt"
 	"log"
-	"net"
 	"sync"
 
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"x.io/xrpc"
+	"x.io/xrpc/pkg/codes"
+	_ "x.io/xrpc/pkg/encoding/gzip"
+	_ "x.io/xrpc/pkg/encoding/proto"
+	"x.io/xrpc/pkg/net"
+	"x.io/xrpc/pkg/status"
 
-	pb "google.golang.org/grpc/examples/features/proto/echo"
+	pb "x.io/xrpc/protocol/greeter"
 )
 
 var port = flag.Int("port", 50052, "port number")
 
 type failingServer struct {
-	pb.UnimplementedEchoServer
+	pb.UnimplementedGreeterServer
 	mu sync.Mutex
 
 	reqCounter uint
@@ -57,27 +59,27 @@ func (s *failingServer) maybeFailRequest() error {
 	return status.Errorf(codes.Unavailable, "maybeFailRequest: failing it")
 }
 
-func (s *failingServer) UnaryEcho(ctx context.Context, req *pb.EchoRequest) (*pb.EchoResponse, error) {
+func (s *failingServer) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
 	if err := s.maybeFailRequest(); err != nil {
 		log.Println("request failed count:", s.reqCounter)
 		return nil, err
 	}
 
 	log.Println("request succeeded count:", s.reqCounter)
-	return &pb.EchoResponse{Message: req.Message}, nil
+	return &pb.HelloReply{Message: req.Name}, nil
 }
 
 func main() {
 	flag.Parse()
 
 	address := fmt.Sprintf(":%v", *port)
-	lis, err := net.Listen("tcp", address)
+	lis, err := net.Listen(context.Background(), "tcp", address)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
 	fmt.Println("listen on address", address)
 
-	s := grpc.NewServer()
+	s := xrpc.NewServer()
 
 	// Configure server to pass every fourth RPC;
 	// client is configured to make four attempts.
@@ -86,7 +88,7 @@ func main() {
 		reqModulo:  4,
 	}
 
-	pb.RegisterEchoServer(s, failingservice)
+	pb.RegisterGreeterServer(s, failingservice)
 	if err := s.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
@@ -23,48 +23,56 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"net"
 	"sync"
 	"time"
 
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"x.io/xrpc"
+	"x.io/xrpc/pkg/codes"
+	"x.io/xrpc/pkg/connectivity"
+	_ "x.io/xrpc/pkg/encoding/gzip"
+	_ "x.io/xrpc/pkg/encoding/proto"
+	"x.io/xrpc/pkg/net"
+	"x.io/xrpc/pkg/status"
 
-	pb "google.golang.org/grpc/examples/features/proto/echo"
+	pb "x.io/xrpc/protocol/greeter"
 )
 
-// server is used to implement EchoServer.
+const addr = "localhost:50053"
+
+// server is used to implement GreeterServer.
 type server struct {
-	pb.UnimplementedEchoServer
+	pb.UnimplementedGreeterServer
 }
 
-func (s *server) UnaryEcho(ctx context.Context, req *pb.EchoRequest) (*pb.EchoResponse, error) {
-	return &pb.EchoResponse{Message: req.Message}, nil
+func (s *server) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	return &pb.HelloReply{Message: req.Name}, nil
 }
 
-// serve starts listening with a 2 seconds delay.
-func serve() {
-	lis, err := net.Listen("tcp", ":50053")
+// serve starts serving at addr.
+func serve() *xrpc.Server {
+	lis, err := net.Listen(context.Background(), "tcp", addr)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
-	s := grpc.NewServer()
-	pb.RegisterEchoServer(s, &server{})
-
-	if err := s.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
-	}
+	s := xrpc.NewServer()
+	pb.RegisterGreeterServer(s, &server{})
+	go s.Serve(lis)
+	return s
 }
 
 func main() {
-	conn, err := grpc.Dial("localhost:50053", grpc.WithInsecure())
+	// Dial fails if the server can not be connected at first, so the server
+	// is stopped after dialing and restarted with a 2 seconds delay.
+	s := serve()
+	conn, err := xrpc.Dial("tcp", addr, xrpc.WithInsecure())
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
 	defer conn.Close()
+	s.Stop()
+	conn.WaitForStateChange(context.Background(), connectivity.Ready)
 
-	c := pb.NewEchoClient(conn)
+	c := pb.NewGreeterClient(conn)
 
 	var wg sync.WaitGroup
 	wg.Add(3)
@@ -76,7 +84,7 @@ func main() {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		_, err := c.UnaryEcho(ctx, &pb.EchoRequest{Message: "Hi!"})
+		_, err := c.SayHello(ctx, &pb.HelloRequest{Name: "Hi!"})
 
 		got := status.Code(err)
 		fmt.Printf("[1] wanted = %v, got = %v\n", codes.Unavailable, got)
@@ -89,7 +97,7 @@ func main() {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		_, err := c.UnaryEcho(ctx, &pb.EchoRequest{Message: "Hi!"}, grpc.WaitForReady(true))
+		_, err := c.SayHello(ctx, &pb.HelloRequest{Name: "Hi!"}, xrpc.WaitForReady(true))
 
 		got := status.Code(err)
 		fmt.Printf("[2] wanted = %v, got = %v\n", codes.OK, got)
@@ -103,14 +111,15 @@ func main() {
 		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 		defer cancel()
 
-		_, err := c.UnaryEcho(ctx, &pb.EchoRequest{Message: "Hi!"}, grpc.WaitForReady(true))
+		_, err := c.SayHello(ctx, &pb.HelloRequest{Name: "Hi!"}, xrpc.WaitForReady(true))
 
 		got := status.Code(err)
 		fmt.Printf("[3] wanted = %v, got = %v\n", codes.DeadlineExceeded, got)
 	}()
 
 	time.Sleep(2 * time.Second)
-	go serve()
+	s = serve()
+	defer s.Stop()
 
 	wg.Wait()
 }
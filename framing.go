@@ -0,0 +1,95 @@
+package xrpc
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	stdnet "net"
+	"sync"
+
+	"x.io/xrpc/pkg/codes"
+	"x.io/xrpc/pkg/status"
+	"x.io/xrpc/types"
+)
+
+// maxPooledBufferSize is the capacity beyond which a buffer is not put back
+// to the pool, so that a large message does not pin its memory.
+const maxPooledBufferSize = 1024 * 1024
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new([]byte)
+	},
+}
+
+// getBuffer returns a buffer of length n, it is taken from the pool if the
+// pooled one is large enough.
+func getBuffer(n int) []byte {
+	bp := bufferPool.Get().(*[]byte)
+	if cap(*bp) < n {
+		return make([]byte, n)
+	}
+	return (*bp)[:n]
+}
+
+// putBuffer puts back a buffer returned by getBuffer or recv, b must not be
+// used anymore.
+func putBuffer(b []byte) {
+	if c := cap(b); c == 0 || c > maxPooledBufferSize {
+		return
+	}
+	b = b[:0]
+	bufferPool.Put(&b)
+}
+
+// recv reads a frame from r. The payload is read into a buffer of the pool,
+// the caller puts it back by putBuffer when it is consumed. A frame longer
+// than maxSize fails with ResourceExhausted before it is read, maxSize <= 0
+// means no limit.
+func recv(r io.Reader, maxSize int) (pf types.PayloadFormat, msg []byte, err error) {
+	var hdr [types.HeaderLen]byte
+	if _, err = io.ReadFull(r, hdr[:]); err != nil {
+		// io.EOF between the frames, io.ErrUnexpectedEOF within the header
+		return 0, nil, err
+	}
+	pf = types.PayloadFormat(hdr[0])
+	length := binary.BigEndian.Uint32(hdr[1:])
+	if length == 0 {
+		return pf, nil, nil
+	}
+	if maxSize > 0 && int64(length) > int64(maxSize) {
+		return 0, nil, status.Errorf(codes.ResourceExhausted, "xrpc: received message larger than max (%d vs. %d)", length, maxSize)
+	}
+	msg = getBuffer(int(length))
+	if _, err = io.ReadFull(r, msg); err != nil {
+		putBuffer(msg)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	return pf, msg, nil
+}
+
+// writeFrame writes the header and payload of a frame to w in a single write,
+// so that a frame is never split by the writes of another goroutine. They are
+// written by writev(2) to the TCP and unix sockets of the standard library,
+// the only writers net.Buffers writes at once, and coalesced in a pooled
+// buffer for the other writers, e.g. the smux streams and the pkg/net conns.
+func writeFrame(w io.Writer, hdr, data []byte) (err error) {
+	if uint64(len(data)) > math.MaxUint32 {
+		return status.Errorf(codes.ResourceExhausted, "xrpc: message too large (%d bytes)", len(data))
+	}
+	switch w.(type) {
+	case *stdnet.TCPConn, *stdnet.UnixConn:
+		bufs := stdnet.Buffers{hdr, data}
+		_, err = bufs.WriteTo(w)
+		return
+	}
+	buf := getBuffer(len(hdr) + len(data))
+	copy(buf, hdr)
+	copy(buf[len(hdr):], data)
+	_, err = w.Write(buf)
+	putBuffer(buf)
+	return
+}
@@ -0,0 +1,152 @@
+package xrpc
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"syscall"
+	"testing"
+	"testing/iotest"
+
+	"x.io/xrpc/pkg/codes"
+	"x.io/xrpc/pkg/status"
+	"x.io/xrpc/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testMaxSize = 1024
+
+func encodeFrame(pf types.PayloadFormat, data []byte) []byte {
+	hdr := types.MsgHeader(data, false)
+	hdr[0] = byte(pf)
+	return append(hdr, data...)
+}
+
+// countingWriter counts the calls of Write.
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func (w *countingWriter) count() int {
+	return w.writes
+}
+
+func TestFrameShortReads(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Write(encodeFrame(types.CompressionMade, []byte("hello")))
+	buf.Write(encodeFrame(types.CmdHeader, nil))
+	// the reader returns one byte per Read like a fragmented stream
+	r := iotest.OneByteReader(&buf)
+	pf, msg, err := recv(r, 0)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, types.CompressionMade, pf)
+	assert.Equal(t, []byte("hello"), msg)
+	pf, msg, err = recv(r, 0)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, types.CmdHeader, pf)
+	assert.Equal(t, 0, len(msg))
+	_, _, err = recv(r, 0)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestFrameMalformed(t *testing.T) {
+	frame := encodeFrame(types.CompressionMade, []byte("hello"))
+	for _, test := range []struct {
+		data []byte
+		err  error
+	}{
+		{frame[:3], io.ErrUnexpectedEOF},
+		{frame[:types.HeaderLen], io.ErrUnexpectedEOF},
+		{frame[:len(frame)-1], io.ErrUnexpectedEOF},
+		// a hostile length is refused before the payload is allocated
+		{[]byte{byte(types.CompressionMade), 0xff, 0xff, 0xff, 0xff}, status.Errorf(codes.ResourceExhausted,
+			"xrpc: received message larger than max (%d vs. %d)", uint32(0xffffffff), testMaxSize)},
+	} {
+		_, _, err := recv(bytes.NewReader(test.data), testMaxSize)
+		assert.Equal(t, test.err, err)
+	}
+}
+
+// syscallWriter is a countingWriter which wraps a socket like the pkg/net
+// conns, net.Buffers writes to it one buffer at a time.
+type syscallWriter struct {
+	countingWriter
+}
+
+func (w *syscallWriter) SyscallConn() (syscall.RawConn, error) {
+	return nil, nil
+}
+
+func TestWriteFrame(t *testing.T) {
+	data := []byte("hello")
+	for _, w := range []interface {
+		io.Writer
+		Bytes() []byte
+		count() int
+	}{&countingWriter{}, &syscallWriter{}} {
+		assert.Equal(t, nil, writeFrame(w, types.MsgHeader(data, true), data))
+		assert.Equal(t, 1, w.count())
+		assert.Equal(t, encodeFrame(types.CompressionMade, data), w.Bytes())
+	}
+}
+
+// TestFrameRandom reads the frames of random and mutated inputs, recv fails
+// or returns the frames as they were written.
+func TestFrameRandom(t *testing.T) {
+	seeds := [][]byte{
+		encodeFrame(types.CompressionMade, []byte("hello")),
+		encodeFrame(types.CmdHeader, []byte(`{"Cmd":"close"}`)),
+		{byte(types.MetaHeader), 0, 0, 4, 1},
+		{byte(types.CompressionMade), 0xff, 0xff, 0xff, 0xff, 0},
+	}
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		var data []byte
+		if i%4 == 0 {
+			data = make([]byte, rnd.Intn(2*types.HeaderLen+16))
+			rnd.Read(data)
+		} else {
+			// the seeds are concatenated and some of their bytes replaced
+			for n := 1 + rnd.Intn(3); n > 0; n-- {
+				data = append(data, seeds[rnd.Intn(len(seeds))]...)
+			}
+			for n := rnd.Intn(3); n > 0; n-- {
+				data[rnd.Intn(len(data))] = byte(rnd.Intn(256))
+			}
+			data = data[:rnd.Intn(len(data)+1)]
+		}
+		checkRecv(t, data)
+	}
+}
+
+func checkRecv(t *testing.T, data []byte) {
+	r := bytes.NewReader(data)
+	for {
+		pf, msg, err := recv(r, testMaxSize)
+		if err != nil {
+			return
+		}
+		if len(msg) > testMaxSize {
+			t.Fatalf("recv returned %d bytes, max %d", len(msg), testMaxSize)
+		}
+		// the frame is written back as it was read
+		w := &countingWriter{}
+		hdr := types.MsgHeader(msg, false)
+		hdr[0] = byte(pf)
+		if err = writeFrame(w, hdr, msg); err != nil {
+			t.Fatal(err)
+		}
+		end := len(data) - r.Len()
+		if !bytes.Equal(w.Bytes(), data[end-w.Len():end]) {
+			t.Fatalf("frame %x was read from %x", w.Bytes(), data[:end])
+		}
+		putBuffer(msg)
+	}
+}
@@ -0,0 +1,84 @@
+package xrpc
+
+import (
+	"context"
+
+	"x.io/xrpc/types"
+)
+
+// UnaryInvoker is called by UnaryClientInterceptor to complete RPCs.
+type UnaryInvoker func(ctx context.Context, method string, req, reply interface{}, cc *ClientConn, opts ...CallOption) error
+
+// UnaryClientInterceptor intercepts the execution of a unary RPC on the client.
+// invoker is the handler to complete the RPC and it is the responsibility of
+// the interceptor to call it.
+type UnaryClientInterceptor func(ctx context.Context, method string, req, reply interface{}, cc *ClientConn, invoker UnaryInvoker, opts ...CallOption) error
+
+// Streamer is called by StreamClientInterceptor to create a ClientStream.
+type Streamer func(ctx context.Context, rpc types.Rpc, desc *types.StreamDesc, cc *ClientConn, method string, opts ...CallOption) (types.ClientStream, error)
+
+// StreamClientInterceptor intercepts the creation of a ClientStream. It may
+// return a custom ClientStream to intercept all I/O operations. streamer is
+// the handler to create a ClientStream and it is the responsibility of the
+// interceptor to call it.
+type StreamClientInterceptor func(ctx context.Context, rpc types.Rpc, desc *types.StreamDesc, cc *ClientConn, method string, streamer Streamer, opts ...CallOption) (types.ClientStream, error)
+
+// chainUnaryClientInterceptors chains all unary client interceptors into one,
+// the interceptor set by WithUnaryInterceptor is the outermost one.
+func chainUnaryClientInterceptors(dopts *dialOptions) {
+	interceptors := dopts.chainUnaryInts
+	if dopts.unaryInt != nil {
+		interceptors = append([]UnaryClientInterceptor{dopts.unaryInt}, interceptors...)
+	}
+	var chainedInt UnaryClientInterceptor
+	if len(interceptors) == 0 {
+		chainedInt = nil
+	} else if len(interceptors) == 1 {
+		chainedInt = interceptors[0]
+	} else {
+		chainedInt = func(ctx context.Context, method string, req, reply interface{}, cc *ClientConn, invoker UnaryInvoker, opts ...CallOption) error {
+			return interceptors[0](ctx, method, req, reply, cc, getChainUnaryInvoker(interceptors, 0, invoker), opts...)
+		}
+	}
+	dopts.unaryInt = chainedInt
+}
+
+// getChainUnaryInvoker recursively generates the chained unary invoker.
+func getChainUnaryInvoker(interceptors []UnaryClientInterceptor, curr int, finalInvoker UnaryInvoker) UnaryInvoker {
+	if curr == len(interceptors)-1 {
+		return finalInvoker
+	}
+	return func(ctx context.Context, method string, req, reply interface{}, cc *ClientConn, opts ...CallOption) error {
+		return interceptors[curr+1](ctx, method, req, reply, cc, getChainUnaryInvoker(interceptors, curr+1, finalInvoker), opts...)
+	}
+}
+
+// chainStreamClientInterceptors chains all stream client interceptors into
+// one, the interceptor set by WithStreamInterceptor is the outermost one.
+func chainStreamClientInterceptors(dopts *dialOptions) {
+	interceptors := dopts.chainStreamInts
+	if dopts.streamInt != nil {
+		interceptors = append([]StreamClientInterceptor{dopts.streamInt}, interceptors...)
+	}
+	var chainedInt StreamClientInterceptor
+	if len(interceptors) == 0 {
+		chainedInt = nil
+	} else if len(interceptors) == 1 {
+		chainedInt = interceptors[0]
+	} else {
+		chainedInt = func(ctx context.Context, rpc types.Rpc, desc *types.StreamDesc, cc *ClientConn, method string, streamer Streamer, opts ...CallOption) (types.ClientStream, error) {
+			return interceptors[0](ctx, rpc, desc, cc, method, getChainStreamer(interceptors, 0, streamer), opts...)
+		}
+	}
+	dopts.streamInt = chainedInt
+}
+
+// getChainStreamer recursively generates the chained client stream constructor.
+func getChainStreamer(interceptors []StreamClientInterceptor, curr int, finalStreamer Streamer) Streamer {
+	if curr == len(interceptors)-1 {
+		return finalStreamer
+	}
+	return func(ctx context.Context, rpc types.Rpc, desc *types.StreamDesc, cc *ClientConn, method string, opts ...CallOption) (types.ClientStream, error) {
+		return interceptors[curr+1](ctx, rpc, desc, cc, method, getChainStreamer(interceptors, curr+1, finalStreamer), opts...)
+	}
+}
@@ -42,6 +42,10 @@ var (
 	// call to proto.Clone(). The returned Status proto should not be mutated by
 	// the caller.
 	StatusRawProto interface{} // func (*status.Status) *spb.Status
+	// StatusCode is exported by pkg/status/status.go. This func returns the
+	// code of err and true if err is a status error, it lets pkg/codes
+	// classify the status errors without importing pkg/status.
+	StatusCode func(err error) (uint32, bool)
 	// NewRequestInfoContext creates a new context based on the argument context attaching
 	// the passed in RequestInfo to the new context.
 	NewRequestInfoContext interface{} // func(context.Context, credentials.RequestInfo) context.Context
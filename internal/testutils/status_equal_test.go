@@ -23,8 +23,8 @@ import (
 
 	anypb "github.com/golang/protobuf/ptypes/any"
 	spb "google.golang.org/genproto/googleapis/rpc/status"
-	"google.golang.org/grpc/codes"
 	"x.io/xrpc/internal/grpctest"
+	"x.io/xrpc/pkg/codes"
 	"x.io/xrpc/pkg/status"
 )
 
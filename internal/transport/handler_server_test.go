@@ -34,8 +34,8 @@ import (
 	"github.com/golang/protobuf/proto"
 	dpb "github.com/golang/protobuf/ptypes/duration"
 	epb "google.golang.org/genproto/googleapis/rpc/errdetails"
-	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"x.io/xrpc/pkg/codes"
 	"x.io/xrpc/pkg/status"
 )
 
@@ -33,7 +33,6 @@ import (
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/hpack"
 
-	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/metadata"
@@ -42,6 +41,7 @@ import (
 	"x.io/xrpc/internal"
 	"x.io/xrpc/internal/channelz"
 	"x.io/xrpc/internal/syscall"
+	"x.io/xrpc/pkg/codes"
 	"x.io/xrpc/pkg/status"
 )
 
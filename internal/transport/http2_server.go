@@ -36,7 +36,6 @@ import (
 	"golang.org/x/net/http2/hpack"
 
 	spb "google.golang.org/genproto/googleapis/rpc/status"
-	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/grpclog"
 	"google.golang.org/grpc/keepalive"
@@ -44,6 +43,7 @@ import (
 	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/stats"
 	"google.golang.org/grpc/tap"
+	"x.io/xrpc/pkg/codes"
 
 	"x.io/xrpc/internal"
 	"x.io/xrpc/internal/channelz"
@@ -36,7 +36,7 @@ import (
 
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/hpack"
-	"google.golang.org/grpc/codes"
+	"x.io/xrpc/pkg/codes"
 
 	"x.io/xrpc/internal/grpctest"
 	"x.io/xrpc/internal/leakcheck"
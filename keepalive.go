@@ -0,0 +1,336 @@
+package xrpc
+
+import (
+	"encoding/json"
+	"math/rand"
+	"sync"
+	"time"
+
+	"x.io/xrpc/pkg/keepalive"
+	"x.io/xrpc/pkg/log"
+	"x.io/xrpc/types"
+
+	"github.com/xtaci/smux"
+)
+
+const (
+	defaultKeepaliveTimeout    = 20 * time.Second
+	defaultServerKeepaliveTime = 2 * time.Hour
+	defaultPingMinTime         = 5 * time.Minute
+	// maxPingStrikes is the number of the pings in a row which may break the
+	// EnforcementPolicy before the session is closed.
+	maxPingStrikes = 2
+	// maxControlFrameSize bounds the frames of a control stream.
+	maxControlFrameSize = 4096
+	// drainInterval is how often a draining session checks whether the
+	// client has closed its streams.
+	drainInterval = 10 * time.Millisecond
+
+	// the reasons of the goaways besides keepalive.TooManyPings
+	goAwayIdle     = "idle"
+	goAwayMaxAge   = "max_age"
+	goAwayShutdown = "shutdown"
+)
+
+// controlStream is the stream of a session which carries the keepalive pings
+// and the goaway of the server, the client opens it along with the session.
+type controlStream struct {
+	stream *smux.Stream
+	// mu serializes the commands written to the stream.
+	mu sync.Mutex
+	// pong holds the answer of the last ping.
+	pong chan struct{}
+}
+
+func newControlStream(stream *smux.Stream) *controlStream {
+	return &controlStream{stream: stream, pong: make(chan struct{}, 1)}
+}
+
+// openControlStream opens the control stream of a client session.
+func openControlStream(session *smux.Session) (*controlStream, error) {
+	stream, err := session.OpenStream()
+	if err != nil {
+		return nil, err
+	}
+	c := newControlStream(stream)
+	if err = c.send(types.Control, nil); err != nil {
+		stream.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// send writes the command cmd to the peer.
+func (c *controlStream) send(cmd types.HeaderCmd, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return sendCmd(c.stream, &types.StreamHeader{Cmd: cmd, Payload: payload})
+}
+
+// recv reads the next command of the peer. The answers of the pings are
+// consumed by recv, the pings are answered by the caller.
+func (c *controlStream) recv() (*types.StreamHeader, error) {
+	for {
+		pf, data, err := recv(c.stream, maxControlFrameSize)
+		if err != nil {
+			return nil, err
+		}
+		if pf != types.CmdHeader {
+			putBuffer(data)
+			continue
+		}
+		header := &types.StreamHeader{}
+		err = json.Unmarshal(data, header)
+		putBuffer(data)
+		if err != nil {
+			return nil, err
+		}
+		if header.Cmd != types.Pong {
+			return header, nil
+		}
+		select {
+		case c.pong <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// keepalive pings the peer every interval() until the stream is closed, the
+// session is closed if a ping is not answered within timeout. A ping is
+// skipped if allowed reports false.
+func (c *controlStream) keepalive(session *smux.Session, interval func() time.Duration, timeout time.Duration, allowed func() bool) {
+	done := c.stream.GetDieCh()
+	for {
+		timer := time.NewTimer(interval())
+		select {
+		case <-timer.C:
+		case <-done:
+			timer.Stop()
+			return
+		}
+		if !allowed() {
+			continue
+		}
+		if c.ping(timeout) {
+			continue
+		}
+		select {
+		case <-done:
+		default:
+			log.Debug("xrpc: the keepalive ping timed out, close the session")
+			session.Close()
+		}
+		return
+	}
+}
+
+// ping pings the peer and reports whether the answer came within timeout.
+func (c *controlStream) ping(timeout time.Duration) bool {
+	// drop the late answer of a previous ping
+	select {
+	case <-c.pong:
+	default:
+	}
+	if err := c.send(types.Ping, nil); err != nil {
+		return false
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-c.pong:
+		return true
+	case <-timer.C:
+	case <-c.stream.GetDieCh():
+	}
+	return false
+}
+
+// control serves the control stream of a session of the addrConn. It pings
+// the server by the keepalive parameters of the ClientConn and moves the
+// addrConn off the session on a goaway.
+func (ac *addrConn) control(session *smux.Session, c *controlStream) {
+	cc := ac.cc
+	if kp := cc.dopts.kp; kp.Time > 0 {
+		timeout := kp.Timeout
+		if timeout <= 0 {
+			timeout = defaultKeepaliveTimeout
+		}
+		go c.keepalive(session, cc.keepaliveTime, timeout, func() bool {
+			return kp.PermitWithoutStream || ac.ActiveStreams() > 0
+		})
+	}
+	for {
+		header, err := c.recv()
+		if err != nil {
+			return
+		}
+		switch header.Cmd {
+		case types.Ping:
+			c.send(types.Pong, nil)
+		case types.GoAway:
+			if string(header.Payload) == keepalive.TooManyPings {
+				log.Warnf("xrpc: the server sent a goaway for too many pings, the keepalive time is doubled to %v",
+					cc.backoffKeepalive())
+			}
+			ac.goAway(session)
+		}
+	}
+}
+
+// keepaliveTime returns the interval of the keepalive pings of the ClientConn.
+func (cc *ClientConn) keepaliveTime() time.Duration {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.kpTime
+}
+
+// backoffKeepalive doubles the interval of the keepalive pings after the
+// server complained about too many pings.
+func (cc *ClientConn) backoffKeepalive() time.Duration {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.kpTime *= 2
+	return cc.kpTime
+}
+
+// serverKeepalive keeps a server session alive and bounds its lifetime. It
+// pings the client, enforces the EnforcementPolicy on the pings of the client
+// and drains the session when it is idle or too old.
+type serverKeepalive struct {
+	session *smux.Session
+	streams *sessionStreams
+	kp      keepalive.ServerParameters
+	kep     keepalive.EnforcementPolicy
+	age     *time.Timer
+
+	// mu guards ctl, which is nil until the client opens the control stream.
+	mu  sync.Mutex
+	ctl *controlStream
+}
+
+func (s *Server) newServerKeepalive(session *smux.Session, streams *sessionStreams) *serverKeepalive {
+	ka := &serverKeepalive{
+		session: session,
+		streams: streams,
+		kp:      s.opts.kp,
+		kep:     s.opts.kep,
+	}
+	if ka.kp.Time <= 0 {
+		ka.kp.Time = defaultServerKeepaliveTime
+	}
+	if ka.kp.Timeout <= 0 {
+		ka.kp.Timeout = defaultKeepaliveTimeout
+	}
+	if ka.kep.MinTime <= 0 {
+		ka.kep.MinTime = defaultPingMinTime
+	}
+	if age := ka.kp.MaxConnectionAge; age > 0 {
+		// the jitter of +/-10% spreads the reconnections of the clients
+		age += time.Duration(float64(age) * (rand.Float64() - 0.5) / 5)
+		ka.age = time.AfterFunc(age, func() {
+			ka.drain(goAwayMaxAge, ka.kp.MaxConnectionAgeGrace)
+		})
+	}
+	return ka
+}
+
+// stop stops the timers of the session when it is closed.
+func (ka *serverKeepalive) stop() {
+	if ka.age != nil {
+		ka.age.Stop()
+	}
+}
+
+// serve serves the control stream opened by the client, a session has only
+// one of them.
+func (ka *serverKeepalive) serve(stream *smux.Stream) {
+	c := newControlStream(stream)
+	ka.mu.Lock()
+	if ka.ctl != nil {
+		ka.mu.Unlock()
+		stream.Close()
+		return
+	}
+	ka.ctl = c
+	ka.mu.Unlock()
+	defer stream.Close()
+
+	go c.keepalive(ka.session, func() time.Duration { return ka.kp.Time }, ka.kp.Timeout,
+		func() bool { return true })
+	var lastPing time.Time
+	strikes := 0
+	for {
+		header, err := c.recv()
+		if err != nil {
+			return
+		}
+		if header.Cmd != types.Ping {
+			continue
+		}
+		now := time.Now()
+		if now.Sub(lastPing) < ka.kep.MinTime || !ka.kep.PermitWithoutStream && ka.streams.count() == 0 {
+			strikes++
+		} else {
+			strikes = 0
+		}
+		lastPing = now
+		if strikes > maxPingStrikes {
+			log.Warn("xrpc: the client pings too often, close the session")
+			ka.goAway(keepalive.TooManyPings)
+			ka.session.Close()
+			return
+		}
+		c.send(types.Pong, nil)
+	}
+}
+
+// goAway tells the client to move its new calls to a new session.
+func (ka *serverKeepalive) goAway(reason string) {
+	ka.mu.Lock()
+	c := ka.ctl
+	ka.mu.Unlock()
+	if c != nil {
+		c.send(types.GoAway, []byte(reason))
+	}
+}
+
+// closeIdle drains the session which has been idle for MaxConnectionIdle, the
+// calls sent before the client got the goaway go on for
+// MaxConnectionAgeGrace.
+func (ka *serverKeepalive) closeIdle() {
+	ka.drain(goAwayIdle, ka.kp.MaxConnectionAgeGrace)
+}
+
+// drain sends a goaway with the reason to the session and closes it when the
+// client has closed its streams or the grace elapses, zero grace means no
+// limit.
+func (ka *serverKeepalive) drain(reason string, grace time.Duration) {
+	defer ka.session.Close()
+	log.Debugf("xrpc: drain the server session: %s", reason)
+	ka.goAway(reason)
+	var timeout <-chan time.Time
+	if grace > 0 {
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	// the client answers the ping after it got the goaway, the streams it
+	// opened before have arrived by then, though they may not be accepted yet
+	ka.mu.Lock()
+	c := ka.ctl
+	ka.mu.Unlock()
+	control := 0
+	if c != nil {
+		c.ping(ka.kp.Timeout)
+		control = 1
+	}
+	ticker := time.NewTicker(drainInterval)
+	defer ticker.Stop()
+	for ka.session.NumStreams() > control {
+		select {
+		case <-ticker.C:
+		case <-timeout:
+			return
+		}
+	}
+}
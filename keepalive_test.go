@@ -0,0 +1,131 @@
+package xrpc_test
+
+import (
+	"context"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"x.io/xrpc"
+	"x.io/xrpc/pkg/connectivity"
+	"x.io/xrpc/pkg/keepalive"
+	"x.io/xrpc/pkg/net"
+
+	"github.com/stretchr/testify/assert"
+	greeter_pb "x.io/xrpc/protocol/greeter"
+)
+
+const (
+	strictPingAddr  = "localhost:9908"
+	lenientPingAddr = "localhost:9909"
+	maxAgeAddr      = "localhost:9910"
+	maxIdleAddr     = "localhost:9922"
+
+	maxIdle = 50 * time.Millisecond
+)
+
+var keepaliveOnce sync.Once
+
+func newKeepaliveClient(t *testing.T, addr string, kp keepalive.ClientParameters) (*xrpc.ClientConn, greeter_pb.GreeterClient) {
+	keepaliveOnce.Do(func() {
+		servers := map[string]*xrpc.Server{
+			strictPingAddr: xrpc.NewServer(xrpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+				MinTime: time.Second,
+			})),
+			lenientPingAddr: xrpc.NewServer(xrpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+				MinTime:             10 * time.Millisecond,
+				PermitWithoutStream: true,
+			}), xrpc.KeepaliveParams(keepalive.ServerParameters{
+				Time:    20 * time.Millisecond,
+				Timeout: time.Second,
+			})),
+			maxAgeAddr: xrpc.NewServer(xrpc.KeepaliveParams(keepalive.ServerParameters{
+				MaxConnectionAge:      200 * time.Millisecond,
+				MaxConnectionAgeGrace: 2 * time.Second,
+			})),
+			maxIdleAddr: xrpc.NewServer(xrpc.KeepaliveParams(keepalive.ServerParameters{
+				MaxConnectionIdle:     maxIdle,
+				MaxConnectionAgeGrace: 2 * time.Second,
+			})),
+		}
+		for addr, s := range servers {
+			lis, err := net.Listen(context.Background(), "tcp", addr)
+			if err != nil {
+				log.Fatal(err)
+			}
+			greeter_pb.RegisterGreeterServer(s, &echoGreeter{})
+			go s.Serve(lis)
+		}
+	})
+	conn, err := xrpc.Dial("tcp", addr, xrpc.WithInsecure(), xrpc.WithKeepaliveParams(kp))
+	assert.Equal(t, nil, err)
+	return conn, greeter_pb.NewGreeterClient(conn)
+}
+
+func TestKeepalivePing(t *testing.T) {
+	conn, client := newKeepaliveClient(t, lenientPingAddr, keepalive.ClientParameters{
+		Time:                20 * time.Millisecond,
+		Timeout:             time.Second,
+		PermitWithoutStream: true,
+	})
+	defer conn.Close()
+	// both sides ping and answer, the session lives on
+	tctx, cancel := context.WithTimeout(ctx, 300*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, false, conn.WaitForStateChange(tctx, connectivity.Ready))
+	_, err := client.SayHello(ctx, &greeter_pb.HelloRequest{Name: "ping"})
+	assert.Equal(t, nil, err)
+}
+
+func TestKeepaliveEnforcement(t *testing.T) {
+	conn, _ := newKeepaliveClient(t, strictPingAddr, keepalive.ClientParameters{
+		Time:                20 * time.Millisecond,
+		PermitWithoutStream: true,
+	})
+	defer conn.Close()
+	// the server sends a goaway for too many pings
+	tctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	assert.Equal(t, true, conn.WaitForStateChange(tctx, connectivity.Ready))
+}
+
+func TestKeepaliveWithoutStream(t *testing.T) {
+	conn, _ := newKeepaliveClient(t, strictPingAddr, keepalive.ClientParameters{
+		Time: 20 * time.Millisecond,
+	})
+	defer conn.Close()
+	// the client does not ping without calls
+	tctx, cancel := context.WithTimeout(ctx, 300*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, false, conn.WaitForStateChange(tctx, connectivity.Ready))
+}
+
+func TestMaxConnectionAge(t *testing.T) {
+	conn, client := newKeepaliveClient(t, maxAgeAddr, keepalive.ClientParameters{})
+	defer conn.Close()
+	drained := make(chan bool, 1)
+	go func() {
+		tctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		drained <- conn.WaitForStateChange(tctx, connectivity.Ready)
+	}()
+	// the call in flight finishes on the drained session within the grace
+	_, err := client.SayHello(ctx, &greeter_pb.HelloRequest{Name: "slow"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, <-drained)
+	_, err = client.SayHello(ctx, &greeter_pb.HelloRequest{Name: "age"}, xrpc.WaitForReady(true))
+	assert.Equal(t, nil, err)
+}
+
+func TestMaxConnectionIdle(t *testing.T) {
+	conn, client := newKeepaliveClient(t, maxIdleAddr, keepalive.ClientParameters{})
+	defer conn.Close()
+	// the calls on the cached stream are sent right as the session expires,
+	// they finish on the drained session or go to a new one
+	for i := 0; i < 40; i++ {
+		_, err := client.SayHello(ctx, &greeter_pb.HelloRequest{Name: "idle"}, xrpc.WaitForReady(true))
+		assert.Equal(t, nil, err)
+		time.Sleep(maxIdle - 5*time.Millisecond + time.Duration(i)*time.Millisecond/4)
+	}
+}
@@ -0,0 +1,74 @@
+package xrpc
+
+import (
+	"context"
+	"errors"
+
+	"x.io/xrpc/types"
+)
+
+type serverStreamKey struct{}
+
+type methodKey struct{}
+
+func newContextWithServerStream(ctx context.Context, ss *serverStream) context.Context {
+	return context.WithValue(ctx, serverStreamKey{}, ss)
+}
+
+func serverStreamFromContext(ctx context.Context) (*serverStream, error) {
+	ss, ok := ctx.Value(serverStreamKey{}).(*serverStream)
+	if !ok {
+		return nil, errors.New("xrpc: failed to fetch the stream from the context")
+	}
+	return ss, nil
+}
+
+// Method returns the full method name of the call, from the handler context
+// of the server or the context of the plugins of the client.
+func Method(ctx context.Context) (string, bool) {
+	if method, ok := ctx.Value(methodKey{}).(string); ok {
+		return method, true
+	}
+	ss, err := serverStreamFromContext(ctx)
+	if err != nil {
+		return "", false
+	}
+	return ss.header.FullMethod, true
+}
+
+// SetHeader sets the header metadata of a unary call from the handler, it is
+// sent with the reply or when SendHeader is called.
+func SetHeader(ctx context.Context, md types.MD) error {
+	if md.Len() == 0 {
+		return nil
+	}
+	ss, err := serverStreamFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	return ss.SetHeader(md)
+}
+
+// SendHeader sends the header metadata of a unary call from the handler, it
+// can be called at most once.
+func SendHeader(ctx context.Context, md types.MD) error {
+	ss, err := serverStreamFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	return ss.SendHeader(md)
+}
+
+// SetTrailer sets the trailer metadata of a unary call from the handler, it
+// is sent when the call ends.
+func SetTrailer(ctx context.Context, md types.MD) error {
+	if md.Len() == 0 {
+		return nil
+	}
+	ss, err := serverStreamFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	ss.SetTrailer(md)
+	return nil
+}
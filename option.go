@@ -1,15 +1,51 @@
 package xrpc
 
 import (
+	"math"
 	"time"
 
+	"x.io/xrpc/pkg/balancer"
+	"x.io/xrpc/pkg/credentials"
+	"x.io/xrpc/pkg/keepalive"
 	"x.io/xrpc/pkg/net"
+	"x.io/xrpc/types"
+
+	"github.com/xtaci/smux"
+)
+
+const (
+	defaultClientMaxRecvMsgSize = 1024 * 1024 * 4
+	defaultServerMaxRecvMsgSize = 1024 * 1024 * 4
+	defaultServerMaxSendMsgSize = math.MaxInt32
+	defaultConnectionTimeout    = 120 * time.Second
+	defaultHandshakeTimeout     = 20 * time.Second
+	defaultConnectTimeout       = 20 * time.Second
 )
 
+// options configure a Server. options are set by the ServerOption values
+// passed to NewServer.
 type options struct {
-	writeBufferSize   int
-	readBufferSize    int
-	connectionTimeout time.Duration
+	writeBufferSize      int
+	readBufferSize       int
+	connectionTimeout    time.Duration
+	maxRecvMsgSize       int
+	maxSendMsgSize       int
+	maxConcurrentStreams uint32
+	idleTimeout          time.Duration
+	smuxConfig           *smux.Config
+	kp                   keepalive.ServerParameters
+	kep                  keepalive.EnforcementPolicy
+	creds                credentials.TransportCredentials
+	handshaker           credentials.Handshaker
+}
+
+func defaultServerOptions() *options {
+	return &options{
+		connectionTimeout: defaultConnectionTimeout,
+		maxRecvMsgSize:    defaultServerMaxRecvMsgSize,
+		maxSendMsgSize:    defaultServerMaxSendMsgSize,
+		smuxConfig:        smux.DefaultConfig(),
+	}
 }
 
 type ConnectOptions struct {
@@ -26,11 +62,117 @@ type dialOptions struct {
 	callOptions []CallOption
 	codec       string
 	compressor  string
+	bs          BackoffConfig
+	balancer    balancer.Type
+	sc          serviceConfig
+	scJSON      string
+	// maxRecvMsgSize is the max size of the messages the client can receive.
+	maxRecvMsgSize int
+	kp             keepalive.ClientParameters
+	smuxConfig     *smux.Config
+	creds          credentials.TransportCredentials
+	handshaker     credentials.Handshaker
+	perRPCCreds    []credentials.PerRPCCredentials
+
+	unaryInt        UnaryClientInterceptor
+	streamInt       StreamClientInterceptor
+	chainUnaryInts  []UnaryClientInterceptor
+	chainStreamInts []StreamClientInterceptor
 }
 
 // A ServerOption sets options such as credentials, codec and keepalive parameters, etc.
 type ServerOption func(opts *options)
 
+// MaxRecvMsgSize returns a ServerOption to set the max message size in bytes
+// the server can receive, 4MB by default. The call fails with ResourceExhausted
+// if a message is larger.
+func MaxRecvMsgSize(m int) ServerOption {
+	return func(o *options) {
+		o.maxRecvMsgSize = m
+	}
+}
+
+// MaxSendMsgSize returns a ServerOption to set the max message size in bytes
+// the server can send, math.MaxInt32 by default. The call fails with
+// ResourceExhausted if a message is larger.
+func MaxSendMsgSize(m int) ServerOption {
+	return func(o *options) {
+		o.maxSendMsgSize = m
+	}
+}
+
+// MaxConcurrentStreams returns a ServerOption that limits the number of the
+// open streams of each session, 0 means no limit. The streams beyond the
+// limit are closed with ResourceExhausted.
+func MaxConcurrentStreams(n uint32) ServerOption {
+	return func(o *options) {
+		o.maxConcurrentStreams = n
+	}
+}
+
+// ConnectionTimeout returns a ServerOption that sets the timeout for the
+// connection establishment, which is reading the preface of a new connection,
+// 120 seconds by default. A zero or negative value means no timeout.
+func ConnectionTimeout(d time.Duration) ServerOption {
+	return func(o *options) {
+		o.connectionTimeout = d
+	}
+}
+
+// IdleTimeout returns a ServerOption that closes the sessions which have no
+// open stream for longer than d by a goaway, 0 keeps them. It is the same as
+// the MaxConnectionIdle of KeepaliveParams.
+func IdleTimeout(d time.Duration) ServerOption {
+	return func(o *options) {
+		o.idleTimeout = d
+	}
+}
+
+// KeepaliveParams returns a ServerOption that sets the keepalive parameters
+// and the max idle time and age of the server sessions.
+func KeepaliveParams(kp keepalive.ServerParameters) ServerOption {
+	return func(o *options) {
+		o.kp = kp
+		if kp.MaxConnectionIdle > 0 {
+			o.idleTimeout = kp.MaxConnectionIdle
+		}
+	}
+}
+
+// KeepaliveEnforcementPolicy returns a ServerOption that sets the policy of
+// the server against the clients which ping too often.
+func KeepaliveEnforcementPolicy(kep keepalive.EnforcementPolicy) ServerOption {
+	return func(o *options) {
+		o.kep = kep
+	}
+}
+
+// Creds returns a ServerOption that sets the credentials which secure the
+// connections of the server, e.g. by TLS. The handshake is done within the
+// ConnectionTimeout.
+func Creds(c credentials.TransportCredentials) ServerOption {
+	return func(o *options) {
+		o.creds = c
+	}
+}
+
+// Handshaker returns a ServerOption that sets the handshake done on the
+// connections right after the Preface, e.g. the ECDH handshake of the crypto
+// plugin. The clients must dial with the same handshake by WithHandshaker.
+func Handshaker(h credentials.Handshaker) ServerOption {
+	return func(o *options) {
+		o.handshaker = h
+	}
+}
+
+// SmuxConfig returns a ServerOption that sets the smux configuration of the
+// server sessions, smux.DefaultConfig() by default.
+func SmuxConfig(c *smux.Config) ServerOption {
+	return func(o *options) {
+		o.smuxConfig = c
+	}
+}
+
 type DialOption interface {
 	apply(dopts *dialOptions)
 }
@@ -56,14 +198,145 @@ func WithSnappyCompressor() DialOption {
 }
 
 // WithInsecure returns a DialOption which disables transport security for this
-// ClientConn. Note that transport security is required unless WithInsecure is
-// set.
+// ClientConn explicitly, Dial fails if it is set with WithTransportCredentials.
+// The connections are insecure unless WithTransportCredentials is set.
 func WithInsecure() DialOption {
 	return newFuncDialOption(func(o *dialOptions) {
 		o.insecure = true
 	})
 }
 
+// WithTransportCredentials returns a DialOption which secures the connections
+// of the ClientConn by creds, e.g. by TLS, the handshake is done when each
+// connection is set up.
+func WithTransportCredentials(creds credentials.TransportCredentials) DialOption {
+	return newFuncDialOption(func(o *dialOptions) {
+		o.creds = creds
+	})
+}
+
+// WithHandshaker returns a DialOption which does the handshake h on the
+// connections right after the Preface, the server must use the same
+// handshake.
+func WithHandshaker(h credentials.Handshaker) DialOption {
+	return newFuncDialOption(func(o *dialOptions) {
+		o.handshaker = h
+	})
+}
+
+// WithPerRPCCredentials returns a DialOption which attaches the metadata of
+// creds to the calls, e.g. a bearer token. The metadata is sent when a stream
+// is opened, so the unary calls do not reuse the cached streams and every call
+// is authenticated with the metadata of its own.
+func WithPerRPCCredentials(creds credentials.PerRPCCredentials) DialOption {
+	return newFuncDialOption(func(o *dialOptions) {
+		o.perRPCCreds = append(o.perRPCCreds, creds)
+	})
+}
+
+// WithUnaryInterceptor returns a DialOption that specifies the interceptor for
+// unary RPCs.
+func WithUnaryInterceptor(f UnaryClientInterceptor) DialOption {
+	return newFuncDialOption(func(o *dialOptions) {
+		o.unaryInt = f
+	})
+}
+
+// WithChainUnaryInterceptor returns a DialOption that specifies the chained
+// interceptor for unary RPCs. The first interceptor will be the outer most,
+// while the last interceptor will be the inner most wrapper around the real
+// call. All interceptors added by this method will be chained, and the
+// interceptor defined by WithUnaryInterceptor will always be prepended to
+// the chain.
+func WithChainUnaryInterceptor(interceptors ...UnaryClientInterceptor) DialOption {
+	return newFuncDialOption(func(o *dialOptions) {
+		o.chainUnaryInts = append(o.chainUnaryInts, interceptors...)
+	})
+}
+
+// WithStreamInterceptor returns a DialOption that specifies the interceptor
+// for streaming RPCs.
+func WithStreamInterceptor(f StreamClientInterceptor) DialOption {
+	return newFuncDialOption(func(o *dialOptions) {
+		o.streamInt = f
+	})
+}
+
+// WithChainStreamInterceptor returns a DialOption that specifies the chained
+// interceptor for streaming RPCs. The first interceptor will be the outer
+// most, while the last interceptor will be the inner most wrapper around the
+// real call. All interceptors added by this method will be chained, and the
+// interceptor defined by WithStreamInterceptor will always be prepended to
+// the chain.
+func WithChainStreamInterceptor(interceptors ...StreamClientInterceptor) DialOption {
+	return newFuncDialOption(func(o *dialOptions) {
+		o.chainStreamInts = append(o.chainStreamInts, interceptors...)
+	})
+}
+
+// WithBackoffConfig returns a DialOption which sets the backoff between the
+// attempts to reconnect the ClientConn, DefaultBackoffConfig is used by default.
+func WithBackoffConfig(b BackoffConfig) DialOption {
+	return newFuncDialOption(func(o *dialOptions) {
+		o.bs = b
+	})
+}
+
+// WithBalancer returns a DialOption which sets the load balancing policy
+// among the resolved addresses, balancer.PickFirst is used by default.
+func WithBalancer(t balancer.Type) DialOption {
+	return newFuncDialOption(func(o *dialOptions) {
+		o.balancer = t
+	})
+}
+
+// WithMaxRecvMsgSize returns a DialOption which sets the max message size in
+// bytes the client can receive, 4MB by default. The call fails with
+// ResourceExhausted if a message is larger, a zero or negative value means no
+// limit.
+func WithMaxRecvMsgSize(s int) DialOption {
+	return newFuncDialOption(func(o *dialOptions) {
+		o.maxRecvMsgSize = s
+	})
+}
+
+// WithKeepaliveParams returns a DialOption which sets the keepalive pings of
+// the client, the client does not ping by default.
+func WithKeepaliveParams(kp keepalive.ClientParameters) DialOption {
+	return newFuncDialOption(func(o *dialOptions) {
+		o.kp = kp
+	})
+}
+
+// WithSmuxConfig returns a DialOption which sets the smux configuration of the
+// client sessions, smux.DefaultConfig() by default.
+func WithSmuxConfig(c *smux.Config) DialOption {
+	return newFuncDialOption(func(o *dialOptions) {
+		o.smuxConfig = c
+	})
+}
+
+// WithDefaultServiceConfig returns a DialOption which sets the service config
+// of the ClientConn in the json format of gRPC, Dial fails if it is invalid.
+// The configs of WithMethodConfig take precedence over it.
+func WithDefaultServiceConfig(s string) DialOption {
+	return newFuncDialOption(func(o *dialOptions) {
+		o.scJSON = s
+	})
+}
+
+// WithMethodConfig returns a DialOption which sets the MethodConfig of the
+// calls of name, which is either "service/method", "service" for all the
+// methods of the service or empty for all the methods of the ClientConn.
+func WithMethodConfig(name string, mc MethodConfig) DialOption {
+	return newFuncDialOption(func(o *dialOptions) {
+		if o.sc == nil {
+			o.sc = serviceConfig{}
+		}
+		o.sc[name] = &mc
+	})
+}
+
 // funcDialOption wraps a function that modifies dialOptions into an
 // implementation of the DialOption interface.
 type funcDialOption struct {
@@ -79,3 +352,69 @@ func newFuncDialOption(f func(*dialOptions)) *funcDialOption {
 		f: f,
 	}
 }
+
+// CallOption configures a call before it starts or extracts information from
+// it after it completes.
+type CallOption interface {
+	// before is called before the call is sent to the server.
+	before(*callInfo) error
+	// after is called after the call has completed.
+	after(*callInfo)
+}
+
+// callInfo holds the information of a call which is exposed to the CallOptions.
+type callInfo struct {
+	header   types.MD
+	trailer  types.MD
+	failFast bool
+}
+
+func defaultCallInfo() *callInfo {
+	return &callInfo{failFast: true}
+}
+
+// Header returns a CallOption that retrieves the header metadata of a unary call.
+func Header(md *types.MD) CallOption {
+	return &headerCallOption{headerAddr: md}
+}
+
+type headerCallOption struct {
+	headerAddr *types.MD
+}
+
+func (o *headerCallOption) before(c *callInfo) error { return nil }
+func (o *headerCallOption) after(c *callInfo) {
+	*o.headerAddr = c.header
+}
+
+// Trailer returns a CallOption that retrieves the trailer metadata of a unary call.
+func Trailer(md *types.MD) CallOption {
+	return &trailerCallOption{trailerAddr: md}
+}
+
+type trailerCallOption struct {
+	trailerAddr *types.MD
+}
+
+func (o *trailerCallOption) before(c *callInfo) error { return nil }
+func (o *trailerCallOption) after(c *callInfo) {
+	*o.trailerAddr = c.trailer
+}
+
+// WaitForReady configures the action to take when the ClientConn is not Ready.
+// If waitForReady is false, the call fails immediately with Unavailable, which
+// is the default. If waitForReady is true, the call blocks until the ClientConn
+// is Ready or the context of the call is done.
+func WaitForReady(waitForReady bool) CallOption {
+	return &failFastCallOption{failFast: !waitForReady}
+}
+
+type failFastCallOption struct {
+	failFast bool
+}
+
+func (o *failFastCallOption) before(c *callInfo) error {
+	c.failFast = o.failFast
+	return nil
+}
+func (o *failFastCallOption) after(c *callInfo) {}
@@ -0,0 +1,80 @@
+// Package auth authenticates and authorizes the calls on a server. The
+// authenticators verify the bearer tokens sent in the "authorization"
+// metadata, either HMAC signed tokens or JWTs, and return the Identity of the
+// caller, which the Policy maps to the methods it may call:
+//
+//	s.SetAuthenticator(auth.NewJWT(auth.JWTConfig{Keys: keys}))
+//	s.SetAuthorizer(auth.NewPolicy(map[string][]string{
+//		"admin": {"*"},
+//		"guest": {"/helloworld.Greeter/*"},
+//	}))
+//
+// The identity is in the context of the handlers, see FromContext.
+package auth
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"x.io/xrpc/pkg/codes"
+	"x.io/xrpc/pkg/peer"
+	"x.io/xrpc/pkg/status"
+	"x.io/xrpc/types"
+)
+
+// AuthorizationKey is the metadata key of the bearer tokens.
+const AuthorizationKey = "authorization"
+
+// Request is a call to authenticate.
+type Request struct {
+	// Peer is the peer of the session, its AuthInfo holds e.g. the TLS
+	// certificate chain of the client.
+	Peer *peer.Peer
+	// FullMethod is the method called, "/service/method".
+	FullMethod string
+	// MD is the metadata sent by the client when it opened the stream.
+	MD types.MD
+}
+
+// Identity is the caller authenticated by an authenticator.
+type Identity struct {
+	// Subject is the name of the caller.
+	Subject string
+	// Groups are the groups the caller belongs to.
+	Groups []string
+	// ExpiresAt is the time the identity expires, the calls after it fail
+	// with Unauthenticated. It never expires if zero.
+	ExpiresAt time.Time
+}
+
+// Expired reports whether the identity has expired.
+func (id *Identity) Expired() bool {
+	return id != nil && !id.ExpiresAt.IsZero() && time.Now().After(id.ExpiresAt)
+}
+
+type identityKey struct{}
+
+// NewContext returns a new context which carries the identity id.
+func NewContext(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the identity carried by ctx.
+func FromContext(ctx context.Context) (id *Identity, ok bool) {
+	id, ok = ctx.Value(identityKey{}).(*Identity)
+	return
+}
+
+// BearerToken returns the bearer token in the "authorization" metadata of md.
+func BearerToken(md types.MD) (string, error) {
+	vals := md.Get(AuthorizationKey)
+	if len(vals) == 0 {
+		return "", status.Error(codes.Unauthenticated, "auth: missing the bearer token")
+	}
+	const prefix = "bearer "
+	if len(vals[0]) <= len(prefix) || !strings.EqualFold(vals[0][:len(prefix)], prefix) {
+		return "", status.Error(codes.Unauthenticated, "auth: malformed authorization")
+	}
+	return vals[0][len(prefix):], nil
+}
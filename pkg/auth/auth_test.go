@@ -0,0 +1,133 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"x.io/xrpc/pkg/auth"
+	"x.io/xrpc/pkg/codes"
+	"x.io/xrpc/pkg/status"
+	"x.io/xrpc/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func bearer(token string) *auth.Request {
+	return &auth.Request{FullMethod: "/test.Service/Method", MD: types.Pairs(auth.AuthorizationKey, "Bearer "+token)}
+}
+
+func TestHMAC(t *testing.T) {
+	oldKey, key := []byte("old secret"), []byte("secret")
+	claims := &auth.Claims{Subject: "alice", Groups: []string{"dev"}, ExpiresAt: time.Now().Add(time.Hour).Unix()}
+	token, err := auth.NewHMAC(key).Sign(claims)
+	assert.Equal(t, nil, err)
+	oldToken, err := auth.NewHMAC(oldKey).Sign(claims)
+	assert.Equal(t, nil, err)
+
+	h := auth.NewHMAC(key, oldKey)
+	for _, tk := range []string{token, oldToken} {
+		id, err := h.Authenticate(context.Background(), bearer(tk))
+		assert.Equal(t, nil, err)
+		assert.Equal(t, "alice", id.Subject)
+		assert.Equal(t, []string{"dev"}, id.Groups)
+		assert.Equal(t, false, id.Expired())
+	}
+
+	forged, _ := auth.NewHMAC([]byte("guess")).Sign(claims)
+	expired, _ := h.Sign(&auth.Claims{Subject: "alice", ExpiresAt: time.Now().Add(-time.Second).Unix()})
+	for _, req := range []*auth.Request{bearer(forged), bearer(expired), bearer("alice"), {MD: types.MD{}}} {
+		_, err = h.Authenticate(context.Background(), req)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	}
+}
+
+func TestJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Equal(t, nil, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.Equal(t, nil, err)
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Equal(t, nil, err)
+	j := auth.NewJWT(auth.JWTConfig{
+		Keys: map[string]interface{}{
+			"hs": []byte("secret"),
+			"rs": &rsaKey.PublicKey,
+			"es": &ecKey.PublicKey,
+			"":   edPub,
+		},
+		Issuer:   "issuer",
+		Audience: "xrpc",
+	})
+	claims := &auth.Claims{
+		Subject:   "bob",
+		Issuer:    "issuer",
+		Audience:  auth.Audience{"web", "xrpc"},
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	}
+	for _, k := range []struct {
+		alg, kid string
+		key      interface{}
+	}{
+		{"HS256", "hs", []byte("secret")},
+		{"RS256", "rs", rsaKey},
+		{"ES384", "es", ecKey},
+		{"EdDSA", "", edKey},
+	} {
+		token, err := auth.SignJWT(k.alg, k.kid, k.key, claims)
+		assert.Equal(t, nil, err)
+		id, err := j.Authenticate(context.Background(), bearer(token))
+		assert.Equal(t, nil, err, k.alg)
+		assert.Equal(t, "bob", id.Subject)
+	}
+
+	// the tokens signed by a key of another algorithm, e.g. the RSA public
+	// key used as an HMAC secret, are rejected
+	pub, _ := auth.SignJWT("HS256", "rs", []byte("secret"), claims)
+	_, err = j.Verify(pub)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	for _, c := range []*auth.Claims{
+		{Subject: "bob", Issuer: "other", Audience: auth.Audience{"xrpc"}},
+		{Subject: "bob", Issuer: "issuer", Audience: auth.Audience{"web"}},
+		{Subject: "bob", Issuer: "issuer", Audience: auth.Audience{"xrpc"}, ExpiresAt: time.Now().Add(-time.Minute).Unix()},
+		{Subject: "bob", Issuer: "issuer", Audience: auth.Audience{"xrpc"}, NotBefore: time.Now().Add(time.Minute).Unix()},
+	} {
+		token, err := auth.SignJWT("HS256", "hs", []byte("secret"), c)
+		assert.Equal(t, nil, err)
+		_, err = j.Verify(token)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	p := auth.NewPolicy(map[string][]string{
+		"admin":     {"*"},
+		"alice":     {"/helloworld.Greeter/SayHello"},
+		"group:dev": {"/grpc.health.v1.Health/*"},
+	})
+	for _, c := range []struct {
+		id      *auth.Identity
+		method  string
+		allowed bool
+	}{
+		{&auth.Identity{Subject: "admin"}, "/any.Service/Method", true},
+		{&auth.Identity{Subject: "alice"}, "/helloworld.Greeter/SayHello", true},
+		{&auth.Identity{Subject: "alice"}, "/helloworld.Greeter/SayGoodbye", false},
+		{&auth.Identity{Subject: "bob", Groups: []string{"dev"}}, "/grpc.health.v1.Health/Check", true},
+		{&auth.Identity{Subject: "bob", Groups: []string{"dev"}}, "/grpc.health.v1.HealthCheck/Check", false},
+		{nil, "/helloworld.Greeter/SayHello", false},
+	} {
+		err := p.Authorize(context.Background(), c.id, c.method)
+		if c.allowed {
+			assert.Equal(t, nil, err)
+		} else {
+			assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		}
+	}
+}
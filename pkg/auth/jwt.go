@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	// the hashes of the algorithms
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// JWTConfig configures the verification of the JWTs.
+type JWTConfig struct {
+	// Keys are the keys which verify the tokens by the "kid" of their
+	// header, the tokens without "kid" are verified by the key of "". A key
+	// is a []byte for HS256, HS384 and HS512, an *rsa.PublicKey for RS256,
+	// RS384 and RS512, an *ecdsa.PublicKey for ES256, ES384 and ES512, or an
+	// ed25519.PublicKey for EdDSA.
+	Keys map[string]interface{}
+	// Issuer is the required "iss" claim, it is not checked if empty.
+	Issuer string
+	// Audience is the required value of the "aud" claim, it is not checked
+	// if empty.
+	Audience string
+	// Leeway is the clock skew allowed when checking "exp" and "nbf".
+	Leeway time.Duration
+}
+
+// JWT verifies the JWTs by the local keys.
+type JWT struct {
+	c JWTConfig
+}
+
+// NewJWT returns a JWT which verifies the tokens as configured by c.
+func NewJWT(c JWTConfig) *JWT {
+	return &JWT{c: c}
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// algorithm is a JWS algorithm, the type of its key is checked against it so
+// that e.g. an RSA public key is never used as an HMAC secret.
+type algorithm struct {
+	hash crypto.Hash
+	kind string
+	size int // the size of the ECDSA coordinates
+}
+
+var algorithms = map[string]algorithm{
+	"HS256": {crypto.SHA256, "hmac", 0},
+	"HS384": {crypto.SHA384, "hmac", 0},
+	"HS512": {crypto.SHA512, "hmac", 0},
+	"RS256": {crypto.SHA256, "rsa", 0},
+	"RS384": {crypto.SHA384, "rsa", 0},
+	"RS512": {crypto.SHA512, "rsa", 0},
+	"ES256": {crypto.SHA256, "ecdsa", 32},
+	"ES384": {crypto.SHA384, "ecdsa", 48},
+	"ES512": {crypto.SHA512, "ecdsa", 66},
+	"EdDSA": {0, "ed25519", 0},
+}
+
+// Authenticate verifies the bearer token of req and returns the identity of
+// its subject.
+func (j *JWT) Authenticate(ctx context.Context, req *Request) (*Identity, error) {
+	token, err := BearerToken(req.MD)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := j.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	return claims.identity(), nil
+}
+
+// Verify verifies the signature and the claims of token.
+func (j *JWT) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, unauthenticated("malformed token")
+	}
+	header := &jwtHeader{}
+	if err := decodeSegment(parts[0], header); err != nil {
+		return nil, unauthenticated("malformed token header")
+	}
+	alg, ok := algorithms[header.Alg]
+	if !ok {
+		return nil, unauthenticated(fmt.Sprintf("unsupported algorithm %q", header.Alg))
+	}
+	key, ok := j.c.Keys[header.Kid]
+	if !ok {
+		return nil, unauthenticated(fmt.Sprintf("unknown key %q", header.Kid))
+	}
+	sig, err := b64.DecodeString(parts[2])
+	if err != nil {
+		return nil, unauthenticated("malformed token signature")
+	}
+	if !verify(alg, key, parts[0]+"."+parts[1], sig) {
+		return nil, unauthenticated("invalid token signature")
+	}
+	claims := &Claims{}
+	if err = decodeSegment(parts[1], claims); err != nil {
+		return nil, unauthenticated("malformed token claims")
+	}
+	if err = claims.validate(time.Now(), j.c.Leeway, j.c.Issuer, j.c.Audience); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := b64.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func digest(h crypto.Hash, signed string) []byte {
+	d := h.New()
+	d.Write([]byte(signed))
+	return d.Sum(nil)
+}
+
+// verify reports whether sig is the signature of signed by key, false if the
+// key does not match the algorithm.
+func verify(alg algorithm, key interface{}, signed string, sig []byte) bool {
+	switch k := key.(type) {
+	case []byte:
+		if alg.kind != "hmac" {
+			return false
+		}
+		m := hmac.New(alg.hash.New, k)
+		m.Write([]byte(signed))
+		return hmac.Equal(sig, m.Sum(nil))
+	case *rsa.PublicKey:
+		return alg.kind == "rsa" && rsa.VerifyPKCS1v15(k, alg.hash, digest(alg.hash, signed), sig) == nil
+	case *ecdsa.PublicKey:
+		if alg.kind != "ecdsa" || len(sig) != 2*alg.size {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:alg.size])
+		s := new(big.Int).SetBytes(sig[alg.size:])
+		return ecdsa.Verify(k, digest(alg.hash, signed), r, s)
+	case ed25519.PublicKey:
+		return alg.kind == "ed25519" && ed25519.Verify(k, []byte(signed), sig)
+	}
+	return false
+}
+
+// SignJWT returns the JWT of the claims signed by key with the algorithm alg,
+// kid is put into the header unless it is empty. The key is a []byte, an
+// *rsa.PrivateKey, an *ecdsa.PrivateKey or an ed25519.PrivateKey.
+func SignJWT(alg, kid string, key interface{}, claims *Claims) (string, error) {
+	a, ok := algorithms[alg]
+	if !ok {
+		return "", fmt.Errorf("auth: unsupported algorithm %q", alg)
+	}
+	h, err := json.Marshal(&jwtHeader{Alg: alg, Kid: kid, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := b64.EncodeToString(h) + "." + b64.EncodeToString(c)
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		if a.kind != "hmac" {
+			break
+		}
+		m := hmac.New(a.hash.New, k)
+		m.Write([]byte(signed))
+		sig = m.Sum(nil)
+	case *rsa.PrivateKey:
+		if a.kind != "rsa" {
+			break
+		}
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, a.hash, digest(a.hash, signed))
+	case *ecdsa.PrivateKey:
+		if a.kind != "ecdsa" {
+			break
+		}
+		var r, s *big.Int
+		if r, s, err = ecdsa.Sign(rand.Reader, k, digest(a.hash, signed)); err == nil {
+			// r and s are padded to the size of the coordinates
+			sig = make([]byte, 2*a.size)
+			rb, sb := r.Bytes(), s.Bytes()
+			copy(sig[a.size-len(rb):a.size], rb)
+			copy(sig[2*a.size-len(sb):], sb)
+		}
+	case ed25519.PrivateKey:
+		if a.kind != "ed25519" {
+			break
+		}
+		sig = ed25519.Sign(k, []byte(signed))
+	}
+	if err != nil {
+		return "", err
+	}
+	if sig == nil {
+		return "", errors.New("auth: the key does not match the algorithm " + alg)
+	}
+	return signed + "." + b64.EncodeToString(sig), nil
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"x.io/xrpc/pkg/codes"
+	"x.io/xrpc/pkg/status"
+)
+
+// Policy authorizes the identities to call the methods by their rules.
+type Policy struct {
+	rules map[string][]string
+}
+
+// NewPolicy returns a Policy of the rules, which map a subject, "group:" and
+// a group, or "*" for any authenticated identity, to the methods allowed.
+// A method is a full method "/service/method", all the methods of a service
+// "/service/*", or "*" for all the methods.
+func NewPolicy(rules map[string][]string) *Policy {
+	return &Policy{rules: rules}
+}
+
+// Authorize returns PermissionDenied unless a rule of id allows fullMethod.
+func (p *Policy) Authorize(ctx context.Context, id *Identity, fullMethod string) error {
+	if id != nil && id.Subject != "" {
+		if p.allow(id.Subject, fullMethod) || p.allow("*", fullMethod) {
+			return nil
+		}
+		for _, g := range id.Groups {
+			if p.allow("group:"+g, fullMethod) {
+				return nil
+			}
+		}
+		return status.Errorf(codes.PermissionDenied, "auth: %s is not allowed to call %s", id.Subject, fullMethod)
+	}
+	return status.Errorf(codes.PermissionDenied, "auth: anonymous callers are not allowed to call %s", fullMethod)
+}
+
+func (p *Policy) allow(name, fullMethod string) bool {
+	for _, m := range p.rules[name] {
+		if m == "*" || m == fullMethod {
+			return true
+		}
+		if strings.HasSuffix(m, "/*") && strings.HasPrefix(fullMethod, m[:len(m)-1]) {
+			return true
+		}
+	}
+	return false
+}
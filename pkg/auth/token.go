@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"x.io/xrpc/pkg/codes"
+	"x.io/xrpc/pkg/credentials"
+	"x.io/xrpc/pkg/status"
+)
+
+// Claims are the claims of a token, they are named as the JWT claims.
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Groups    []string `json:"groups,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+}
+
+// Audience is the "aud" claim, which is a string or an array of strings.
+type Audience []string
+
+// UnmarshalJSON decodes a string or an array of strings.
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = Audience{s}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(a))
+}
+
+func (a Audience) contains(aud string) bool {
+	for _, v := range a {
+		if v == aud {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks the time claims at now within leeway, and the issuer and
+// the audience unless they are empty.
+func (c *Claims) validate(now time.Time, leeway time.Duration, issuer, audience string) error {
+	if c.Subject == "" {
+		return unauthenticated("the token has no subject")
+	}
+	if c.ExpiresAt != 0 && now.Add(-leeway).Unix() >= c.ExpiresAt {
+		return unauthenticated("the token has expired")
+	}
+	if c.NotBefore != 0 && now.Add(leeway).Unix() < c.NotBefore {
+		return unauthenticated("the token is not valid yet")
+	}
+	if issuer != "" && c.Issuer != issuer {
+		return unauthenticated("the token has an unknown issuer")
+	}
+	if audience != "" && !c.Audience.contains(audience) {
+		return unauthenticated("the token is not for the audience")
+	}
+	return nil
+}
+
+func (c *Claims) identity() *Identity {
+	id := &Identity{Subject: c.Subject, Groups: c.Groups}
+	if c.ExpiresAt != 0 {
+		id.ExpiresAt = time.Unix(c.ExpiresAt, 0)
+	}
+	return id
+}
+
+func unauthenticated(msg string) error {
+	return status.Error(codes.Unauthenticated, "auth: "+msg)
+}
+
+var b64 = base64.RawURLEncoding
+
+// HMAC signs and verifies the bearer tokens "claims.signature", the
+// base64url encoded JSON claims and their HMAC-SHA256.
+type HMAC struct {
+	keys [][]byte
+}
+
+// NewHMAC returns an HMAC which signs the tokens with the first key and
+// verifies them with any of the keys, so that the keys can be rotated.
+func NewHMAC(key []byte, oldKeys ...[]byte) *HMAC {
+	return &HMAC{keys: append([][]byte{key}, oldKeys...)}
+}
+
+// Sign returns the token of the claims.
+func (h *HMAC) Sign(claims *Claims) (string, error) {
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	payload := b64.EncodeToString(b)
+	return payload + "." + b64.EncodeToString(h.mac(h.keys[0], payload)), nil
+}
+
+func (h *HMAC) mac(key []byte, payload string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(payload))
+	return m.Sum(nil)
+}
+
+// Authenticate verifies the bearer token of req and returns the identity of
+// its subject.
+func (h *HMAC) Authenticate(ctx context.Context, req *Request) (*Identity, error) {
+	token, err := BearerToken(req.MD)
+	if err != nil {
+		return nil, err
+	}
+	i := strings.IndexByte(token, '.')
+	if i < 0 {
+		return nil, unauthenticated("malformed token")
+	}
+	sig, err := b64.DecodeString(token[i+1:])
+	if err != nil {
+		return nil, unauthenticated("malformed token")
+	}
+	valid := false
+	for _, key := range h.keys {
+		if hmac.Equal(sig, h.mac(key, token[:i])) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, unauthenticated("invalid token signature")
+	}
+	b, err := b64.DecodeString(token[:i])
+	if err != nil {
+		return nil, unauthenticated("malformed token")
+	}
+	claims := &Claims{}
+	if err = json.Unmarshal(b, claims); err != nil {
+		return nil, unauthenticated("malformed token claims")
+	}
+	if err = claims.validate(time.Now(), 0, "", ""); err != nil {
+		return nil, err
+	}
+	return claims.identity(), nil
+}
+
+// bearerToken is the PerRPCCredentials of a bearer token.
+type bearerToken struct {
+	token  string
+	secure bool
+}
+
+// NewBearerToken returns the credentials which send token in the
+// "authorization" metadata, the client requires the TransportCredentials if
+// secure is true.
+func NewBearerToken(token string, secure bool) credentials.PerRPCCredentials {
+	return bearerToken{token: token, secure: secure}
+}
+
+func (t bearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{AuthorizationKey: "Bearer " + t.token}, nil
+}
+
+func (t bearerToken) RequireTransportSecurity() bool {
+	return t.secure
+}
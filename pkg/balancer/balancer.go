@@ -1,5 +1,15 @@
+// Package balancer defines the load balancing policies which pick the
+// connection of a call among the ready connections of a ClientConn.
 package balancer
 
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"x.io/xrpc/pkg/resolver"
+)
+
 type Type int
 
 const (
@@ -9,4 +19,104 @@ const (
 	WeightedLeastConn
 	Random
 	IPHash
+	// PickFirst sends all the calls to the first ready address.
+	PickFirst
 )
+
+var typeNames = map[Type]string{
+	Round:             "round",
+	WeightedRound:     "weighted_round",
+	LeastConn:         "least_conn",
+	WeightedLeastConn: "weighted_least_conn",
+	Random:            "random",
+	IPHash:            "ip_hash",
+	PickFirst:         "pick_first",
+}
+
+func (t Type) String() string {
+	if s, ok := typeNames[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("Type(%d)", int(t))
+}
+
+// WeightKey is the key of the weight in the attributes of an address, the
+// weight is 1 if it is absent.
+const WeightKey = "weight"
+
+// ErrNoSubConnAvailable is returned by Pick when no SubConn is ready.
+var ErrNoSubConnAvailable = errors.New("xrpc: no connection is available")
+
+// SubConn is a ready connection of a ClientConn to one of its addresses.
+type SubConn interface {
+	// Address returns the resolved address of the connection.
+	Address() resolver.Address
+	// ActiveStreams returns the number of the calls in flight on the
+	// connection.
+	ActiveStreams() int
+}
+
+// PickInfo is the information of the call a Picker picks a SubConn for.
+type PickInfo struct {
+	// FullMethod is the method of the call, e.g. /service/method.
+	FullMethod string
+	// Ctx is the context of the call.
+	Ctx context.Context
+}
+
+// Picker picks the SubConn of each call. It is rebuilt by the Balancer
+// whenever the ready SubConns change and may be called concurrently.
+type Picker interface {
+	Pick(info PickInfo) (SubConn, error)
+}
+
+// Balancer builds the Pickers of a load balancing policy.
+type Balancer interface {
+	// Build returns a Picker which picks among ready, the ready SubConns in
+	// the order of the resolved addresses.
+	Build(ready []SubConn) Picker
+}
+
+var balancers = map[Type]Balancer{
+	Round:             roundBalancer{},
+	WeightedRound:     weightedRoundBalancer{},
+	LeastConn:         leastConnBalancer{weighted: false},
+	WeightedLeastConn: leastConnBalancer{weighted: true},
+	Random:            randomBalancer{},
+	IPHash:            ipHashBalancer{},
+	PickFirst:         pickFirstBalancer{},
+}
+
+// Get returns the Balancer of the policy t, nil if t is unknown.
+func Get(t Type) Balancer {
+	return balancers[t]
+}
+
+// Weight returns the weight in the attributes of addr. The weight is 1 if
+// it is absent or not a positive number.
+func Weight(addr resolver.Address) int {
+	var w int
+	switch v := addr.Attributes[WeightKey].(type) {
+	case int:
+		w = v
+	case int32:
+		w = int(v)
+	case int64:
+		w = int(v)
+	case uint64:
+		w = int(v)
+	case float64:
+		w = int(v)
+	}
+	if w <= 0 {
+		return 1
+	}
+	return w
+}
+
+// errPicker is the Picker without any ready SubConn.
+type errPicker struct{}
+
+func (errPicker) Pick(PickInfo) (SubConn, error) {
+	return nil, ErrNoSubConnAvailable
+}
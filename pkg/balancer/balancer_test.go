@@ -0,0 +1,117 @@
+package balancer_test
+
+import (
+	"context"
+	"testing"
+
+	"x.io/xrpc/pkg/balancer"
+	"x.io/xrpc/pkg/resolver"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testSubConn struct {
+	addr   resolver.Address
+	active int
+}
+
+func (sc *testSubConn) Address() resolver.Address { return sc.addr }
+func (sc *testSubConn) ActiveStreams() int        { return sc.active }
+
+func newSubConns(weights ...int) []balancer.SubConn {
+	var scs []balancer.SubConn
+	for i, w := range weights {
+		scs = append(scs, &testSubConn{addr: resolver.Address{
+			Addr:       string(rune('a' + i)),
+			Attributes: map[string]interface{}{balancer.WeightKey: w},
+		}})
+	}
+	return scs
+}
+
+// pickN picks n times and counts the picks of each address.
+func pickN(t *testing.T, p balancer.Picker, n int) map[string]int {
+	picks := map[string]int{}
+	for i := 0; i < n; i++ {
+		sc, err := p.Pick(balancer.PickInfo{FullMethod: "/s/m", Ctx: context.Background()})
+		assert.Equal(t, nil, err)
+		picks[sc.Address().Addr]++
+	}
+	return picks
+}
+
+func TestNoSubConn(t *testing.T) {
+	for _, typ := range []balancer.Type{balancer.Round, balancer.WeightedRound, balancer.LeastConn,
+		balancer.WeightedLeastConn, balancer.Random, balancer.IPHash, balancer.PickFirst} {
+		_, err := balancer.Get(typ).Build(nil).Pick(balancer.PickInfo{})
+		assert.Equal(t, balancer.ErrNoSubConnAvailable, err, typ.String())
+	}
+}
+
+func TestRound(t *testing.T) {
+	p := balancer.Get(balancer.Round).Build(newSubConns(1, 5, 1))
+	assert.Equal(t, map[string]int{"a": 3, "b": 3, "c": 3}, pickN(t, p, 9))
+}
+
+func TestWeightedRound(t *testing.T) {
+	p := balancer.Get(balancer.WeightedRound).Build(newSubConns(5, 1, 1))
+	var order string
+	for i := 0; i < 7; i++ {
+		sc, _ := p.Pick(balancer.PickInfo{})
+		order += sc.Address().Addr
+	}
+	// the smooth weighted round-robin spreads the picks of a
+	assert.Equal(t, "aabacaa", order)
+}
+
+func TestLeastConn(t *testing.T) {
+	scs := newSubConns(1, 1, 4)
+	scs[0].(*testSubConn).active = 2
+	scs[1].(*testSubConn).active = 1
+	scs[2].(*testSubConn).active = 3
+	p := balancer.Get(balancer.LeastConn).Build(scs)
+	assert.Equal(t, map[string]int{"b": 10}, pickN(t, p, 10))
+
+	// 3/4 calls per weight on c
+	p = balancer.Get(balancer.WeightedLeastConn).Build(scs)
+	assert.Equal(t, map[string]int{"c": 10}, pickN(t, p, 10))
+}
+
+func TestRandom(t *testing.T) {
+	p := balancer.Get(balancer.Random).Build(newSubConns(1, 1))
+	picks := pickN(t, p, 1000)
+	assert.Equal(t, 2, len(picks))
+	assert.Equal(t, true, picks["a"] > 400 && picks["b"] > 400)
+}
+
+func TestIPHash(t *testing.T) {
+	p := balancer.Get(balancer.IPHash).Build(newSubConns(1, 1, 1))
+	assert.Equal(t, 1, len(pickN(t, p, 10)))
+
+	keys := map[string]bool{}
+	for _, key := range []string{"1.1.1.1", "2.2.2.2", "3.3.3.3", "4.4.4.4", "5.5.5.5", "6.6.6.6"} {
+		ctx := balancer.NewContextWithHashKey(context.Background(), key)
+		sc1, _ := p.Pick(balancer.PickInfo{Ctx: ctx})
+		sc2, _ := p.Pick(balancer.PickInfo{Ctx: ctx})
+		assert.Equal(t, sc1, sc2)
+		keys[sc1.Address().Addr] = true
+	}
+	assert.Equal(t, true, len(keys) > 1)
+}
+
+func TestPickFirst(t *testing.T) {
+	p := balancer.Get(balancer.PickFirst).Build(newSubConns(1, 1))
+	assert.Equal(t, map[string]int{"a": 5}, pickN(t, p, 5))
+}
+
+func TestWeight(t *testing.T) {
+	for _, test := range []struct {
+		v    interface{}
+		want int
+	}{
+		{nil, 1}, {3, 3}, {int64(4), 4}, {float64(2), 2}, {-1, 1}, {"5", 1},
+	} {
+		addr := resolver.Address{Attributes: map[string]interface{}{balancer.WeightKey: test.v}}
+		assert.Equal(t, test.want, balancer.Weight(addr))
+	}
+}
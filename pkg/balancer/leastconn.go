@@ -0,0 +1,51 @@
+package balancer
+
+import (
+	"sync/atomic"
+)
+
+// leastConnBalancer sends a call to the ready SubConn with the fewest calls
+// in flight, or the fewest calls per weight if it is weighted. The ties are
+// broken in turn.
+type leastConnBalancer struct {
+	weighted bool
+}
+
+func (b leastConnBalancer) Build(ready []SubConn) Picker {
+	if len(ready) == 0 {
+		return errPicker{}
+	}
+	p := &leastConnPicker{
+		subConns: ready,
+		weights:  make([]int64, len(ready)),
+	}
+	for i, sc := range ready {
+		p.weights[i] = 1
+		if b.weighted {
+			p.weights[i] = int64(Weight(sc.Address()))
+		}
+	}
+	return p
+}
+
+type leastConnPicker struct {
+	subConns []SubConn
+	weights  []int64
+	next     uint32
+}
+
+func (p *leastConnPicker) Pick(PickInfo) (SubConn, error) {
+	n := uint32(len(p.subConns))
+	start := atomic.AddUint32(&p.next, 1) - 1
+	best := start % n
+	bestActive := int64(p.subConns[best].ActiveStreams())
+	for j := uint32(1); j < n; j++ {
+		i := (start + j) % n
+		active := int64(p.subConns[i].ActiveStreams())
+		// active/weights[i] < bestActive/weights[best]
+		if active*p.weights[best] < bestActive*p.weights[i] {
+			best, bestActive = i, active
+		}
+	}
+	return p.subConns[best], nil
+}
@@ -0,0 +1,82 @@
+package balancer
+
+import (
+	"context"
+	"hash/fnv"
+	"math/rand"
+	"net"
+	"sync"
+)
+
+// randomBalancer sends each call to a random ready SubConn.
+type randomBalancer struct{}
+
+func (randomBalancer) Build(ready []SubConn) Picker {
+	if len(ready) == 0 {
+		return errPicker{}
+	}
+	return randomPicker(ready)
+}
+
+type randomPicker []SubConn
+
+func (p randomPicker) Pick(PickInfo) (SubConn, error) {
+	return p[rand.Intn(len(p))], nil
+}
+
+type hashKey struct{}
+
+// NewContextWithHashKey returns a context whose calls are sent by IPHash to
+// the SubConn of key instead of the SubConn of the ip of the client.
+func NewContextWithHashKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, hashKey{}, key)
+}
+
+var (
+	localIPOnce sync.Once
+	localIP     string
+)
+
+// getLocalIP returns the first non-loopback ip of the host.
+func getLocalIP() string {
+	localIPOnce.Do(func() {
+		addrs, err := net.InterfaceAddrs()
+		if err != nil {
+			return
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
+				localIP = ipNet.IP.String()
+				return
+			}
+		}
+	})
+	return localIP
+}
+
+// ipHashBalancer sends the calls with the same key to the same ready
+// SubConn as long as the ready SubConns do not change. The key is the ip of
+// the client unless the context carries one from NewContextWithHashKey.
+type ipHashBalancer struct{}
+
+func (ipHashBalancer) Build(ready []SubConn) Picker {
+	if len(ready) == 0 {
+		return errPicker{}
+	}
+	return ipHashPicker(ready)
+}
+
+type ipHashPicker []SubConn
+
+func (p ipHashPicker) Pick(info PickInfo) (SubConn, error) {
+	key, ok := "", false
+	if info.Ctx != nil {
+		key, ok = info.Ctx.Value(hashKey{}).(string)
+	}
+	if !ok {
+		key = getLocalIP()
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return p[h.Sum32()%uint32(len(p))], nil
+}
@@ -0,0 +1,94 @@
+package balancer
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+// pickFirstBalancer sends all the calls to the first ready SubConn.
+type pickFirstBalancer struct{}
+
+func (pickFirstBalancer) Build(ready []SubConn) Picker {
+	if len(ready) == 0 {
+		return errPicker{}
+	}
+	return pickFirstPicker{ready[0]}
+}
+
+type pickFirstPicker struct {
+	sc SubConn
+}
+
+func (p pickFirstPicker) Pick(PickInfo) (SubConn, error) {
+	return p.sc, nil
+}
+
+// roundBalancer sends the calls to the ready SubConns in turn, starting from
+// a random one.
+type roundBalancer struct{}
+
+func (roundBalancer) Build(ready []SubConn) Picker {
+	if len(ready) == 0 {
+		return errPicker{}
+	}
+	return &roundPicker{
+		subConns: ready,
+		next:     uint32(rand.Intn(len(ready))),
+	}
+}
+
+type roundPicker struct {
+	subConns []SubConn
+	next     uint32
+}
+
+func (p *roundPicker) Pick(PickInfo) (SubConn, error) {
+	n := atomic.AddUint32(&p.next, 1) - 1
+	return p.subConns[n%uint32(len(p.subConns))], nil
+}
+
+// weightedRoundBalancer sends the calls to the ready SubConns in turn in
+// proportion to their weights. It is the smooth weighted round-robin of
+// nginx, the calls to a heavy SubConn are spread among the others instead of
+// being sent in a burst.
+type weightedRoundBalancer struct{}
+
+func (weightedRoundBalancer) Build(ready []SubConn) Picker {
+	if len(ready) == 0 {
+		return errPicker{}
+	}
+	p := &weightedRoundPicker{
+		subConns: ready,
+		weights:  make([]int, len(ready)),
+		current:  make([]int, len(ready)),
+	}
+	for i, sc := range ready {
+		p.weights[i] = Weight(sc.Address())
+		p.total += p.weights[i]
+	}
+	return p
+}
+
+type weightedRoundPicker struct {
+	subConns []SubConn
+	weights  []int
+	total    int
+
+	mu      sync.Mutex
+	current []int
+}
+
+func (p *weightedRoundPicker) Pick(PickInfo) (SubConn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	best := 0
+	for i, w := range p.weights {
+		p.current[i] += w
+		if p.current[i] > p.current[best] {
+			best = i
+		}
+	}
+	p.current[best] -= p.total
+	return p.subConns[best], nil
+}
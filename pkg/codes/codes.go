@@ -1,33 +1,206 @@
+// Package codes defines the canonical error codes used by xrpc, they are
+// compatible with the gRPC codes and travel in the status of a call.
 package codes
 
 import (
-	"strings"
+	"context"
+	"errors"
+	"strconv"
+
+	"x.io/xrpc/internal"
 )
 
-type Code uint
+// A Code is an unsigned 32-bit error code as defined in the gRPC spec.
+type Code uint32
 
 const (
-	Unimplemented Code = iota
+	// OK is returned on success.
+	OK Code = 0
+
+	// Canceled indicates the operation was canceled (typically by the caller).
+	Canceled Code = 1
+
+	// Unknown error, e.g. an error returned by a handler which does not carry
+	// a status.
+	Unknown Code = 2
+
+	// InvalidArgument indicates client specified an invalid argument.
+	InvalidArgument Code = 3
+
+	// DeadlineExceeded means operation expired before completion.
+	DeadlineExceeded Code = 4
+
+	// NotFound means some requested entity was not found.
+	NotFound Code = 5
+
+	// AlreadyExists means an attempt to create an entity failed because one
+	// already exists.
+	AlreadyExists Code = 6
+
+	// PermissionDenied indicates the caller does not have permission to
+	// execute the specified operation.
+	PermissionDenied Code = 7
+
+	// ResourceExhausted indicates some resource has been exhausted, perhaps
+	// a per-user quota, or perhaps the entire file system is out of space.
+	ResourceExhausted Code = 8
 
-	Ok
-	ServerError
-	Unknown
+	// FailedPrecondition indicates operation was rejected because the
+	// system is not in a state required for the operation's execution.
+	FailedPrecondition Code = 9
+
+	// Aborted indicates the operation was aborted, typically due to a
+	// concurrency issue like sequencer check failures, transaction aborts.
+	Aborted Code = 10
+
+	// OutOfRange means operation was attempted past the valid range.
+	OutOfRange Code = 11
+
+	// Unimplemented indicates operation is not implemented or not
+	// supported/enabled in this service.
+	Unimplemented Code = 12
+
+	// Internal errors. Means some invariants expected by underlying system
+	// has been broken.
+	Internal Code = 13
+
+	// Unavailable indicates the service is currently unavailable, it is
+	// most likely a transient condition which can be corrected by retrying.
+	Unavailable Code = 14
+
+	// DataLoss indicates unrecoverable data loss or corruption.
+	DataLoss Code = 15
+
+	// Unauthenticated indicates the request does not have valid
+	// authentication credentials for the operation.
+	Unauthenticated Code = 16
+
+	_maxCode = 17
 )
 
-func ErrorClass(err error) string {
-	if err == nil {
-		return "ok"
+var strToCode = map[string]Code{
+	"OK":                  OK,
+	"CANCELLED":           Canceled,
+	"UNKNOWN":             Unknown,
+	"INVALID_ARGUMENT":    InvalidArgument,
+	"DEADLINE_EXCEEDED":   DeadlineExceeded,
+	"NOT_FOUND":           NotFound,
+	"ALREADY_EXISTS":      AlreadyExists,
+	"PERMISSION_DENIED":   PermissionDenied,
+	"RESOURCE_EXHAUSTED":  ResourceExhausted,
+	"FAILED_PRECONDITION": FailedPrecondition,
+	"ABORTED":             Aborted,
+	"OUT_OF_RANGE":        OutOfRange,
+	"UNIMPLEMENTED":       Unimplemented,
+	"INTERNAL":            Internal,
+	"UNAVAILABLE":         Unavailable,
+	"DATA_LOSS":           DataLoss,
+	"UNAUTHENTICATED":     Unauthenticated,
+}
+
+func (c Code) String() string {
+	switch c {
+	case OK:
+		return "OK"
+	case Canceled:
+		return "Canceled"
+	case Unknown:
+		return "Unknown"
+	case InvalidArgument:
+		return "InvalidArgument"
+	case DeadlineExceeded:
+		return "DeadlineExceeded"
+	case NotFound:
+		return "NotFound"
+	case AlreadyExists:
+		return "AlreadyExists"
+	case PermissionDenied:
+		return "PermissionDenied"
+	case ResourceExhausted:
+		return "ResourceExhausted"
+	case FailedPrecondition:
+		return "FailedPrecondition"
+	case Aborted:
+		return "Aborted"
+	case OutOfRange:
+		return "OutOfRange"
+	case Unimplemented:
+		return "Unimplemented"
+	case Internal:
+		return "Internal"
+	case Unavailable:
+		return "Unavailable"
+	case DataLoss:
+		return "DataLoss"
+	case Unauthenticated:
+		return "Unauthenticated"
+	default:
+		return "Code(" + strconv.FormatInt(int64(c), 10) + ")"
 	}
+}
 
-	return "unknown"
+// UnmarshalJSON unmarshals b into the Code, b is either the number of the
+// code or its name in the gRPC spec, e.g. "UNAVAILABLE".
+func (c *Code) UnmarshalJSON(b []byte) error {
+	if c == nil {
+		return errors.New("nil receiver passed to UnmarshalJSON")
+	}
+	if n, err := strconv.ParseUint(string(b), 10, 32); err == nil {
+		if n >= _maxCode {
+			return errors.New("invalid code: " + string(b))
+		}
+		*c = Code(n)
+		return nil
+	}
+	if s, err := strconv.Unquote(string(b)); err == nil {
+		if code, ok := strToCode[s]; ok {
+			*c = code
+			return nil
+		}
+	}
+	return errors.New("invalid code: " + string(b))
 }
 
+// ServerError reports whether the code blames the server rather than the
+// caller, such calls are marked as failed by tracing and counted as errors.
+func (c Code) ServerError() bool {
+	switch c {
+	case Unknown, DeadlineExceeded, Unimplemented, Internal, Unavailable, DataLoss:
+		return true
+	}
+	return false
+}
+
+// ErrorCode returns the code of err. The status errors return their code, context errors map to Canceled and
+// DeadlineExceeded, nil is OK and the other errors are Unknown.
 func ErrorCode(err error) Code {
 	if err == nil {
-		return Ok
+		return OK
 	}
-	if strings.Contains(err.Error(), "server") {
-		return ServerError
+	if internal.StatusCode != nil {
+		if c, ok := internal.StatusCode(err); ok {
+			return Code(c)
+		}
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return DeadlineExceeded
 	}
 	return Unknown
 }
+
+// ErrorClass returns the class of err used as the label of the metrics: "ok"
+// for nil, "unknown" for the errors without a code and the name of the code
+// otherwise, so the existing "ok" and "unknown" series keep their labels.
+func ErrorClass(err error) string {
+	switch c := ErrorCode(err); c {
+	case OK:
+		return "ok"
+	case Unknown:
+		return "unknown"
+	default:
+		return c.String()
+	}
+}
@@ -0,0 +1,45 @@
+package codes_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"x.io/xrpc/pkg/codes"
+	"x.io/xrpc/pkg/status"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorCode(t *testing.T) {
+	assert.Equal(t, codes.OK, codes.ErrorCode(nil))
+	assert.Equal(t, codes.Canceled, codes.ErrorCode(context.Canceled))
+	assert.Equal(t, codes.DeadlineExceeded, codes.ErrorCode(fmt.Errorf("call: %w", context.DeadlineExceeded)))
+	assert.Equal(t, codes.NotFound, codes.ErrorCode(status.Error(codes.NotFound, "not found")))
+	assert.Equal(t, codes.NotFound, codes.ErrorCode(fmt.Errorf("lookup: %w", status.Error(codes.NotFound, "not found"))))
+	assert.Equal(t, codes.Unknown, codes.ErrorCode(errors.New("server failed")))
+}
+
+func TestErrorClass(t *testing.T) {
+	assert.Equal(t, "ok", codes.ErrorClass(nil))
+	assert.Equal(t, "unknown", codes.ErrorClass(errors.New("server failed")))
+	assert.Equal(t, "ResourceExhausted", codes.ErrorClass(status.Error(codes.ResourceExhausted, "")))
+	assert.Equal(t, "Code(17)", codes.Code(17).String())
+}
+
+func TestServerError(t *testing.T) {
+	assert.Equal(t, true, codes.Internal.ServerError())
+	assert.Equal(t, true, codes.Unavailable.ServerError())
+	assert.Equal(t, false, codes.InvalidArgument.ServerError())
+	assert.Equal(t, false, codes.OK.ServerError())
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	var c codes.Code
+	assert.Equal(t, nil, c.UnmarshalJSON([]byte(`"UNAVAILABLE"`)))
+	assert.Equal(t, codes.Unavailable, c)
+	assert.Equal(t, nil, c.UnmarshalJSON([]byte(`5`)))
+	assert.Equal(t, codes.NotFound, c)
+	assert.NotEqual(t, nil, c.UnmarshalJSON([]byte(`17`)))
+}
@@ -0,0 +1,62 @@
+// Package credentials defines the transport credentials which secure the
+// connections of the clients and servers, e.g. TLS or mutual TLS:
+//
+//	creds, err := credentials.NewServerTLSFromFile("server.crt", "server.key")
+//	s := xrpc.NewServer(xrpc.Creds(creds))
+//
+//	creds, err := credentials.NewClientTLSFromFile("ca.crt", "")
+//	cc, err := xrpc.Dial("tcp", addr, xrpc.WithTransportCredentials(creds))
+//
+// The handshake is done on the connection before the session is set up, so
+// it works over any stream network, tcp, unix or kcp.
+package credentials
+
+import (
+	"context"
+	"net"
+)
+
+// AuthInfo is the information of the peer authenticated by the handshake.
+type AuthInfo interface {
+	// AuthType returns the type of the credentials, e.g. "tls".
+	AuthType() string
+}
+
+// TransportCredentials secure the connections by a handshake.
+type TransportCredentials interface {
+	// ClientHandshake does the handshake of the client on conn with the
+	// server of authority, which is the address dialed. It returns the
+	// secure connection and the AuthInfo of the server, the handshake fails
+	// after the deadline of ctx.
+	ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, AuthInfo, error)
+	// ServerHandshake does the handshake of the server on conn. It returns
+	// the secure connection and the AuthInfo of the client.
+	ServerHandshake(conn net.Conn) (net.Conn, AuthInfo, error)
+	// Clone returns a copy of the credentials.
+	Clone() TransportCredentials
+	// OverrideServerName overrides the name of the server which is verified
+	// by the client, the authority is used by default.
+	OverrideServerName(serverName string) error
+}
+
+// PerRPCCredentials attach the credentials, e.g. a bearer token, to the
+// metadata sent when a stream is opened.
+type PerRPCCredentials interface {
+	// GetRequestMetadata returns the metadata of the call of the method uri,
+	// the call fails with Unauthenticated if it returns an error.
+	GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error)
+	// RequireTransportSecurity reports whether the credentials are only sent
+	// over the connections secured by the TransportCredentials.
+	RequireTransportSecurity() bool
+}
+
+// Handshaker does a handshake on a connection right after the Preface, before
+// the session is set up over it, e.g. to agree on the keys of the session.
+type Handshaker interface {
+	// ClientHandshake does the handshake of the client on conn and returns
+	// the information of the server, it fails after the deadline of ctx.
+	ClientHandshake(ctx context.Context, conn net.Conn) (AuthInfo, error)
+	// ServerHandshake does the handshake of the server on conn and returns
+	// the information of the client.
+	ServerHandshake(conn net.Conn) (AuthInfo, error)
+}
@@ -0,0 +1,139 @@
+package credentials
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+)
+
+// TLSInfo is the AuthInfo of a TLS peer, the certificate chain of the peer
+// and its SANs are in State.PeerCertificates.
+type TLSInfo struct {
+	State tls.ConnectionState
+}
+
+// AuthType returns "tls".
+func (t TLSInfo) AuthType() string {
+	return "tls"
+}
+
+// tlsCreds is the credentials based on TLS.
+type tlsCreds struct {
+	config *tls.Config
+}
+
+// NewTLS returns the credentials based on the TLS config c. The server
+// requires and verifies the certificates of the clients, which is mutual
+// TLS, if c.ClientAuth is tls.RequireAndVerifyClientCert and c.ClientCAs is
+// set. The client presents c.Certificates to such a server.
+func NewTLS(c *tls.Config) TransportCredentials {
+	return &tlsCreds{config: cloneTLSConfig(c)}
+}
+
+// NewClientTLSFromCert returns the credentials of a client which verifies
+// the servers by the roots cp, the roots of the host are used if cp is nil.
+// serverNameOverride overrides the name of the server which is verified.
+func NewClientTLSFromCert(cp *x509.CertPool, serverNameOverride string) TransportCredentials {
+	return NewTLS(&tls.Config{ServerName: serverNameOverride, RootCAs: cp})
+}
+
+// NewClientTLSFromFile returns the credentials of a client which verifies the
+// servers by the PEM encoded roots in certFile.
+func NewClientTLSFromFile(certFile, serverNameOverride string) (TransportCredentials, error) {
+	b, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	cp := x509.NewCertPool()
+	if !cp.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("credentials: failed to append the certificates of %s", certFile)
+	}
+	return NewClientTLSFromCert(cp, serverNameOverride), nil
+}
+
+// NewServerTLSFromCert returns the credentials of a server which presents the
+// certificate cert.
+func NewServerTLSFromCert(cert *tls.Certificate) TransportCredentials {
+	return NewTLS(&tls.Config{Certificates: []tls.Certificate{*cert}})
+}
+
+// NewServerTLSFromFile returns the credentials of a server which presents the
+// PEM encoded certificate and key of certFile and keyFile.
+func NewServerTLSFromFile(certFile, keyFile string) (TransportCredentials, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return NewServerTLSFromCert(&cert), nil
+}
+
+func (c *tlsCreds) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, AuthInfo, error) {
+	cfg := cloneTLSConfig(c.config)
+	if cfg.ServerName == "" {
+		serverName, _, err := net.SplitHostPort(authority)
+		if err != nil {
+			// the authority has no port, e.g. a unix socket
+			serverName = authority
+		}
+		cfg.ServerName = serverName
+	}
+	conn := tls.Client(rawConn, cfg)
+	if err := handshake(ctx, conn); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, TLSInfo{State: conn.ConnectionState()}, nil
+}
+
+func (c *tlsCreds) ServerHandshake(rawConn net.Conn) (net.Conn, AuthInfo, error) {
+	conn := tls.Server(rawConn, c.config)
+	if err := conn.Handshake(); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, TLSInfo{State: conn.ConnectionState()}, nil
+}
+
+func (c *tlsCreds) Clone() TransportCredentials {
+	return NewTLS(c.config)
+}
+
+func (c *tlsCreds) OverrideServerName(serverName string) error {
+	c.config.ServerName = serverName
+	return nil
+}
+
+// handshake does the handshake of conn within the deadline of ctx.
+func handshake(ctx context.Context, conn *tls.Conn) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	return conn.Handshake()
+}
+
+func cloneTLSConfig(c *tls.Config) *tls.Config {
+	if c == nil {
+		return &tls.Config{}
+	}
+	return c.Clone()
+}
+
+// ErrNoPeerCertificate is returned by PeerCertificate if the peer has not
+// presented a certificate.
+var ErrNoPeerCertificate = errors.New("credentials: the peer has no certificate")
+
+// PeerCertificate returns the leaf certificate of a TLS peer, whose SANs are
+// in DNSNames, IPAddresses, EmailAddresses and URIs.
+func PeerCertificate(info AuthInfo) (*x509.Certificate, error) {
+	t, ok := info.(TLSInfo)
+	if !ok || len(t.State.PeerCertificates) == 0 {
+		return nil, ErrNoPeerCertificate
+	}
+	return t.State.PeerCertificates[0], nil
+}
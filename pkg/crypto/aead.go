@@ -0,0 +1,80 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// ErrCiphertextTooShort is returned by AEADEncryptor.Open if the data is
+// shorter than the nonce and the tag.
+var ErrCiphertextTooShort = errors.New("ciphertext is too short")
+
+// AEADEncryptor encrypts and authenticates the data by an AEAD with a random
+// nonce, which is prepended to the ciphertext.
+type AEADEncryptor struct {
+	newAEAD func(key []byte) (cipher.AEAD, error)
+}
+
+var (
+	_ EncoderPolicy = (*AEADEncryptor)(nil)
+)
+
+// NewGCMEncryptor returns an AEADEncryptor of AES-GCM, the key is 16, 24 or
+// 32 bytes.
+func NewGCMEncryptor() *AEADEncryptor {
+	return &AEADEncryptor{newAEAD: func(key []byte) (cipher.AEAD, error) {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	}}
+}
+
+// NewChaCha20Poly1305Encryptor returns an AEADEncryptor of
+// ChaCha20-Poly1305, the key is 32 bytes.
+func NewChaCha20Poly1305Encryptor() *AEADEncryptor {
+	return &AEADEncryptor{newAEAD: chacha20poly1305.New}
+}
+
+// Encrypt returns the nonce and the ciphertext of data.
+func (e *AEADEncryptor) Encrypt(data, key []byte) ([]byte, error) {
+	return e.Seal(data, key, nil)
+}
+
+// Decrypt returns the data of the nonce and the ciphertext, it fails if they
+// have been tampered with.
+func (e *AEADEncryptor) Decrypt(data, key []byte) ([]byte, error) {
+	return e.Open(data, key, nil)
+}
+
+// Seal encrypts data and authenticates it with additionalData, which is not
+// encrypted.
+func (e *AEADEncryptor) Seal(data, key, additionalData []byte) ([]byte, error) {
+	aead, err := e.newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, additionalData), nil
+}
+
+// Open decrypts the data sealed with additionalData.
+func (e *AEADEncryptor) Open(data, key, additionalData []byte) ([]byte, error) {
+	aead, err := e.newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrCiphertextTooShort
+	}
+	nonce := data[:aead.NonceSize()]
+	return aead.Open(nil, nonce, data[aead.NonceSize():], additionalData)
+}
@@ -21,6 +21,13 @@ func NewRsaEncryptor() *RsaEncryptor {
 	return &RsaEncryptor{}
 }
 
+// ErrInvalidPadding is returned by AesEncryptor.Decrypt if the data is not
+// padded blocks.
+var ErrInvalidPadding = errors.New("invalid padding")
+
+// AesEncryptor is AES-CBC with the key as the IV and without a MAC, the same
+// data has the same ciphertext and the tampering is not detected. It is kept
+// for the compatibility, use AEADEncryptor instead.
 type AesEncryptor struct{}
 
 func (*AesEncryptor) Encrypt(origData, key []byte) ([]byte, error) {
@@ -45,10 +52,15 @@ func (*AesEncryptor) Decrypt(cryptedData, key []byte) ([]byte, error) {
 		return nil, err
 	}
 	blockSize := block.BlockSize()
+	if len(cryptedData) == 0 || len(cryptedData)%blockSize != 0 {
+		return nil, ErrInvalidPadding
+	}
 	blockMode := cipher.NewCBCDecrypter(block, key[:blockSize])
 	origData := make([]byte, len(cryptedData))
 	blockMode.CryptBlocks(origData, cryptedData)
-	origData = PKCS5UnPadding(origData)
+	if origData = PKCS5UnPadding(origData); origData == nil {
+		return nil, ErrInvalidPadding
+	}
 	return origData, nil
 }
 
@@ -70,10 +82,23 @@ func PKCS5Padding(cipherText []byte, blockSize int) []byte {
 	return append(cipherText, padText...)
 }
 
+// PKCS5UnPadding removes the padding of origData, it returns nil if the
+// padding is malformed.
 func PKCS5UnPadding(origData []byte) []byte {
 	length := len(origData)
+	if length == 0 {
+		return nil
+	}
 	// 去掉最后一个字节 unPadding 次
 	unPadding := int(origData[length-1])
+	if unPadding == 0 || unPadding > length {
+		return nil
+	}
+	for _, b := range origData[length-unPadding:] {
+		if int(b) != unPadding {
+			return nil
+		}
+	}
 	return origData[:(length - unPadding)]
 }
 
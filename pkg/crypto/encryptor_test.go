@@ -19,3 +19,35 @@ func TestAesEncryptor(t *testing.T) {
 	assert.Equal(t, nil, err)
 	assert.Equal(t, msg, new_msg)
 }
+
+func TestAesEncryptorMalformed(t *testing.T) {
+	ae := crypto.NewAesEncryptor()
+	key := crypto.NewBlake2b().HashBytes([]byte("1234"))
+	for _, data := range [][]byte{nil, []byte("short"), make([]byte, 16)} {
+		_, err := ae.Decrypt(data, key)
+		assert.Equal(t, crypto.ErrInvalidPadding, err)
+	}
+}
+
+func TestAEADEncryptor(t *testing.T) {
+	key := crypto.NewBlake2b().HashBytes([]byte("1234"))
+	msg := []byte("hello")
+	for _, e := range []*crypto.AEADEncryptor{crypto.NewGCMEncryptor(), crypto.NewChaCha20Poly1305Encryptor()} {
+		secret, err := e.Seal(msg, key, []byte("header"))
+		assert.Equal(t, nil, err)
+		// the nonces are random
+		other, _ := e.Seal(msg, key, []byte("header"))
+		assert.NotEqual(t, secret, other)
+		plain, err := e.Open(secret, key, []byte("header"))
+		assert.Equal(t, nil, err)
+		assert.Equal(t, msg, plain)
+
+		_, err = e.Open(secret, key, []byte("other"))
+		assert.NotEqual(t, nil, err)
+		secret[len(secret)-1] ^= 1
+		_, err = e.Open(secret, key, []byte("header"))
+		assert.NotEqual(t, nil, err)
+		_, err = e.Decrypt(secret[:8], key)
+		assert.Equal(t, crypto.ErrCiphertextTooShort, err)
+	}
+}
@@ -353,11 +353,11 @@ func (x *xrpc) generateClientMethod(servName, fullServName, serviceDescVar strin
 		return
 	}
 	streamType := unexport(servName) + methName + "Client"
-	x.P("stream, err := c.cc.NewStream(ctx, ", descExpr, `, "`, sname, `", opts...)`)
+	x.P("stream, err := c.cc.NewStream(ctx, ", typesPkg, ".XRPC, ", descExpr, `, "`, sname, `", opts...)`)
 	x.P("if err != nil { return nil, err }")
 	x.P("x := &", streamType, "{stream}")
 	if !method.GetClientStreaming() {
-		x.P("if err := x.ClientStream.SendMsg(in); err != nil { return nil, err }")
+		x.P("if err := x.ClientStream.SendMsg(x.ClientStream.Context(), in); err != nil { return nil, err }")
 		x.P("if err := x.ClientStream.CloseSend(); err != nil { return nil, err }")
 	}
 	x.P("return x, nil")
@@ -390,14 +390,14 @@ func (x *xrpc) generateClientMethod(servName, fullServName, serviceDescVar strin
 
 	if genSend {
 		x.P("func (x *", streamType, ") Send(m *", inType, ") error {")
-		x.P("return x.ClientStream.SendMsg(m)")
+		x.P("return x.ClientStream.SendMsg(x.ClientStream.Context(), m)")
 		x.P("}")
 		x.P()
 	}
 	if genRecv {
 		x.P("func (x *", streamType, ") Recv() (*", outType, ", error) {")
 		x.P("m := new(", outType, ")")
-		x.P("if err := x.ClientStream.RecvMsg(m); err != nil { return nil, err }")
+		x.P("if _, err := x.ClientStream.RecvMsg(x.ClientStream.Context(), m); err != nil { return nil, err }")
 		x.P("return m, nil")
 		x.P("}")
 		x.P()
@@ -406,7 +406,7 @@ func (x *xrpc) generateClientMethod(servName, fullServName, serviceDescVar strin
 		x.P("func (x *", streamType, ") CloseAndRecv() (*", outType, ", error) {")
 		x.P("if err := x.ClientStream.CloseSend(); err != nil { return nil, err }")
 		x.P("m := new(", outType, ")")
-		x.P("if err := x.ClientStream.RecvMsg(m); err != nil { return nil, err }")
+		x.P("if _, err := x.ClientStream.RecvMsg(x.ClientStream.Context(), m); err != nil { return nil, err }")
 		x.P("return m, nil")
 		x.P("}")
 		x.P()
@@ -488,7 +488,7 @@ func (x *xrpc) generateServerMethod(servName, fullServName string, method *pb.Me
 	x.P("func ", hname, "(srv interface{}, stream ", typesPkg, ".ServerStream) error {")
 	if !method.GetClientStreaming() {
 		x.P("m := new(", inType, ")")
-		x.P("if err := stream.RecvMsg(m); err != nil { return err }")
+		x.P("if _, err := stream.RecvMsg(stream.Context(), m); err != nil { return err }")
 		x.P("return srv.(", servName, "Server).", methName, "(m, &", streamType, "{stream})")
 	} else {
 		x.P("return srv.(", servName, "Server).", methName, "(&", streamType, "{stream})")
@@ -522,20 +522,20 @@ func (x *xrpc) generateServerMethod(servName, fullServName string, method *pb.Me
 
 	if genSend {
 		x.P("func (x *", streamType, ") Send(m *", outType, ") error {")
-		x.P("return x.ServerStream.SendMsg(m)")
+		x.P("return x.ServerStream.SendMsg(x.ServerStream.Context(), m)")
 		x.P("}")
 		x.P()
 	}
 	if genSendAndClose {
 		x.P("func (x *", streamType, ") SendAndClose(m *", outType, ") error {")
-		x.P("return x.ServerStream.SendMsg(m)")
+		x.P("return x.ServerStream.SendMsg(x.ServerStream.Context(), m)")
 		x.P("}")
 		x.P()
 	}
 	if genRecv {
 		x.P("func (x *", streamType, ") Recv() (*", inType, ", error) {")
 		x.P("m := new(", inType, ")")
-		x.P("if err := x.ServerStream.RecvMsg(m); err != nil { return nil, err }")
+		x.P("if _, err := x.ServerStream.RecvMsg(x.ServerStream.Context(), m); err != nil { return nil, err }")
 		x.P("return m, nil")
 		x.P("}")
 		x.P()
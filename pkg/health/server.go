@@ -0,0 +1,139 @@
+// Package health implements the health checking service grpc.health.v1.Health,
+// it serves the serving status of a server and of each of its services:
+//
+//	hs := health.NewServer()
+//	healthpb.RegisterHealthServer(s, hs)
+//	hs.SetServingStatus("greeter.Greeter", healthpb.HealthCheckResponse_SERVING)
+//
+// The empty service name stands for the whole server, it is SERVING from the
+// start.
+package health
+
+import (
+	"context"
+	"sync"
+
+	"x.io/xrpc/pkg/codes"
+	"x.io/xrpc/pkg/status"
+
+	healthpb "x.io/xrpc/protocol/health"
+)
+
+// Server implements healthpb.HealthServer.
+type Server struct {
+	mu sync.Mutex
+	// shutdown is set by Shutdown, the later updates are ignored until Resume.
+	shutdown  bool
+	statusMap map[string]healthpb.HealthCheckResponse_ServingStatus
+	// updates holds a channel per Watch call of each service, it carries the
+	// latest status of the service.
+	updates map[string]map[healthpb.Health_WatchServer]chan healthpb.HealthCheckResponse_ServingStatus
+}
+
+// NewServer returns a new Server, the server is SERVING.
+func NewServer() *Server {
+	return &Server{
+		statusMap: map[string]healthpb.HealthCheckResponse_ServingStatus{"": healthpb.HealthCheckResponse_SERVING},
+		updates:   map[string]map[healthpb.Health_WatchServer]chan healthpb.HealthCheckResponse_ServingStatus{},
+	}
+}
+
+// Check implements healthpb.HealthServer, it fails with NotFound if the
+// service is unknown.
+func (s *Server) Check(ctx context.Context, in *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if servingStatus, ok := s.statusMap[in.Service]; ok {
+		return &healthpb.HealthCheckResponse{Status: servingStatus}, nil
+	}
+	return nil, status.Error(codes.NotFound, "unknown service")
+}
+
+// Watch implements healthpb.HealthServer, it sends the status of the service
+// and every change of it until the call is done. The status of an unknown
+// service is SERVICE_UNKNOWN.
+func (s *Server) Watch(in *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	service := in.Service
+	// update holds at most the latest status, a slow watcher skips the
+	// intermediate ones.
+	update := make(chan healthpb.HealthCheckResponse_ServingStatus, 1)
+	s.mu.Lock()
+	if servingStatus, ok := s.statusMap[service]; ok {
+		update <- servingStatus
+	} else {
+		update <- healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+	}
+	if _, ok := s.updates[service]; !ok {
+		s.updates[service] = map[healthpb.Health_WatchServer]chan healthpb.HealthCheckResponse_ServingStatus{}
+	}
+	s.updates[service][stream] = update
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.updates[service], stream)
+		if len(s.updates[service]) == 0 {
+			delete(s.updates, service)
+		}
+		s.mu.Unlock()
+	}()
+
+	var lastSent healthpb.HealthCheckResponse_ServingStatus = -1
+	for {
+		select {
+		case servingStatus := <-update:
+			if lastSent == servingStatus {
+				continue
+			}
+			lastSent = servingStatus
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: servingStatus}); err != nil {
+				return status.Error(codes.Canceled, "stream has ended")
+			}
+		case <-stream.Context().Done():
+			return status.Error(codes.Canceled, "stream has ended")
+		}
+	}
+}
+
+// SetServingStatus sets the status of the service, the empty service is the
+// server. It is ignored after Shutdown.
+func (s *Server) SetServingStatus(service string, servingStatus healthpb.HealthCheckResponse_ServingStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shutdown {
+		return
+	}
+	s.setServingStatusLocked(service, servingStatus)
+}
+
+func (s *Server) setServingStatusLocked(service string, servingStatus healthpb.HealthCheckResponse_ServingStatus) {
+	s.statusMap[service] = servingStatus
+	for _, update := range s.updates[service] {
+		// drop the status the watcher has not taken yet
+		select {
+		case <-update:
+		default:
+		}
+		update <- servingStatus
+	}
+}
+
+// Shutdown sets all the statuses to NOT_SERVING, e.g. before the server is
+// stopped, and ignores the later updates until Resume.
+func (s *Server) Shutdown() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shutdown = true
+	for service := range s.statusMap {
+		s.setServingStatusLocked(service, healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+}
+
+// Resume sets all the statuses to SERVING and accepts the updates again.
+func (s *Server) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shutdown = false
+	for service := range s.statusMap {
+		s.setServingStatusLocked(service, healthpb.HealthCheckResponse_SERVING)
+	}
+}
@@ -0,0 +1,95 @@
+package health_test
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+
+	"x.io/xrpc"
+	"x.io/xrpc/pkg/codes"
+	"x.io/xrpc/pkg/health"
+	"x.io/xrpc/pkg/net"
+	"x.io/xrpc/pkg/status"
+
+	"github.com/stretchr/testify/assert"
+	_ "x.io/xrpc/pkg/encoding/gzip"
+	_ "x.io/xrpc/pkg/encoding/proto"
+	healthpb "x.io/xrpc/protocol/health"
+)
+
+const addr = "localhost:9907"
+
+var (
+	hs     = health.NewServer()
+	client healthpb.HealthClient
+	ctx    = context.Background()
+)
+
+func TestMain(m *testing.M) {
+	lis, err := net.Listen(ctx, "tcp", addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	s := xrpc.NewServer()
+	healthpb.RegisterHealthServer(s, hs)
+	go s.Serve(lis)
+	conn, err := xrpc.Dial("tcp", addr, xrpc.WithInsecure())
+	if err != nil {
+		log.Fatal(err)
+	}
+	client = healthpb.NewHealthClient(conn)
+	os.Exit(m.Run())
+}
+
+func check(t *testing.T, service string) healthpb.HealthCheckResponse_ServingStatus {
+	r, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+	assert.Equal(t, nil, err)
+	return r.GetStatus()
+}
+
+func TestCheck(t *testing.T) {
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check(t, ""))
+
+	_, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	hs.SetServingStatus("check", healthpb.HealthCheckResponse_NOT_SERVING)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check(t, "check"))
+}
+
+func watch(t *testing.T, service string) func() healthpb.HealthCheckResponse_ServingStatus {
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: service})
+	assert.Equal(t, nil, err)
+	return func() healthpb.HealthCheckResponse_ServingStatus {
+		r, err := stream.Recv()
+		assert.Equal(t, nil, err)
+		return r.GetStatus()
+	}
+}
+
+func TestWatch(t *testing.T) {
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVICE_UNKNOWN, watch(t, "unknown")())
+
+	hs.SetServingStatus("watch", healthpb.HealthCheckResponse_NOT_SERVING)
+	recv := watch(t, "watch")
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, recv())
+	hs.SetServingStatus("watch", healthpb.HealthCheckResponse_SERVING)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, recv())
+	// an unchanged status is not sent again
+	hs.SetServingStatus("watch", healthpb.HealthCheckResponse_SERVING)
+	hs.SetServingStatus("watch", healthpb.HealthCheckResponse_NOT_SERVING)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, recv())
+}
+
+func TestShutdown(t *testing.T) {
+	hs.SetServingStatus("shutdown", healthpb.HealthCheckResponse_SERVING)
+	hs.Shutdown()
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check(t, ""))
+	hs.SetServingStatus("shutdown", healthpb.HealthCheckResponse_SERVING)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check(t, "shutdown"))
+
+	hs.Resume()
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check(t, ""))
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check(t, "shutdown"))
+}
@@ -0,0 +1,64 @@
+// Package keepalive defines the parameters of the keepalive pings of the
+// sessions and of their lifetime on the server.
+//
+// The client and the server ping each other on the control stream of a
+// session, the session is closed if a ping is not answered in time. The
+// server closes the sessions which ping too often, and drains the sessions
+// which are idle or too old by a goaway, the client moves to a new session
+// for the new calls.
+package keepalive
+
+import (
+	"time"
+)
+
+// ClientParameters configure the keepalive pings of a ClientConn.
+type ClientParameters struct {
+	// Time is the interval of the pings of the client, zero disables them.
+	// It should not be less than the MinTime of the server, the server
+	// closes the sessions which ping too often.
+	Time time.Duration
+	// Timeout is how long the client waits for the answer of a ping before
+	// it closes the session, 20 seconds if zero.
+	Timeout time.Duration
+	// PermitWithoutStream lets the client ping while there is no call in
+	// flight, otherwise the client only pings during calls.
+	PermitWithoutStream bool
+}
+
+// ServerParameters configure the keepalive pings and the lifetime of the
+// sessions of a server.
+type ServerParameters struct {
+	// MaxConnectionIdle is how long a session may have no stream before it
+	// is closed by a goaway, zero means forever.
+	MaxConnectionIdle time.Duration
+	// MaxConnectionAge is how long a session may live before it is drained
+	// by a goaway, zero means forever. A jitter of +/-10% is added to it to
+	// spread the reconnections.
+	MaxConnectionAge time.Duration
+	// MaxConnectionAgeGrace is how long the calls in flight may go on after
+	// the goaway of MaxConnectionAge or MaxConnectionIdle before the session
+	// is closed, zero means forever.
+	MaxConnectionAgeGrace time.Duration
+	// Time is the interval of the pings of the server, 2 hours if zero.
+	Time time.Duration
+	// Timeout is how long the server waits for the answer of a ping before
+	// it closes the session, 20 seconds if zero.
+	Timeout time.Duration
+}
+
+// EnforcementPolicy is the policy of a server against the clients which ping
+// too often. A session which breaks it a few times in a row is closed by a
+// goaway with the reason TooManyPings.
+type EnforcementPolicy struct {
+	// MinTime is the minimum interval between the pings of a client, 5
+	// minutes if zero.
+	MinTime time.Duration
+	// PermitWithoutStream allows the pings while the session has no stream,
+	// otherwise such pings break the policy.
+	PermitWithoutStream bool
+}
+
+// TooManyPings is the reason of the goaway of a session which broke the
+// EnforcementPolicy of the server, the client doubles its ping interval.
+const TooManyPings = "too_many_pings"
@@ -29,7 +29,7 @@ var (
 		if err != nil {
 			return nil, err
 		}
-		stream, err := session.OpenStreamSync(context.Background())
+		stream, err := session.OpenStreamSync(ctx)
 		if err != nil {
 			return nil, err
 		}
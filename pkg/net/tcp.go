@@ -8,9 +8,12 @@ import (
 
 var (
 	tcpDialer Dialer = func(ctx context.Context, addr string) (conn Conn, err error) {
-		tc, err := net.Dial("tcp", addr)
-		conn = &tcpConn{tc}
-		return
+		var d net.Dialer
+		tc, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return &tcpConn{tc}, nil
 	}
 	KeepAliveTime = time.Minute
 )
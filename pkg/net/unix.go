@@ -8,9 +8,12 @@ import (
 var (
 	// addr example: /tmp/xrpc.sock
 	unixDialer Dialer = func(ctx context.Context, addr string) (conn Conn, err error) {
-		tc, err := net.Dial("unix", addr)
-		conn = &unixConn{tc}
-		return
+		var d net.Dialer
+		tc, err := d.DialContext(ctx, "unix", addr)
+		if err != nil {
+			return nil, err
+		}
+		return &unixConn{tc}, nil
 	}
 )
 
@@ -0,0 +1,36 @@
+// Package peer defines the peer of a call, the server puts it into the
+// contexts of the handlers and of the Authenticator, and the client into the
+// contexts of its plugins.
+package peer
+
+import (
+	"context"
+	"net"
+
+	"x.io/xrpc/pkg/credentials"
+)
+
+// Peer is the other end of a session.
+type Peer struct {
+	// Addr is the address of the peer.
+	Addr net.Addr
+	// AuthInfo is the information of the peer authenticated by the transport
+	// credentials, nil if the session is insecure.
+	AuthInfo credentials.AuthInfo
+	// HandshakeInfo is the information of the peer returned by the
+	// Handshaker of the session, nil if there is none.
+	HandshakeInfo credentials.AuthInfo
+}
+
+type peerKey struct{}
+
+// NewContext returns a new context which carries the peer p.
+func NewContext(ctx context.Context, p *Peer) context.Context {
+	return context.WithValue(ctx, peerKey{}, p)
+}
+
+// FromContext returns the peer carried by ctx.
+func FromContext(ctx context.Context) (p *Peer, ok bool) {
+	p, ok = ctx.Value(peerKey{}).(*Peer)
+	return
+}
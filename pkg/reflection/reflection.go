@@ -0,0 +1,88 @@
+// Package reflection implements the server reflection service, it lets the
+// clients discover the services of a server, their methods and the types of
+// the requests and replies.
+//
+// The service is registered as the custom service "reflection":
+//
+//	s := xrpc.NewServer()
+//	reflection.Register(s)
+//
+// and queried by a Client over a RawClient:
+//
+//	rc, _ := xrpc.NewRawClient("tcp", addr, xrpc.WithInsecure(), xrpc.WithJsonCodec())
+//	names, _ := reflection.NewClient(rc).ListServices(ctx)
+package reflection
+
+import (
+	"context"
+	"sort"
+
+	"x.io/xrpc"
+	"x.io/xrpc/pkg/codes"
+	"x.io/xrpc/pkg/status"
+)
+
+// ServiceName is the name of the reflection service.
+const ServiceName = "reflection"
+
+// serverReflection serves the ServiceInfos of a Server, its exported methods
+// are the methods of the service.
+type serverReflection struct {
+	s *xrpc.Server
+}
+
+// Register registers the reflection service on s.
+func Register(s *xrpc.Server) error {
+	return s.RegisterCustomService(ServiceName, &serverReflection{s: s})
+}
+
+// ListServices returns the sorted names of the services of the server.
+func (r *serverReflection) ListServices() []string {
+	infos := r.s.GetServiceInfo()
+	names := make([]string, 0, len(infos))
+	for name := range infos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ServiceInfo returns the ServiceInfo of the service name, nil if the service
+// is unknown.
+func (r *serverReflection) ServiceInfo(name string) *xrpc.ServiceInfo {
+	info, ok := r.s.GetServiceInfo()[name]
+	if !ok {
+		return nil
+	}
+	return &info
+}
+
+// Client queries the reflection service of a server.
+type Client struct {
+	rc *xrpc.RawClient
+}
+
+// NewClient returns a Client which calls the reflection service over rc, rc
+// must use the json codec.
+func NewClient(rc *xrpc.RawClient) *Client {
+	return &Client{rc: rc}
+}
+
+// ListServices returns the sorted names of the services of the server.
+func (c *Client) ListServices(ctx context.Context) (names []string, err error) {
+	err = c.rc.RawCall(ctx, ServiceName+".ListServices", &names)
+	return
+}
+
+// ServiceInfo returns the ServiceInfo of the service name, it fails with
+// NotFound if the server has no such service.
+func (c *Client) ServiceInfo(ctx context.Context, name string) (*xrpc.ServiceInfo, error) {
+	var info *xrpc.ServiceInfo
+	if err := c.rc.RawCall(ctx, ServiceName+".ServiceInfo", &info, name); err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return nil, status.Errorf(codes.NotFound, "reflection: unknown service %v", name)
+	}
+	return info, nil
+}
@@ -0,0 +1,97 @@
+package reflection_test
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+
+	"x.io/xrpc"
+	"x.io/xrpc/pkg/codes"
+	"x.io/xrpc/pkg/net"
+	"x.io/xrpc/pkg/reflection"
+	"x.io/xrpc/pkg/status"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/stretchr/testify/assert"
+	_ "x.io/xrpc/pkg/encoding/gzip"
+	_ "x.io/xrpc/pkg/encoding/proto"
+	greeter_pb "x.io/xrpc/protocol/greeter"
+	rg_pb "x.io/xrpc/protocol/routeguide"
+)
+
+const addr = "localhost:9906"
+
+type point struct {
+	X, Y int
+	Tag  string `json:"tag"`
+}
+
+type geo struct{}
+
+func (geo) Distance(a, b point) (float64, error) { return 0, nil }
+
+func newClient(t *testing.T) *reflection.Client {
+	rc, err := xrpc.NewRawClient("tcp", addr, xrpc.WithInsecure(), xrpc.WithJsonCodec())
+	assert.Equal(t, nil, err)
+	return reflection.NewClient(rc)
+}
+
+func TestMain(m *testing.M) {
+	lis, err := net.Listen(context.Background(), "tcp", addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	s := xrpc.NewServer()
+	greeter_pb.RegisterGreeterServer(s, &greeter_pb.UnimplementedGreeterServer{})
+	rg_pb.RegisterRouteGuideServer(s, &rg_pb.UnimplementedRouteGuideServer{})
+	s.RegisterCustomService("geo", geo{})
+	reflection.Register(s)
+	go s.Serve(lis)
+	os.Exit(m.Run())
+}
+
+func TestListServices(t *testing.T) {
+	names, err := newClient(t).ListServices(context.Background())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"custom.geo", "custom.reflection", "greeter.Greeter", "routeguide.RouteGuide"}, names)
+}
+
+func TestProtoService(t *testing.T) {
+	info, err := newClient(t).ServiceInfo(context.Background(), "greeter.Greeter")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(info.Methods))
+	assert.Equal(t, xrpc.MethodInfo{Name: "SayHello", ReqName: "greeter.HelloRequest", ReplyName: "greeter.HelloReply"}, *info.Methods[0])
+	assert.Equal(t, "SayHi", info.Methods[1].Name)
+
+	fd := &descriptor.FileDescriptorProto{}
+	assert.Equal(t, nil, proto.Unmarshal(info.FileDescriptor, fd))
+	assert.Equal(t, "greeter.proto", fd.GetName())
+}
+
+func TestStreamingService(t *testing.T) {
+	info, err := newClient(t).ServiceInfo(context.Background(), "routeguide.RouteGuide")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 4, len(info.Methods))
+	assert.Equal(t, xrpc.MethodInfo{Name: "RouteChat", ReqName: "routeguide.RouteNote", ReplyName: "routeguide.RouteNote",
+		IsClientStream: true, IsServerStream: true}, *info.Methods[3])
+}
+
+func TestCustomService(t *testing.T) {
+	info, err := newClient(t).ServiceInfo(context.Background(), "custom.geo")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(info.Methods))
+	m := info.Methods[0]
+	assert.Equal(t, "Distance", m.Name)
+	assert.Equal(t, "reflection_test.point, reflection_test.point", m.ReqName)
+	assert.Equal(t, "float64", m.ReplyName)
+	point := `{"properties":{"X":{"type":"integer"},"Y":{"type":"integer"},"tag":{"type":"string"}},"title":"reflection_test.point","type":"object"}`
+	assert.Equal(t, `{"items":[`+point+`,`+point+`],"type":"array"}`, m.Req)
+	assert.Equal(t, `{"type":"number"}`, m.Reply)
+}
+
+func TestUnknownService(t *testing.T) {
+	_, err := newClient(t).ServiceInfo(context.Background(), "unknown")
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -0,0 +1,42 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// DNSResolveInterval is the interval between the lookups of the dns resolvers.
+var DNSResolveInterval = 30 * time.Second
+
+func init() {
+	Register(&dnsBuilder{})
+}
+
+// dnsBuilder builds the resolvers of dns:///host:port, the addresses are the
+// ip addresses of host with port.
+type dnsBuilder struct{}
+
+func (*dnsBuilder) Build(target Target, cc ClientConn) (Resolver, error) {
+	host, port, err := net.SplitHostPort(target.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return NewPollingResolver(cc, DNSResolveInterval, func() (State, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		hosts, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			return State{}, err
+		}
+		var state State
+		for _, h := range hosts {
+			state.Addresses = append(state.Addresses, Address{Addr: net.JoinHostPort(h, port)})
+		}
+		return state, nil
+	}), nil
+}
+
+func (*dnsBuilder) Scheme() string {
+	return "dns"
+}
@@ -0,0 +1,71 @@
+package resolver
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// FileResolveInterval is the interval between the reads of the files of the
+// file resolvers.
+var FileResolveInterval = 5 * time.Second
+
+func init() {
+	Register(&fileBuilder{})
+}
+
+// endpointsFile is the format of the files of the file resolvers, e.g.
+//
+//	endpoints:
+//	  - addr: tcp://localhost:9897
+//	    attributes:
+//	      weight: 2
+//	  - addr: kcp://localhost:9898
+type endpointsFile struct {
+	Endpoints []struct {
+		Addr       string                 `yaml:"addr"`
+		Attributes map[string]interface{} `yaml:"attributes"`
+	} `yaml:"endpoints"`
+}
+
+// fileBuilder builds the resolvers of file:///path, the addresses are read
+// from the yaml file at the absolute path and reloaded when it changes. A
+// path relative to the working directory is written as file://./path.
+type fileBuilder struct{}
+
+func (*fileBuilder) Build(target Target, cc ClientConn) (Resolver, error) {
+	path := target.Endpoint
+	switch target.Authority {
+	case "", "localhost":
+		path = filepath.Join("/", path)
+	default:
+		path = filepath.Join(target.Authority, path)
+	}
+	return NewPollingResolver(cc, FileResolveInterval, func() (State, error) {
+		return readEndpointsFile(path)
+	}), nil
+}
+
+func (*fileBuilder) Scheme() string {
+	return "file"
+}
+
+func readEndpointsFile(path string) (State, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return State{}, err
+	}
+	var f endpointsFile
+	if err = yaml.Unmarshal(data, &f); err != nil {
+		return State{}, err
+	}
+	var state State
+	for _, e := range f.Endpoints {
+		addr := ParseAddress(e.Addr)
+		addr.Attributes = e.Attributes
+		state.Addresses = append(state.Addresses, addr)
+	}
+	return state, nil
+}
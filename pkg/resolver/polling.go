@@ -0,0 +1,66 @@
+package resolver
+
+import (
+	"sync"
+	"time"
+)
+
+// NewPollingResolver returns a Resolver which calls resolve at once, then
+// every interval and on ResolveNow, and pushes the result to cc. It is the
+// base of the resolvers without a way to watch the changes of a target.
+func NewPollingResolver(cc ClientConn, interval time.Duration, resolve func() (State, error)) Resolver {
+	r := &pollingResolver{
+		cc:       cc,
+		interval: interval,
+		resolve:  resolve,
+		rn:       make(chan struct{}, 1),
+		closed:   make(chan struct{}),
+	}
+	r.poll()
+	go r.watch()
+	return r
+}
+
+type pollingResolver struct {
+	cc       ClientConn
+	interval time.Duration
+	resolve  func() (State, error)
+
+	rn        chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (r *pollingResolver) poll() {
+	state, err := r.resolve()
+	if err != nil {
+		r.cc.ReportError(err)
+		return
+	}
+	r.cc.UpdateState(state)
+}
+
+func (r *pollingResolver) watch() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-r.rn:
+		case <-r.closed:
+			return
+		}
+		r.poll()
+	}
+}
+
+func (r *pollingResolver) ResolveNow() {
+	select {
+	case r.rn <- struct{}{}:
+	default:
+	}
+}
+
+func (r *pollingResolver) Close() {
+	r.closeOnce.Do(func() { close(r.closed) })
+}
@@ -0,0 +1,114 @@
+// Package resolver defines the name resolvers which turn the target of Dial
+// into the addresses of the servers, e.g. static:///a,b,c, dns:///host:port,
+// file:///endpoints.yaml or chord://custom.math.
+package resolver
+
+import (
+	"strings"
+	"sync"
+)
+
+// Address is a resolved address of a server.
+type Address struct {
+	// Network is the network of the address, e.g. tcp or kcp. It is the
+	// network passed to Dial if empty.
+	Network string
+	// Addr is the address of the server, e.g. localhost:9897.
+	Addr string
+	// Attributes holds the attributes of the address given by the resolver,
+	// e.g. the weight of the server.
+	Attributes map[string]interface{}
+}
+
+// String returns the address in the form of network://addr.
+func (a Address) String() string {
+	if a.Network == "" {
+		return a.Addr
+	}
+	return a.Network + "://" + a.Addr
+}
+
+// ParseAddress parses an address in the form of network://addr or addr.
+func ParseAddress(s string) Address {
+	if i := strings.Index(s, "://"); i >= 0 {
+		return Address{Network: s[:i], Addr: s[i+3:]}
+	}
+	return Address{Addr: s}
+}
+
+// State is the resolved state of a target.
+type State struct {
+	Addresses []Address
+}
+
+// Target is the target of Dial in the form of scheme://authority/endpoint.
+type Target struct {
+	Scheme    string
+	Authority string
+	Endpoint  string
+}
+
+// ParseTarget splits target into a Target, it returns false if target is not
+// in the form of scheme://authority/endpoint.
+func ParseTarget(target string) (Target, bool) {
+	i := strings.Index(target, "://")
+	if i <= 0 {
+		return Target{}, false
+	}
+	t := Target{Scheme: target[:i]}
+	rest := target[i+3:]
+	if j := strings.Index(rest, "/"); j >= 0 {
+		t.Authority, t.Endpoint = rest[:j], rest[j+1:]
+	} else {
+		t.Authority = rest
+	}
+	return t, true
+}
+
+// ClientConn is the callback of the resolvers to update the addresses of the
+// ClientConn.
+type ClientConn interface {
+	// UpdateState replaces the addresses of the ClientConn with the new state.
+	UpdateState(State)
+	// ReportError notifies the ClientConn that the resolver failed to resolve
+	// the target, the ClientConn keeps the current addresses.
+	ReportError(error)
+}
+
+// Builder creates the resolvers of a scheme.
+type Builder interface {
+	// Build creates a resolver which watches target and pushes its state to
+	// cc, the first state may be pushed before Build returns.
+	Build(target Target, cc ClientConn) (Resolver, error)
+	// Scheme returns the scheme of the resolvers.
+	Scheme() string
+}
+
+// Resolver watches the addresses of a target.
+type Resolver interface {
+	// ResolveNow is a hint that the ClientConn lost a server and the
+	// resolver should resolve the target again.
+	ResolveNow()
+	// Close stops the resolver.
+	Close()
+}
+
+var (
+	mu       sync.RWMutex
+	builders = make(map[string]Builder)
+)
+
+// Register registers the resolver builder of its scheme, it replaces the
+// builder registered before for the scheme.
+func Register(b Builder) {
+	mu.Lock()
+	defer mu.Unlock()
+	builders[b.Scheme()] = b
+}
+
+// Get returns the resolver builder of scheme, nil if none is registered.
+func Get(scheme string) Builder {
+	mu.RLock()
+	defer mu.RUnlock()
+	return builders[scheme]
+}
@@ -0,0 +1,93 @@
+package resolver_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"x.io/xrpc/pkg/resolver"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testClientConn struct {
+	mu    sync.Mutex
+	state resolver.State
+	err   error
+}
+
+func (cc *testClientConn) UpdateState(s resolver.State) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.state = s
+}
+
+func (cc *testClientConn) ReportError(err error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.err = err
+}
+
+func TestParseTarget(t *testing.T) {
+	for _, test := range []struct {
+		target string
+		want   resolver.Target
+		ok     bool
+	}{
+		{"static:///a,b,c", resolver.Target{Scheme: "static", Endpoint: "a,b,c"}, true},
+		{"dns:///localhost:9897", resolver.Target{Scheme: "dns", Endpoint: "localhost:9897"}, true},
+		{"chord://custom.math", resolver.Target{Scheme: "chord", Authority: "custom.math"}, true},
+		{"file:////tmp/endpoints.yaml", resolver.Target{Scheme: "file", Endpoint: "/tmp/endpoints.yaml"}, true},
+		{"localhost:9897", resolver.Target{}, false},
+	} {
+		got, ok := resolver.ParseTarget(test.target)
+		assert.Equal(t, test.ok, ok, test.target)
+		assert.Equal(t, test.want, got, test.target)
+	}
+}
+
+func TestStaticResolver(t *testing.T) {
+	cc := &testClientConn{}
+	target, _ := resolver.ParseTarget("static:///localhost:9897, kcp://localhost:9898")
+	r, err := resolver.Get("static").Build(target, cc)
+	assert.Equal(t, nil, err)
+	defer r.Close()
+	assert.Equal(t, []resolver.Address{
+		{Addr: "localhost:9897"},
+		{Network: "kcp", Addr: "localhost:9898"},
+	}, cc.state.Addresses)
+}
+
+func TestFileResolver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resolver")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "endpoints.yaml")
+	err = ioutil.WriteFile(path, []byte(`
+endpoints:
+  - addr: tcp://localhost:9897
+    attributes:
+      weight: 2
+  - addr: localhost:9898
+`), 0644)
+	assert.Equal(t, nil, err)
+
+	// the path is absolute, "file://"+path is file:///tmp/... and the four
+	// slashes of "file:///"+path are accepted too
+	for _, target := range []string{"file://" + path, "file:///" + path} {
+		cc := &testClientConn{}
+		target, _ := resolver.ParseTarget(target)
+		r, err := resolver.Get("file").Build(target, cc)
+		assert.Equal(t, nil, err)
+		cc.mu.Lock()
+		assert.Equal(t, nil, cc.err)
+		assert.Equal(t, []resolver.Address{
+			{Network: "tcp", Addr: "localhost:9897", Attributes: map[string]interface{}{"weight": 2}},
+			{Addr: "localhost:9898"},
+		}, cc.state.Addresses)
+		cc.mu.Unlock()
+		r.Close()
+	}
+}
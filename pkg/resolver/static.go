@@ -0,0 +1,31 @@
+package resolver
+
+import "strings"
+
+func init() {
+	Register(&staticBuilder{})
+}
+
+// staticBuilder builds the resolvers of static:///a,b,c, the addresses are
+// separated by commas and never change.
+type staticBuilder struct{}
+
+func (*staticBuilder) Build(target Target, cc ClientConn) (Resolver, error) {
+	var state State
+	for _, s := range strings.Split(target.Endpoint, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			state.Addresses = append(state.Addresses, ParseAddress(s))
+		}
+	}
+	cc.UpdateState(state)
+	return staticResolver{}, nil
+}
+
+func (*staticBuilder) Scheme() string {
+	return "static"
+}
+
+type staticResolver struct{}
+
+func (staticResolver) ResolveNow() {}
+func (staticResolver) Close()      {}
@@ -35,16 +35,28 @@ import (
 	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
 	spb "google.golang.org/genproto/googleapis/rpc/status"
-	"google.golang.org/grpc/codes"
 	"x.io/xrpc/internal"
+	"x.io/xrpc/pkg/codes"
 )
 
 func init() {
 	internal.StatusRawProto = statusRawProto
+	internal.StatusCode = statusCode
 }
 
 func statusRawProto(s *Status) *spb.Status { return s.s }
 
+// statusCode returns the code of the status error in the chain of err.
+func statusCode(err error) (uint32, bool) {
+	var se interface {
+		GRPCStatus() *Status
+	}
+	if errors.As(err, &se) {
+		return uint32(se.GRPCStatus().Code()), true
+	}
+	return 0, false
+}
+
 // statusError is an alias of a status proto.  It implements error and Status,
 // and a nil statusError should never be returned by this package.
 type statusError spb.Status
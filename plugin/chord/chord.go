@@ -18,13 +18,35 @@ type service struct {
 	ServiceName string
 	Methods     map[string]bool
 	Endpoints   map[string]bool
+	// Weights 端点的负载均衡权重，未设置的端点权重为1
+	Weights map[string]int `json:",omitempty"`
+}
+
+// setEndpoint 登记端点及其权重
+func (s *service) setEndpoint(addr string, weight int) {
+	if s.Endpoints == nil {
+		s.Endpoints = map[string]bool{}
+	}
+	s.Endpoints[addr] = true
+	if weight > 0 {
+		if s.Weights == nil {
+			s.Weights = map[string]int{}
+		}
+		s.Weights[addr] = weight
+	}
 }
 
 type chordPlugin struct {
 	srvAddr string
+	weight  int
 	client  *chord.ChordClient
 }
 
+// SetWeight 设置注册端点的负载均衡权重，需要在注册服务前调用
+func (c *chordPlugin) SetWeight(weight int) {
+	c.weight = weight
+}
+
 func (c *chordPlugin) Start() error {
 	return nil
 }
@@ -41,15 +63,14 @@ func (c *chordPlugin) register(sd *types.ServiceDesc) error {
 		if err != nil {
 			return err
 		}
-		s.Endpoints[c.srvAddr] = true
 	} else {
 		s.ServiceName = sd.ServiceName
 		s.Methods = map[string]bool{}
 		for _, m := range sd.Methods {
 			s.Methods[m.MethodName] = true
 		}
-		s.Endpoints = map[string]bool{c.srvAddr: true}
 	}
+	s.setEndpoint(c.srvAddr, c.weight)
 	newJson, err := json.Marshal(s)
 	if err != nil {
 		return err
@@ -78,13 +99,12 @@ func (c *chordPlugin) RegisterFunction(serviceName, fname string, fn interface{}
 			return err
 		}
 		s.Methods[fname] = true
-		s.Endpoints[c.srvAddr] = true
 	} else {
 		s.ServiceName = serviceName
 		s.Methods = map[string]bool{}
 		s.Methods[fname] = true
-		s.Endpoints = map[string]bool{c.srvAddr: true}
 	}
+	s.setEndpoint(c.srvAddr, c.weight)
 	newJson, err := json.Marshal(s)
 	if err != nil {
 		return err
@@ -0,0 +1,66 @@
+package chord
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	chord "x.io/xrpc/app/chord/client"
+
+	"x.io/xrpc/pkg/balancer"
+	"x.io/xrpc/pkg/resolver"
+)
+
+// ResolveInterval is the interval between the lookups of the chord resolvers.
+var ResolveInterval = 10 * time.Second
+
+func init() {
+	resolver.Register(&resolverBuilder{})
+}
+
+// resolverBuilder builds the resolvers of chord://custom.math, the addresses
+// are the endpoints registered in chord for the service.
+type resolverBuilder struct{}
+
+func (*resolverBuilder) Build(target resolver.Target, cc resolver.ClientConn) (resolver.Resolver, error) {
+	name := target.Authority
+	if name == "" {
+		name = target.Endpoint
+	}
+	c := chord.NewChordClient(chord.DefaultURL)
+	return resolver.NewPollingResolver(cc, ResolveInterval, func() (resolver.State, error) {
+		return resolveService(c, name)
+	}), nil
+}
+
+func (*resolverBuilder) Scheme() string {
+	return "chord"
+}
+
+func resolveService(c *chord.ChordClient, name string) (state resolver.State, err error) {
+	serviceJson, err := c.Get(name)
+	if err != nil {
+		return
+	}
+	if len(serviceJson) == 0 {
+		return state, errors.New("chord resolve error: no such service " + name)
+	}
+	s := &service{}
+	if err = json.Unmarshal([]byte(serviceJson), s); err != nil {
+		return
+	}
+	endpoints := make([]string, 0, len(s.Endpoints))
+	for k := range s.Endpoints {
+		endpoints = append(endpoints, k)
+	}
+	sort.Strings(endpoints)
+	for _, k := range endpoints {
+		addr := resolver.ParseAddress(k)
+		if w, ok := s.Weights[k]; ok {
+			addr.Attributes = map[string]interface{}{balancer.WeightKey: w}
+		}
+		state.Addresses = append(state.Addresses, addr)
+	}
+	return
+}
@@ -2,52 +2,260 @@ package crypto
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
-
-	"x.io/xrpc"
+	"sync"
+	"time"
 
 	"x.io/xrpc/pkg/crypto"
+	"x.io/xrpc/pkg/peer"
+	"x.io/xrpc/plugin"
+	"x.io/xrpc/types"
 )
 
 const (
 	Key string = "session_id"
+
+	// DefaultRolloverWindow is the time the previous key of a session id
+	// still decrypts the messages after SetKey replaces it.
+	DefaultRolloverWindow = 5 * time.Minute
+)
+
+// Cipher is the AEAD which encrypts the messages.
+type Cipher byte
+
+const (
+	AESGCM           Cipher = 1
+	ChaCha20Poly1305 Cipher = 2
+)
+
+// headerLen is the length of the header of the encrypted messages, the
+// cipher and the key id, it is authenticated along with the message:
+//
+//	[cipher 1][key id 4][nonce][ciphertext and tag]
+const headerLen = 1 + 4
+
+var (
+	errMalformedMessage = errors.New("crypto: malformed message")
+	errUnknownCipher    = errors.New("crypto: unknown cipher")
+	errUnknownKey       = errors.New("crypto: unknown key id")
 )
 
 func New() *cryptoPlugin {
 	return &cryptoPlugin{
 		aes:     crypto.NewAesEncryptor(),
 		blake2b: crypto.NewBlake2b(),
-		keys:    map[string][]byte{},
+		aeads: map[Cipher]*crypto.AEADEncryptor{
+			AESGCM:           crypto.NewGCMEncryptor(),
+			ChaCha20Poly1305: crypto.NewChaCha20Poly1305Encryptor(),
+		},
+		cipher:   AESGCM,
+		rollover: DefaultRolloverWindow,
+		keys:     map[string]*keyRing{},
 	}
 }
 
 type cryptoPlugin struct {
 	aes     *crypto.AesEncryptor
 	blake2b *crypto.Blake2b
+	aeads   map[Cipher]*crypto.AEADEncryptor
+
+	// mu guards the keys and the settings, the keys are rotated while the
+	// messages are encrypted.
+	mu       sync.RWMutex
+	cipher   Cipher
+	rollover time.Duration
+	legacy   bool
+	keys     map[string]*keyRing
+}
 
-	keys map[string][]byte
+// keyRing is the keys of a session id by their ids.
+type keyRing struct {
+	current uint32
+	keys    map[uint32]*ringKey
 }
 
+type ringKey struct {
+	key []byte
+	// retireAt is the time the key stops decrypting, zero if it is the
+	// current key or an added one.
+	retireAt time.Time
+}
+
+// SetKey sets the key derived from pass as the current key of the session id
+// key, which encrypts the messages. The previous current key still decrypts
+// the messages within the rollover window, so a key is rotated by AddKey of
+// the new key on all the peers, then SetKey of it within the window.
 func (c *cryptoPlugin) SetKey(key, pass string) {
-	c.keys[key] = c.blake2b.HashBytes([]byte(pass))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ring := c.ringLocked(key)
+	id := c.addKeyLocked(ring, pass)
+	if old, ok := ring.keys[ring.current]; ok && ring.current != id {
+		old.retireAt = time.Now().Add(c.rollover)
+	}
+	ring.current = id
+}
+
+// AddKey adds the key derived from pass to the session id key, it decrypts
+// the messages but does not encrypt them until SetKey.
+func (c *cryptoPlugin) AddKey(key, pass string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ring := c.ringLocked(key)
+	c.addKeyLocked(ring, pass)
+	if len(ring.keys) == 1 {
+		for id := range ring.keys {
+			ring.current = id
+		}
+	}
+}
+
+// SetCipher sets the AEAD which encrypts the messages, AESGCM by default.
+// The messages of any cipher are decrypted.
+func (c *cryptoPlugin) SetCipher(cipher Cipher) {
+	c.mu.Lock()
+	c.cipher = cipher
+	c.mu.Unlock()
+}
+
+// SetRolloverWindow sets the time a key replaced by SetKey still decrypts
+// the messages, DefaultRolloverWindow by default.
+func (c *cryptoPlugin) SetRolloverWindow(d time.Duration) {
+	c.mu.Lock()
+	c.rollover = d
+	c.mu.Unlock()
+}
+
+// SetLegacyCBC switches the pre-shared keys to the legacy AES-CBC scheme,
+// which uses the key as the IV and has no MAC, for the peers which are not
+// upgraded yet. The messages are neither authenticated nor rotated then.
+func (c *cryptoPlugin) SetLegacyCBC(legacy bool) {
+	c.mu.Lock()
+	c.legacy = legacy
+	c.mu.Unlock()
+}
+
+// Priority returns plugin.PriorityTransport, the messages are decrypted
+// before and encrypted after the plugins which inspect them.
+func (c *cryptoPlugin) Priority() int {
+	return plugin.PriorityTransport
+}
+
+func (c *cryptoPlugin) ringLocked(key string) *keyRing {
+	ring, ok := c.keys[key]
+	if !ok {
+		ring = &keyRing{keys: map[uint32]*ringKey{}}
+		c.keys[key] = ring
+	}
+	return ring
+}
+
+// addKeyLocked adds the key of pass to the ring and drops the retired keys.
+func (c *cryptoPlugin) addKeyLocked(ring *keyRing, pass string) uint32 {
+	now := time.Now()
+	for id, k := range ring.keys {
+		if !k.retireAt.IsZero() && now.After(k.retireAt) {
+			delete(ring.keys, id)
+		}
+	}
+	k := c.blake2b.HashBytes([]byte(pass))
+	id := keyID(k)
+	ring.keys[id] = &ringKey{key: k}
+	return id
+}
+
+// keyID identifies a key in the messages, the peers derive the same id from
+// the same key without coordination.
+func keyID(key []byte) uint32 {
+	return binary.BigEndian.Uint32(crypto.NewBlake2b().HashBytes(append([]byte("xrpc/key-id"), key...)))
+}
+
+// sessionInfo returns the keys of the session agreed by the Handshake, nil
+// if the session has none.
+func sessionInfo(ctx context.Context) *SessionInfo {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, _ := p.HandshakeInfo.(*SessionInfo)
+	return info
 }
 
 func (c *cryptoPlugin) PreReadRequest(ctx context.Context, data []byte) ([]byte, error) {
-	key := xrpc.GetCookie(ctx, Key)
-	pass, ok := c.keys[key]
+	if info := sessionInfo(ctx); info != nil {
+		return c.open(data, func(id uint32) []byte {
+			if id == info.recvID {
+				return info.recvKey
+			}
+			return nil
+		})
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	ring, ok := c.keys[types.GetCookie(ctx, Key)]
 	if !ok {
 		return data, errors.New("check session key failed")
 	}
-	data, err := c.aes.Decrypt(data, pass)
-	return data, err
+	if c.legacy {
+		return c.aes.Decrypt(data, ring.keys[ring.current].key)
+	}
+	return c.open(data, func(id uint32) []byte {
+		k, ok := ring.keys[id]
+		if !ok || !k.retireAt.IsZero() && time.Now().After(k.retireAt) {
+			return nil
+		}
+		return k.key
+	})
 }
 
 func (c *cryptoPlugin) PreWriteResponse(ctx context.Context, data []byte) ([]byte, error) {
-	key := xrpc.GetCookie(ctx, Key)
-	pass, ok := c.keys[key]
+	if info := sessionInfo(ctx); info != nil {
+		c.mu.RLock()
+		cipher := c.cipher
+		c.mu.RUnlock()
+		return c.seal(data, cipher, info.sendKey, info.sendID)
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	ring, ok := c.keys[types.GetCookie(ctx, Key)]
 	if !ok {
 		return data, errors.New("read session key failed")
 	}
-	data, err := c.aes.Encrypt(data, pass)
-	return data, err
+	if c.legacy {
+		return c.aes.Encrypt(data, ring.keys[ring.current].key)
+	}
+	return c.seal(data, c.cipher, ring.keys[ring.current].key, ring.current)
+}
+
+// seal encrypts data by the key of id with the cipher.
+func (c *cryptoPlugin) seal(data []byte, cipher Cipher, key []byte, id uint32) ([]byte, error) {
+	aead, ok := c.aeads[cipher]
+	if !ok {
+		return nil, errUnknownCipher
+	}
+	header := make([]byte, headerLen)
+	header[0] = byte(cipher)
+	binary.BigEndian.PutUint32(header[1:], id)
+	sealed, err := aead.Seal(data, key, header)
+	if err != nil {
+		return nil, err
+	}
+	return append(header, sealed...), nil
+}
+
+// open decrypts data by the key of its id returned by key.
+func (c *cryptoPlugin) open(data []byte, key func(id uint32) []byte) ([]byte, error) {
+	if len(data) < headerLen {
+		return nil, errMalformedMessage
+	}
+	aead, ok := c.aeads[Cipher(data[0])]
+	if !ok {
+		return nil, errUnknownCipher
+	}
+	k := key(binary.BigEndian.Uint32(data[1:headerLen]))
+	if k == nil {
+		return nil, errUnknownKey
+	}
+	return aead.Open(data[headerLen:], k, data[:headerLen])
 }
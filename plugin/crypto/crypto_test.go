@@ -1 +1,173 @@
 package crypto_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"x.io/xrpc"
+	"x.io/xrpc/pkg/credentials"
+	pkgcrypto "x.io/xrpc/pkg/crypto"
+	xnet "x.io/xrpc/pkg/net"
+	"x.io/xrpc/pkg/peer"
+	"x.io/xrpc/plugin/crypto"
+	"x.io/xrpc/types"
+
+	"github.com/stretchr/testify/assert"
+	_ "x.io/xrpc/pkg/encoding/gzip"
+	_ "x.io/xrpc/pkg/encoding/proto"
+	greeter_pb "x.io/xrpc/protocol/greeter"
+)
+
+const handshakeAddr = "localhost:9920"
+
+// handshake runs the handshakes of the client and the server over a pipe.
+func handshake(client, server *crypto.Handshake) (clientInfo, serverInfo credentials.AuthInfo, clientErr, serverErr error) {
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+	done := make(chan struct{})
+	go func() {
+		serverInfo, serverErr = server.ServerHandshake(s)
+		s.Close()
+		close(done)
+	}()
+	clientInfo, clientErr = client.ClientHandshake(context.Background(), c)
+	c.Close()
+	<-done
+	return
+}
+
+func withPeer(info credentials.AuthInfo) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{HandshakeInfo: info})
+}
+
+func TestHandshake(t *testing.T) {
+	clientInfo, serverInfo, err, serverErr := handshake(crypto.NewHandshake(nil), crypto.NewHandshake(nil))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, serverErr)
+	assert.Equal(t, "ecdh", clientInfo.AuthType())
+	assert.Equal(t, []byte(nil), serverInfo.(*crypto.SessionInfo).PeerIdentity)
+
+	// the messages are encrypted by the keys agreed, one per direction
+	p := crypto.New()
+	msg := []byte("hello")
+	data, err := p.PreWriteResponse(withPeer(clientInfo), msg)
+	assert.Equal(t, nil, err)
+	assert.NotEqual(t, msg, data)
+	plain, err := p.PreReadRequest(withPeer(serverInfo), data)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, msg, plain)
+	data, err = p.PreWriteResponse(withPeer(serverInfo), msg)
+	assert.Equal(t, nil, err)
+	plain, err = p.PreReadRequest(withPeer(clientInfo), data)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, msg, plain)
+}
+
+func TestHandshakeIdentity(t *testing.T) {
+	serverID, clientID, otherID := pkgcrypto.RandomKeyPair(), pkgcrypto.RandomKeyPair(), pkgcrypto.RandomKeyPair()
+	server := crypto.NewHandshake(serverID, clientID.PublicKey)
+
+	clientInfo, serverInfo, err, serverErr := handshake(crypto.NewHandshake(clientID, serverID.PublicKey), server)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, serverErr)
+	assert.Equal(t, []byte(serverID.PublicKey), clientInfo.(*crypto.SessionInfo).PeerIdentity)
+	assert.Equal(t, []byte(clientID.PublicKey), serverInfo.(*crypto.SessionInfo).PeerIdentity)
+
+	// the server rejects the untrusted and the anonymous clients
+	for _, id := range []*pkgcrypto.KeyPair{otherID, nil} {
+		_, _, _, serverErr = handshake(crypto.NewHandshake(id), server)
+		assert.NotEqual(t, nil, serverErr)
+	}
+	// the client rejects the server which is not trusted
+	_, _, err, _ = handshake(crypto.NewHandshake(clientID, otherID.PublicKey), server)
+	assert.NotEqual(t, nil, err)
+}
+
+type greeter struct {
+	greeter_pb.UnimplementedGreeterServer
+}
+
+func (g *greeter) SayHello(ctx context.Context, req *greeter_pb.HelloRequest) (*greeter_pb.HelloReply, error) {
+	return &greeter_pb.HelloReply{Message: "hello " + req.Name}, nil
+}
+
+func TestHandshakeSession(t *testing.T) {
+	lis, err := xnet.Listen(context.Background(), xnet.TCP, handshakeAddr)
+	assert.Equal(t, nil, err)
+	s := xrpc.NewServer(xrpc.Handshaker(crypto.NewHandshake(nil)))
+	s.ApplyPlugins(crypto.New())
+	greeter_pb.RegisterGreeterServer(s, &greeter{})
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := xrpc.Dial(xnet.TCP, handshakeAddr, xrpc.WithInsecure(), xrpc.WithHandshaker(crypto.NewHandshake(nil)))
+	assert.Equal(t, nil, err)
+	defer conn.Close()
+	conn.ApplyPlugins(crypto.New())
+	r, err := greeter_pb.NewGreeterClient(conn).SayHello(context.Background(), &greeter_pb.HelloRequest{Name: "ecdh"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "hello ecdh", r.GetMessage())
+}
+
+func TestCryptoKeyRotation(t *testing.T) {
+	ctx := types.SetCookie(context.Background(), crypto.Key, "node")
+	client, server := crypto.New(), crypto.New()
+	for _, p := range []interface{ SetKey(key, pass string) }{client, server} {
+		p.SetKey("node", "old")
+	}
+	server.SetRolloverWindow(100 * time.Millisecond)
+	roundTrip := func(from, to interface {
+		PreWriteResponse(context.Context, []byte) ([]byte, error)
+		PreReadRequest(context.Context, []byte) ([]byte, error)
+	}) error {
+		data, err := from.PreWriteResponse(ctx, []byte("hello"))
+		if err != nil {
+			return err
+		}
+		_, err = to.PreReadRequest(ctx, data)
+		return err
+	}
+
+	// the same message is encrypted differently and tampering is detected
+	a, _ := client.PreWriteResponse(ctx, []byte("hello"))
+	b, _ := client.PreWriteResponse(ctx, []byte("hello"))
+	assert.NotEqual(t, a, b)
+	a[len(a)-1] ^= 1
+	_, err := server.PreReadRequest(ctx, a)
+	assert.NotEqual(t, nil, err)
+
+	// the new key is added everywhere before it is used
+	client.AddKey("node", "new")
+	server.AddKey("node", "new")
+	server.SetKey("node", "new")
+	assert.Equal(t, nil, roundTrip(server, client))
+	// the old key is accepted within the rollover window only
+	assert.Equal(t, nil, roundTrip(client, server))
+	time.Sleep(200 * time.Millisecond)
+	assert.NotEqual(t, nil, roundTrip(client, server))
+	client.SetKey("node", "new")
+	assert.Equal(t, nil, roundTrip(client, server))
+
+	// the ciphers of the peers may differ
+	client.SetCipher(crypto.ChaCha20Poly1305)
+	assert.Equal(t, nil, roundTrip(client, server))
+}
+
+func TestCryptoLegacyCBC(t *testing.T) {
+	ctx := types.SetCookie(context.Background(), crypto.Key, "node")
+	p := crypto.New()
+	p.SetKey("node", "pass")
+	p.SetLegacyCBC(true)
+	a, err := p.PreWriteResponse(ctx, []byte("hello"))
+	assert.Equal(t, nil, err)
+	b, _ := p.PreWriteResponse(ctx, []byte("hello"))
+	assert.Equal(t, a, b)
+	plain, err := p.PreReadRequest(ctx, a)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []byte("hello"), plain)
+	_, err = p.PreReadRequest(ctx, []byte("malformed"))
+	assert.NotEqual(t, nil, err)
+}
@@ -0,0 +1,221 @@
+package crypto
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"x.io/xrpc/pkg/credentials"
+	"x.io/xrpc/pkg/crypto"
+	"x.io/xrpc/pkg/crypto/ecdh"
+)
+
+const (
+	handshakeVersion = 1
+	helloLen         = 1 + ecdh.KeySize
+	proofLen         = crypto.PublicKeySize + crypto.SignatureSize
+
+	roleClient = "client"
+	roleServer = "server"
+)
+
+var (
+	errHandshakeVersion  = errors.New("crypto: unknown handshake version")
+	errInvalidPublicKey  = errors.New("crypto: invalid ephemeral public key")
+	errInvalidSignature  = errors.New("crypto: invalid identity signature")
+	errUntrustedIdentity = errors.New("crypto: untrusted identity")
+)
+
+// SessionInfo is the HandshakeInfo of a session set up by the Handshake, it
+// holds the keys of the session.
+type SessionInfo struct {
+	// PeerIdentity is the Ed25519 public key of the peer, nil if the peer
+	// is anonymous.
+	PeerIdentity []byte
+
+	// sendKey encrypts the messages sent and recvKey decrypts the messages
+	// received, the ids name them in the messages.
+	sendKey []byte
+	recvKey []byte
+	sendID  uint32
+	recvID  uint32
+}
+
+// AuthType returns "ecdh".
+func (s *SessionInfo) AuthType() string {
+	return "ecdh"
+}
+
+// Handshake is the ECDH handshake of the sessions, both sides exchange
+// ephemeral curve25519 public keys right after the Preface and derive the
+// keys of the session from the shared secret, so the keys are never
+// distributed. Each side may sign the handshake with its Ed25519 identity.
+//
+// The handshake is used by the server and the client:
+//
+//	s := xrpc.NewServer(xrpc.Handshaker(crypto.NewHandshake(nil)))
+//	s.ApplyPlugins(crypto.New())
+//
+//	cc, err := xrpc.Dial("tcp", addr, xrpc.WithHandshaker(crypto.NewHandshake(nil)))
+//	cc.ApplyPlugins(crypto.New())
+type Handshake struct {
+	identity *crypto.KeyPair
+	trusted  [][]byte
+	blake2b  *crypto.Blake2b
+}
+
+// NewHandshake returns the handshake signed by identity, which is anonymous
+// if identity is nil. The peers must be signed by one of the trusted Ed25519
+// public keys, any peer is accepted if there is none.
+func NewHandshake(identity *crypto.KeyPair, trusted ...[]byte) *Handshake {
+	return &Handshake{identity: identity, trusted: trusted, blake2b: crypto.NewBlake2b()}
+}
+
+// ClientHandshake does the handshake of the client on conn.
+func (h *Handshake) ClientHandshake(ctx context.Context, conn net.Conn) (credentials.AuthInfo, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	return h.handshake(conn, roleClient)
+}
+
+// ServerHandshake does the handshake of the server on conn.
+func (h *Handshake) ServerHandshake(conn net.Conn) (credentials.AuthInfo, error) {
+	return h.handshake(conn, roleServer)
+}
+
+// handshake exchanges the ephemeral public keys and the proofs of the
+// identities, which sign the transcript of both the keys and the role:
+//
+//	client -> server: version, client key
+//	server -> client: version, server key, server proof
+//	client -> server: client proof
+func (h *Handshake) handshake(conn net.Conn, role string) (*SessionInfo, error) {
+	prv, err := ecdh.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	hello := append([]byte{handshakeVersion}, prv.Public().ToBytes()...)
+	peerHello := make([]byte, helloLen)
+	var transcript []byte
+	if role == roleClient {
+		if _, err = conn.Write(hello); err != nil {
+			return nil, err
+		}
+		if err = readHello(conn, peerHello); err != nil {
+			return nil, err
+		}
+		transcript = newTranscript(hello, peerHello)
+	} else {
+		if err = readHello(conn, peerHello); err != nil {
+			return nil, err
+		}
+		transcript = newTranscript(peerHello, hello)
+		if _, err = conn.Write(append(hello, h.proof(transcript, role)...)); err != nil {
+			return nil, err
+		}
+	}
+	peerPub, err := ecdh.PublicFromBytes(peerHello[1:])
+	if err != nil {
+		return nil, err
+	}
+	peerRole := roleServer
+	if role == roleServer {
+		peerRole = roleClient
+	}
+	peerProof := make([]byte, proofLen)
+	if _, err = io.ReadFull(conn, peerProof); err != nil {
+		return nil, err
+	}
+	peerIdentity, err := h.verify(peerProof, transcript, peerRole)
+	if err != nil {
+		return nil, err
+	}
+	if role == roleClient {
+		if _, err = conn.Write(h.proof(transcript, role)); err != nil {
+			return nil, err
+		}
+	}
+
+	secret := prv.ComputeSecret(peerPub)
+	if bytes.Equal(secret, make([]byte, len(secret))) {
+		// a low order point of the peer
+		return nil, errInvalidPublicKey
+	}
+	info := &SessionInfo{
+		PeerIdentity: peerIdentity,
+		sendKey:      h.deriveKey(secret, transcript, role),
+		recvKey:      h.deriveKey(secret, transcript, peerRole),
+	}
+	info.sendID, info.recvID = keyID(info.sendKey), keyID(info.recvKey)
+	return info, nil
+}
+
+// readHello reads the hello of the peer into b and checks its version.
+func readHello(conn net.Conn, b []byte) error {
+	if _, err := io.ReadFull(conn, b); err != nil {
+		return err
+	}
+	if b[0] != handshakeVersion {
+		return errHandshakeVersion
+	}
+	return nil
+}
+
+// newTranscript returns the transcript of the hellos of the client and the
+// server.
+func newTranscript(clientHello, serverHello []byte) []byte {
+	const label = "xrpc/ecdh"
+	t := make([]byte, 0, len(label)+len(clientHello)+len(serverHello))
+	return append(append(append(t, label...), clientHello...), serverHello...)
+}
+
+// proof returns the identity and its signature of the transcript and role,
+// they are zero if the handshake is anonymous.
+func (h *Handshake) proof(transcript []byte, role string) []byte {
+	proof := make([]byte, proofLen)
+	if h.identity != nil {
+		copy(proof, h.identity.PublicKey)
+		sig := crypto.Ed25519Sign(h.identity.PrivateKey, h.blake2b.HashBytes(withRole(transcript, role)))
+		copy(proof[crypto.PublicKeySize:], sig)
+	}
+	return proof
+}
+
+// verify returns the identity of the peer proof, nil if it is anonymous.
+func (h *Handshake) verify(proof, transcript []byte, role string) ([]byte, error) {
+	identity, sig := proof[:crypto.PublicKeySize], proof[crypto.PublicKeySize:]
+	if bytes.Equal(identity, make([]byte, crypto.PublicKeySize)) {
+		if len(h.trusted) > 0 {
+			return nil, errUntrustedIdentity
+		}
+		return nil, nil
+	}
+	if !crypto.Ed25519Verify(identity, h.blake2b.HashBytes(withRole(transcript, role)), sig) {
+		return nil, errInvalidSignature
+	}
+	if len(h.trusted) == 0 {
+		return identity, nil
+	}
+	for _, t := range h.trusted {
+		if bytes.Equal(t, identity) {
+			return identity, nil
+		}
+	}
+	return nil, errUntrustedIdentity
+}
+
+// withRole returns a copy of the transcript followed by role.
+func withRole(transcript []byte, role string) []byte {
+	b := make([]byte, 0, len(transcript)+len(role))
+	return append(append(b, transcript...), role...)
+}
+
+// deriveKey derives the key of the messages sent by role.
+func (h *Handshake) deriveKey(secret, transcript []byte, role string) []byte {
+	return h.blake2b.HashBytes(append(append([]byte{}, secret...), withRole(transcript, role)...))
+}
@@ -3,10 +3,13 @@ package plugin
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"plugin"
+	"sort"
 	"strconv"
 	"sync"
+	"sync/atomic"
 
 	"x.io/xrpc/api"
 	echo "x.io/xrpc/pkg/echo"
@@ -16,14 +19,31 @@ import (
 
 type Plugin interface{}
 
+const (
+	// PriorityTransport is the priority of the plugins which transform the
+	// payload on the wire, such as the crypto plugin. Their PreReadRequest
+	// runs before the plugins which inspect the payload, and their
+	// PreWriteResponse after them.
+	PriorityTransport = -100
+	// PriorityDefault is the priority of the plugins which declare none.
+	PriorityDefault = 0
+)
+
 //PluginContainer represents a plugin container that defines all methods to manage plugins.
 //And it also defines all extension points.
 type Container interface {
 	Start() error
 	Stop() error
 
+	// Add adds a plugin, the plugins run by their priorities, the lower
+	// first, then the order they are added. The outbound hooks, Disconnect,
+	// CloseStream, PreWriteResponse, PostWriteResponse and Stop, run in
+	// the reverse order.
 	Add(plugin Plugin)
+	AddWithPriority(plugin Plugin, priority int)
 	Remove(plugin Plugin)
+	// Chain returns the plugins in the order their inbound hooks run.
+	Chain() []Plugin
 
 	DoRegisterService(sd *types.ServiceDesc, ss interface{}) error
 	DoRegisterCustomService(sd *types.ServiceDesc, ss interface{}, metadata string) error
@@ -57,6 +77,11 @@ type (
 		Stop() error
 	}
 
+	// PriorityPlugin declares the priority the plugin is added with.
+	PriorityPlugin interface {
+		Priority() int
+	}
+
 	RegisterServicePlugin interface {
 		RegisterService(sd *types.ServiceDesc, ss interface{}) error
 	}
@@ -129,22 +154,9 @@ type (
 
 func NewPluginContainer() Container {
 	pc := &pluginContainer{
-		plugins: map[Plugin]bool{},
-		rsp:     map[RegisterServicePlugin]bool{},
-		rcsp:    map[RegisterCustomServicePlugin]bool{},
-		rfp:     map[RegisterFunctionPlugin]bool{},
-		cp:      map[ConnectPlugin]bool{},
-		dp:      map[DisconnectPlugin]bool{},
-		osp:     map[OpenStreamPlugin]bool{},
-		csp:     map[CloseStreamPlugin]bool{},
-		prrp:    map[PreReadRequestPlugin]bool{},
-		porrp:   map[PostReadRequestPlugin]bool{},
-		inp:     map[InterceptPlugin]bool{},
-		pwrp:    map[PreWriteResponsePlugin]bool{},
-		powrp:   map[PostWriteResponsePlugin]bool{},
-
 		mu: &sync.Mutex{},
 	}
+	pc.chain.Store(&chain{})
 	api.Register(pc)
 	return pc
 }
@@ -153,28 +165,47 @@ func NewIOPluginContainer() IOContainer {
 	return NewPluginContainer()
 }
 
+// entry is a plugin added to the container.
+type entry struct {
+	plugin   Plugin
+	priority int
+}
+
+// chain is the plugins and their hooks in the resolved order, it is rebuilt
+// when a plugin is added or removed and never changes after.
+type chain struct {
+	entries []entry
+
+	rsp   []RegisterServicePlugin
+	rcsp  []RegisterCustomServicePlugin
+	rfp   []RegisterFunctionPlugin
+	cp    []ConnectPlugin
+	dp    []DisconnectPlugin
+	osp   []OpenStreamPlugin
+	csp   []CloseStreamPlugin
+	prrp  []PreReadRequestPlugin
+	porrp []PostReadRequestPlugin
+	inp   []InterceptPlugin
+	pwrp  []PreWriteResponsePlugin
+	powrp []PostWriteResponsePlugin
+}
+
 // pluginContainer implements PluginContainer interface.
 type pluginContainer struct {
-	plugins map[Plugin]bool
-	rsp     map[RegisterServicePlugin]bool
-	rcsp    map[RegisterCustomServicePlugin]bool
-	rfp     map[RegisterFunctionPlugin]bool
-	cp      map[ConnectPlugin]bool
-	dp      map[DisconnectPlugin]bool
-	osp     map[OpenStreamPlugin]bool
-	csp     map[CloseStreamPlugin]bool
-	prrp    map[PreReadRequestPlugin]bool
-	porrp   map[PostReadRequestPlugin]bool
-	inp     map[InterceptPlugin]bool
-	pwrp    map[PreWriteResponsePlugin]bool
-	powrp   map[PostWriteResponsePlugin]bool
+	// entries is the plugins in the order they are added, mu guards it.
+	entries []entry
+	chain   atomic.Value
 
 	mu *sync.Mutex
 }
 
+func (pc *pluginContainer) load() *chain {
+	return pc.chain.Load().(*chain)
+}
+
 func (pc *pluginContainer) Start() (err error) {
-	for plugin := range pc.plugins {
-		if pp, ok := plugin.(StartPlugin); ok {
+	for _, e := range pc.load().entries {
+		if pp, ok := e.plugin.(StartPlugin); ok {
 			err = pp.Start()
 			if err != nil {
 				return
@@ -184,9 +215,11 @@ func (pc *pluginContainer) Start() (err error) {
 	return
 }
 
+// Stop stops the plugins in the reverse order of Start.
 func (pc *pluginContainer) Stop() (err error) {
-	for plugin := range pc.plugins {
-		if pp, ok := plugin.(StopPlugin); ok {
+	entries := pc.load().entries
+	for i := len(entries) - 1; i >= 0; i-- {
+		if pp, ok := entries[i].plugin.(StopPlugin); ok {
 			err = pp.Stop()
 			if err != nil {
 				return
@@ -196,54 +229,38 @@ func (pc *pluginContainer) Stop() (err error) {
 	return
 }
 
-// Add adds a plugin.
+// Add adds a plugin, with the priority it declares by PriorityPlugin or
+// PriorityDefault.
 func (pc *pluginContainer) Add(plugin Plugin) {
+	priority := PriorityDefault
+	if p, ok := plugin.(PriorityPlugin); ok {
+		priority = p.Priority()
+	}
+	pc.AddWithPriority(plugin, priority)
+}
+
+// AddWithPriority adds a plugin with priority. Adding a plugin again updates
+// its priority and keeps its place among the plugins of the same priority.
+func (pc *pluginContainer) AddWithPriority(plugin Plugin, priority int) {
 	if plugin == nil {
 		return
 	}
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
 
-	pc.plugins[plugin] = true
+	for i := range pc.entries {
+		if pc.entries[i].plugin == plugin {
+			pc.entries[i].priority = priority
+			pc.resolveLocked()
+			return
+		}
+	}
+	pc.entries = append(pc.entries, entry{plugin: plugin, priority: priority})
+	pc.resolveLocked()
 
 	if p, ok := plugin.(api.APIer); ok {
 		api.Register(p)
 	}
-
-	if p, ok := plugin.(RegisterServicePlugin); ok {
-		pc.rsp[p] = true
-	}
-	if p, ok := plugin.(RegisterCustomServicePlugin); ok {
-		pc.rcsp[p] = true
-	}
-	if p, ok := plugin.(RegisterFunctionPlugin); ok {
-		pc.rfp[p] = true
-	}
-	if p, ok := plugin.(ConnectPlugin); ok {
-		pc.cp[p] = true
-	}
-	if p, ok := plugin.(DisconnectPlugin); ok {
-		pc.dp[p] = true
-	}
-	if p, ok := plugin.(OpenStreamPlugin); ok {
-		pc.osp[p] = true
-	}
-	if p, ok := plugin.(CloseStreamPlugin); ok {
-		pc.csp[p] = true
-	}
-	if p, ok := plugin.(PreReadRequestPlugin); ok {
-		pc.prrp[p] = true
-	}
-	if p, ok := plugin.(PostReadRequestPlugin); ok {
-		pc.porrp[p] = true
-	}
-	if p, ok := plugin.(InterceptPlugin); ok {
-		pc.inp[p] = true
-	}
-	if p, ok := plugin.(PreWriteResponsePlugin); ok {
-		pc.pwrp[p] = true
-	}
-	if p, ok := plugin.(PostWriteResponsePlugin); ok {
-		pc.powrp[p] = true
-	}
 }
 
 // Remove removes a plugin by it's name.
@@ -251,49 +268,86 @@ func (pc *pluginContainer) Remove(plugin Plugin) {
 	if plugin == nil {
 		return
 	}
-	delete(pc.plugins, plugin)
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
 
-	if p, ok := plugin.(RegisterServicePlugin); ok {
-		delete(pc.rsp, p)
-	}
-	if p, ok := plugin.(RegisterCustomServicePlugin); ok {
-		delete(pc.rcsp, p)
-	}
-	if p, ok := plugin.(RegisterFunctionPlugin); ok {
-		delete(pc.rfp, p)
-	}
-	if p, ok := plugin.(ConnectPlugin); ok {
-		delete(pc.cp, p)
-	}
-	if p, ok := plugin.(DisconnectPlugin); ok {
-		delete(pc.dp, p)
-	}
-	if p, ok := plugin.(OpenStreamPlugin); ok {
-		delete(pc.osp, p)
-	}
-	if p, ok := plugin.(CloseStreamPlugin); ok {
-		delete(pc.csp, p)
-	}
-	if p, ok := plugin.(PreReadRequestPlugin); ok {
-		delete(pc.prrp, p)
-	}
-	if p, ok := plugin.(PostReadRequestPlugin); ok {
-		delete(pc.porrp, p)
+	for i := range pc.entries {
+		if pc.entries[i].plugin == plugin {
+			pc.entries = append(pc.entries[:i:i], pc.entries[i+1:]...)
+			pc.resolveLocked()
+			return
+		}
 	}
-	if p, ok := plugin.(InterceptPlugin); ok {
-		delete(pc.inp, p)
+}
+
+// Chain returns the plugins in the order their inbound hooks run.
+func (pc *pluginContainer) Chain() []Plugin {
+	entries := pc.load().entries
+	plugins := make([]Plugin, len(entries))
+	for i, e := range entries {
+		plugins[i] = e.plugin
 	}
-	if p, ok := plugin.(PreWriteResponsePlugin); ok {
-		delete(pc.pwrp, p)
+	return plugins
+}
+
+// resolveLocked sorts the plugins by their priorities, then the order they
+// are added, and rebuilds the hooks. The outbound hooks run in the reverse
+// order, so the last plugin to see the inbound data is the first to see the
+// outbound data.
+func (pc *pluginContainer) resolveLocked() {
+	entries := append([]entry(nil), pc.entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].priority < entries[j].priority
+	})
+	c := &chain{entries: entries}
+	for _, e := range entries {
+		plugin := e.plugin
+		if p, ok := plugin.(RegisterServicePlugin); ok {
+			c.rsp = append(c.rsp, p)
+		}
+		if p, ok := plugin.(RegisterCustomServicePlugin); ok {
+			c.rcsp = append(c.rcsp, p)
+		}
+		if p, ok := plugin.(RegisterFunctionPlugin); ok {
+			c.rfp = append(c.rfp, p)
+		}
+		if p, ok := plugin.(ConnectPlugin); ok {
+			c.cp = append(c.cp, p)
+		}
+		if p, ok := plugin.(OpenStreamPlugin); ok {
+			c.osp = append(c.osp, p)
+		}
+		if p, ok := plugin.(PreReadRequestPlugin); ok {
+			c.prrp = append(c.prrp, p)
+		}
+		if p, ok := plugin.(PostReadRequestPlugin); ok {
+			c.porrp = append(c.porrp, p)
+		}
+		if p, ok := plugin.(InterceptPlugin); ok {
+			c.inp = append(c.inp, p)
+		}
 	}
-	if p, ok := plugin.(PostWriteResponsePlugin); ok {
-		delete(pc.powrp, p)
+	for i := len(entries) - 1; i >= 0; i-- {
+		plugin := entries[i].plugin
+		if p, ok := plugin.(DisconnectPlugin); ok {
+			c.dp = append(c.dp, p)
+		}
+		if p, ok := plugin.(CloseStreamPlugin); ok {
+			c.csp = append(c.csp, p)
+		}
+		if p, ok := plugin.(PreWriteResponsePlugin); ok {
+			c.pwrp = append(c.pwrp, p)
+		}
+		if p, ok := plugin.(PostWriteResponsePlugin); ok {
+			c.powrp = append(c.powrp, p)
+		}
 	}
+	pc.chain.Store(c)
 }
 
 func (pc *pluginContainer) DoRegisterService(sd *types.ServiceDesc, ss interface{}) error {
 	var err error
-	for p := range pc.rsp {
+	for _, p := range pc.load().rsp {
 		err = p.RegisterService(sd, ss)
 		if err != nil {
 			break
@@ -304,7 +358,7 @@ func (pc *pluginContainer) DoRegisterService(sd *types.ServiceDesc, ss interface
 
 func (pc *pluginContainer) DoRegisterCustomService(sd *types.ServiceDesc, ss interface{}, metadata string) error {
 	var err error
-	for p := range pc.rcsp {
+	for _, p := range pc.load().rcsp {
 		err = p.RegisterCustomService(sd, ss, metadata)
 		if err != nil {
 			break
@@ -315,7 +369,7 @@ func (pc *pluginContainer) DoRegisterCustomService(sd *types.ServiceDesc, ss int
 
 func (pc *pluginContainer) DoRegisterFunction(serviceName, fname string, fn interface{}, metadata string) error {
 	var err error
-	for p := range pc.rfp {
+	for _, p := range pc.load().rfp {
 		err = p.RegisterFunction(serviceName, fname, fn, metadata)
 		if err != nil {
 			break
@@ -325,8 +379,8 @@ func (pc *pluginContainer) DoRegisterFunction(serviceName, fname string, fn inte
 }
 
 func (pc *pluginContainer) DoConnect(conn net.Conn) (net.Conn, bool) {
-	var ok bool
-	for p := range pc.cp {
+	ok := true
+	for _, p := range pc.load().cp {
 		conn, ok = p.Connect(conn)
 		if !ok {
 			break
@@ -337,7 +391,7 @@ func (pc *pluginContainer) DoConnect(conn net.Conn) (net.Conn, bool) {
 
 func (pc *pluginContainer) DoDisconnect(conn net.Conn) bool {
 	var ok bool
-	for p := range pc.dp {
+	for _, p := range pc.load().dp {
 		ok = p.Disconnect(conn)
 		if !ok {
 			break
@@ -348,7 +402,7 @@ func (pc *pluginContainer) DoDisconnect(conn net.Conn) bool {
 
 func (pc *pluginContainer) DoOpenStream(ctx context.Context, conn net.Conn) (context.Context, error) {
 	var err error
-	for p := range pc.osp {
+	for _, p := range pc.load().osp {
 		ctx, err = p.OpenStream(ctx, conn)
 		if err != nil {
 			break
@@ -359,7 +413,7 @@ func (pc *pluginContainer) DoOpenStream(ctx context.Context, conn net.Conn) (con
 
 func (pc *pluginContainer) DoCloseStream(ctx context.Context, conn net.Conn) (context.Context, error) {
 	var err error
-	for p := range pc.csp {
+	for _, p := range pc.load().csp {
 		ctx, err = p.CloseStream(ctx, conn)
 		if err != nil {
 			break
@@ -370,7 +424,7 @@ func (pc *pluginContainer) DoCloseStream(ctx context.Context, conn net.Conn) (co
 
 func (pc *pluginContainer) DoPreReadRequest(ctx context.Context, data []byte) ([]byte, error) {
 	var err error
-	for p := range pc.prrp {
+	for _, p := range pc.load().prrp {
 		data, err = p.PreReadRequest(ctx, data)
 		if err != nil {
 			break
@@ -380,19 +434,21 @@ func (pc *pluginContainer) DoPreReadRequest(ctx context.Context, data []byte) ([
 }
 
 func (pc *pluginContainer) DoPostReadRequest(ctx context.Context, r interface{}, e error) error {
-	var err error
-	for p := range pc.porrp {
-		err = p.PostReadRequest(ctx, r, e)
-		if err != nil {
-			break
+	// the plugins observe e, an error of a plugin replaces it
+	for _, p := range pc.load().porrp {
+		if err := p.PostReadRequest(ctx, r, e); err != nil {
+			return err
 		}
 	}
-	return err
+	return e
 }
 
+// DoIntercept calls the handler through the interceptors, the first one in
+// the chain is the outermost.
 func (pc *pluginContainer) DoIntercept(ctx context.Context, req interface{}, info *types.UnaryServerInfo, handler types.UnaryHandler) (resp interface{}, err error) {
-	if len(pc.inp) == 0 {
-		return
+	inp := pc.load().inp
+	if len(inp) == 0 {
+		return handler(ctx, req)
 	}
 	chain := func(in Interceptor, handler types.UnaryHandler) types.UnaryHandler {
 		return func(ctx context.Context, req interface{}) (resp interface{}, err error) {
@@ -400,15 +456,15 @@ func (pc *pluginContainer) DoIntercept(ctx context.Context, req interface{}, inf
 		}
 	}
 	chainHandler := handler
-	for in := range pc.inp {
-		chainHandler = chain(in.Intercept, chainHandler)
+	for i := len(inp) - 1; i >= 0; i-- {
+		chainHandler = chain(inp[i].Intercept, chainHandler)
 	}
 	return chainHandler(ctx, req)
 }
 
 func (pc *pluginContainer) DoPreWriteResponse(ctx context.Context, data []byte) ([]byte, error) {
 	var err error
-	for p := range pc.pwrp {
+	for _, p := range pc.load().pwrp {
 		data, err = p.PreWriteResponse(ctx, data)
 		if err != nil {
 			break
@@ -418,14 +474,13 @@ func (pc *pluginContainer) DoPreWriteResponse(ctx context.Context, data []byte)
 }
 
 func (pc *pluginContainer) DoPostWriteResponse(ctx context.Context, req interface{}, resp interface{}, e error) error {
-	var err error
-	for p := range pc.powrp {
-		err = p.PostWriteResponse(ctx, req, resp, e)
-		if err != nil {
-			break
+	// the plugins observe e, an error of a plugin replaces it
+	for _, p := range pc.load().powrp {
+		if err := p.PostWriteResponse(ctx, req, resp, e); err != nil {
+			return err
 		}
 	}
-	return err
+	return e
 }
 
 func (pc *pluginContainer) RegisterAPI(e *echo.Echo) {
@@ -434,7 +489,19 @@ func (pc *pluginContainer) RegisterAPI(e *echo.Echo) {
 		return c.String(http.StatusOK, "plugin contains api is working")
 	})
 	g.GET("/count", func(c echo.Context) error {
-		return c.String(http.StatusOK, strconv.Itoa(len(pc.plugins)))
+		return c.String(http.StatusOK, strconv.Itoa(len(pc.load().entries)))
+	})
+	g.GET("/chain", func(c echo.Context) error {
+		type link struct {
+			Plugin   string `json:"plugin"`
+			Priority int    `json:"priority"`
+		}
+		entries := pc.load().entries
+		links := make([]link, len(entries))
+		for i, e := range entries {
+			links[i] = link{Plugin: fmt.Sprintf("%T", e.plugin), Priority: e.priority}
+		}
+		return c.JSON(http.StatusOK, links)
 	})
 }
 
@@ -11,6 +11,7 @@ import (
 	"x.io/xrpc/plugin/prom"
 	"x.io/xrpc/types"
 
+	"github.com/stretchr/testify/assert"
 	_ "x.io/xrpc/plugin/blacklist"
 	_ "x.io/xrpc/plugin/chord"
 	_ "x.io/xrpc/plugin/crypto"
@@ -55,3 +56,59 @@ func TestPromPlugin(t *testing.T) {
 		pc.DoIntercept(ctx, nil, info, handler)
 	}
 }
+
+// orderPlugin records the hooks it runs.
+type orderPlugin struct {
+	name     string
+	priority int
+	calls    *[]string
+}
+
+func (p *orderPlugin) Priority() int {
+	return p.priority
+}
+
+func (p *orderPlugin) PreReadRequest(ctx context.Context, data []byte) ([]byte, error) {
+	*p.calls = append(*p.calls, "read "+p.name)
+	return data, nil
+}
+
+func (p *orderPlugin) PreWriteResponse(ctx context.Context, data []byte) ([]byte, error) {
+	*p.calls = append(*p.calls, "write "+p.name)
+	return data, nil
+}
+
+func (p *orderPlugin) Intercept(ctx context.Context, req interface{}, info *types.UnaryServerInfo, handler types.UnaryHandler) (interface{}, error) {
+	*p.calls = append(*p.calls, "intercept "+p.name)
+	return handler(ctx, req)
+}
+
+func TestPluginOrder(t *testing.T) {
+	var calls []string
+	a := &orderPlugin{name: "a", calls: &calls}
+	b := &orderPlugin{name: "b", calls: &calls}
+	c := &orderPlugin{name: "c", priority: plugin.PriorityTransport, calls: &calls}
+	pc := plugin.NewPluginContainer()
+	pc.Add(a)
+	pc.Add(b)
+	pc.Add(c)
+	assert.Equal(t, []plugin.Plugin{c, a, b}, pc.Chain())
+
+	pc.DoPreReadRequest(context.Background(), nil)
+	pc.DoIntercept(context.Background(), nil, nil, func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls = append(calls, "handler")
+		return nil, nil
+	})
+	pc.DoPreWriteResponse(context.Background(), nil)
+	assert.Equal(t, []string{
+		"read c", "read a", "read b",
+		"intercept c", "intercept a", "intercept b", "handler",
+		"write b", "write a", "write c",
+	}, calls)
+
+	// the explicit priority overrides the declared one
+	pc.AddWithPriority(b, -200)
+	assert.Equal(t, []plugin.Plugin{b, c, a}, pc.Chain())
+	pc.Remove(c)
+	assert.Equal(t, []plugin.Plugin{b, a}, pc.Chain())
+}
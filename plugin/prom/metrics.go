@@ -32,6 +32,13 @@ func newDefaultMetrics(point EndPoint, labels map[string]string) *DefaultMetrics
 					Help:        "Gauge of response latency (seconds) of xrpc that had been application-level handled by the client.",
 					ConstLabels: labels,
 				}),
+			attemptsHistogram: prometheus.NewHistogramVec(
+				prometheus.HistogramOpts{
+					Name:        "xrpc_client_attempts",
+					Help:        "Histogram of the number of attempts of xrpc, including the retries, made by the client.",
+					ConstLabels: labels,
+					Buckets:     []float64{1, 2, 3, 4, 5},
+				}, []string{"xrpc_type", "xrpc_service", "xrpc_method"}),
 		}
 	}
 	return &DefaultMetrics{
@@ -66,6 +73,8 @@ type DefaultMetrics struct {
 	handledGauge     *prometheus.GaugeVec
 	sampleCounter    prometheus.Counter
 	handledHistogram *prometheus.HistogramVec
+	// attemptsHistogram is only collected by the client
+	attemptsHistogram *prometheus.HistogramVec
 
 	enableDelay bool
 	constLabels map[string]string
@@ -111,6 +120,9 @@ func (dm *DefaultMetrics) Describe(ch chan<- *prometheus.Desc) {
 	dm.startedCounter.Describe(ch)
 	dm.handledCounter.Describe(ch)
 	dm.sampleCounter.Describe(ch)
+	if dm.attemptsHistogram != nil {
+		dm.attemptsHistogram.Describe(ch)
+	}
 	if dm.enableDelay {
 		dm.handledHistogram.Describe(ch)
 		dm.handledGauge.Describe(ch)
@@ -122,6 +134,9 @@ func (dm *DefaultMetrics) Collect(ch chan<- prometheus.Metric) {
 	dm.handledCounter.Collect(ch)
 	dm.sampleCounter.Inc()
 	dm.sampleCounter.Collect(ch)
+	if dm.attemptsHistogram != nil {
+		dm.attemptsHistogram.Collect(ch)
+	}
 	if dm.enableDelay {
 		dm.handledHistogram.Collect(ch)
 		dm.handledGauge.Collect(ch)
@@ -6,6 +6,7 @@ import (
 	"net"
 	"net/http"
 
+	"x.io/xrpc"
 	"x.io/xrpc/types"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -18,8 +19,17 @@ const (
 )
 
 func New(labels map[string]string, port ...int) *promPlugin {
+	return newPromPlugin(Server, labels, port...)
+}
+
+// NewClient 创建客户端的prom插件，通过UnaryClientInterceptor统计调用
+func NewClient(labels map[string]string, port ...int) *promPlugin {
+	return newPromPlugin(Client, labels, port...)
+}
+
+func newPromPlugin(point EndPoint, labels map[string]string, port ...int) *promPlugin {
 	p := &promPlugin{
-		metrics: newDefaultMetrics(Server, labels),
+		metrics: newDefaultMetrics(point, labels),
 	}
 	reg := prometheus.NewRegistry()
 	reg.MustRegister(p.metrics)
@@ -57,6 +67,16 @@ func (p *promPlugin) Intercept(ctx context.Context, req interface{}, info *types
 	return resp, err
 }
 
+// UnaryClientInterceptor 统计客户端的unary调用，包括重试的次数
+func (p *promPlugin) UnaryClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *xrpc.ClientConn, invoker xrpc.UnaryInvoker, opts ...xrpc.CallOption) error {
+	reporter := newDefaultReporter(p.metrics, "unary", method)
+	var attempts int
+	err := invoker(ctx, method, req, reply, cc, append(opts[:len(opts):len(opts)], xrpc.Attempts(&attempts))...)
+	reporter.Handled(codes.ErrorClass(err))
+	reporter.Attempted(attempts)
+	return err
+}
+
 // Start 在指定地址上开启prometheus http，未提供Gatherer的情况下使用默认Gatherer
 func (p *promPlugin) Start() error {
 	var gather prometheus.Gatherer = p.reg
@@ -54,3 +54,10 @@ func (r *defaultReporter) Handled(code string) {
 		r.metrics.handledGauge.WithLabelValues(r.rpcType, r.service, r.method).Set(delay)
 	}
 }
+
+// Attempted 记录客户端调用的尝试次数
+func (r *defaultReporter) Attempted(attempts int) {
+	if r.metrics.attemptsHistogram != nil && attempts > 0 {
+		r.metrics.attemptsHistogram.WithLabelValues(r.rpcType, r.service, r.method).Observe(float64(attempts))
+	}
+}
@@ -0,0 +1,218 @@
+package sign
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"x.io/xrpc"
+	"x.io/xrpc/pkg/codes"
+	"x.io/xrpc/pkg/crypto"
+	"x.io/xrpc/pkg/net"
+	"x.io/xrpc/pkg/status"
+)
+
+const (
+	// DefaultWindow is the time a signed request stays valid, the clocks of
+	// the client and the server may differ by it either way.
+	DefaultWindow = 30 * time.Second
+
+	signVersion = 1
+	nonceLen    = 16
+	// headerLen is the length of the header of the signed requests, all of
+	// it but the signature is signed along with the method and the hash of
+	// the payload:
+	//
+	//	[version 1][public key 32][timestamp 8][nonce 16][signature 64][payload]
+	headerLen = 1 + crypto.PublicKeySize + 8 + nonceLen + crypto.SignatureSize
+	signedLen = headerLen - crypto.SignatureSize
+)
+
+// Signer is the plugin of the client which signs the requests by its
+// Ed25519 identity:
+//
+//	cc.ApplyPlugins(sign.NewSigner(identity))
+type Signer struct {
+	identity *crypto.KeyPair
+	blake2b  *crypto.Blake2b
+}
+
+// NewSigner returns the Signer of identity.
+func NewSigner(identity *crypto.KeyPair) *Signer {
+	return &Signer{identity: identity, blake2b: crypto.NewBlake2b()}
+}
+
+// PreWriteResponse signs the request sent by the client.
+func (s *Signer) PreWriteResponse(ctx context.Context, data []byte) ([]byte, error) {
+	method, _ := xrpc.Method(ctx)
+	out := make([]byte, headerLen+len(data))
+	out[0] = signVersion
+	copy(out[1:], s.identity.PublicKey)
+	binary.BigEndian.PutUint64(out[1+crypto.PublicKeySize:], uint64(time.Now().UnixNano()))
+	if _, err := rand.Read(out[signedLen-nonceLen : signedLen]); err != nil {
+		return nil, err
+	}
+	copy(out[headerLen:], data)
+	sig := crypto.Ed25519Sign(s.identity.PrivateKey, digest(s.blake2b, method, out[:signedLen], data))
+	copy(out[signedLen:], sig)
+	return out, nil
+}
+
+// Caller is the client which signed the request.
+type Caller struct {
+	// Name is the name the public key is trusted by.
+	Name      string
+	PublicKey []byte
+}
+
+type callerKey struct{}
+
+// callerSlot holds the caller of the last request verified on a stream, the
+// handler context of the stream is created before its requests are read.
+type callerSlot struct {
+	mu     sync.Mutex
+	caller *Caller
+}
+
+// FromContext returns the caller of the request in the handler context of
+// the server, which has the Verifier applied.
+func FromContext(ctx context.Context) (*Caller, bool) {
+	slot, ok := ctx.Value(callerKey{}).(*callerSlot)
+	if !ok {
+		return nil, false
+	}
+	slot.mu.Lock()
+	defer slot.mu.Unlock()
+	return slot.caller, slot.caller != nil
+}
+
+// Verifier is the plugin of the server which verifies the requests signed
+// by the trusted keys, the stale and the replayed requests are rejected. The
+// handlers get the caller by FromContext:
+//
+//	v := sign.NewVerifier()
+//	v.AddTrustedKey("billing", billingPublicKey)
+//	s.ApplyPlugins(v)
+type Verifier struct {
+	blake2b *crypto.Blake2b
+
+	mu      sync.RWMutex
+	window  time.Duration
+	trusted map[string]string
+
+	// nonces are the nonces seen by the public keys, they are kept until
+	// their requests are stale.
+	nonceMu   sync.Mutex
+	nonces    map[string]time.Time
+	lastPurge time.Time
+}
+
+// NewVerifier returns the Verifier which trusts no key.
+func NewVerifier() *Verifier {
+	return &Verifier{
+		blake2b:   crypto.NewBlake2b(),
+		window:    DefaultWindow,
+		trusted:   map[string]string{},
+		nonces:    map[string]time.Time{},
+		lastPurge: time.Now(),
+	}
+}
+
+// AddTrustedKey trusts the Ed25519 public key of the client name.
+func (v *Verifier) AddTrustedKey(name string, publicKey []byte) {
+	v.mu.Lock()
+	v.trusted[string(publicKey)] = name
+	v.mu.Unlock()
+}
+
+// RemoveTrustedKey stops trusting the keys of the client name.
+func (v *Verifier) RemoveTrustedKey(name string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for k, n := range v.trusted {
+		if n == name {
+			delete(v.trusted, k)
+		}
+	}
+}
+
+// SetWindow sets the time a signed request stays valid, DefaultWindow by
+// default.
+func (v *Verifier) SetWindow(d time.Duration) {
+	v.mu.Lock()
+	v.window = d
+	v.mu.Unlock()
+}
+
+// OpenStream prepares the context of the stream for the callers of its
+// requests.
+func (v *Verifier) OpenStream(ctx context.Context, conn net.Conn) (context.Context, error) {
+	return context.WithValue(ctx, callerKey{}, &callerSlot{}), nil
+}
+
+// PreReadRequest verifies the request received by the server and strips its
+// signature, the caller is set on the context of the stream.
+func (v *Verifier) PreReadRequest(ctx context.Context, data []byte) ([]byte, error) {
+	if len(data) < headerLen || data[0] != signVersion {
+		return nil, status.Error(codes.Unauthenticated, "sign: malformed request")
+	}
+	publicKey := data[1 : 1+crypto.PublicKeySize]
+	v.mu.RLock()
+	name, ok := v.trusted[string(publicKey)]
+	window := v.window
+	v.mu.RUnlock()
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "sign: untrusted key")
+	}
+	payload := data[headerLen:]
+	method, _ := xrpc.Method(ctx)
+	if !crypto.Ed25519Verify(publicKey, digest(v.blake2b, method, data[:signedLen], payload), data[signedLen:headerLen]) {
+		return nil, status.Error(codes.Unauthenticated, "sign: invalid signature")
+	}
+	ts := time.Unix(0, int64(binary.BigEndian.Uint64(data[1+crypto.PublicKeySize:])))
+	now := time.Now()
+	if ts.Before(now.Add(-window)) || ts.After(now.Add(window)) {
+		return nil, status.Error(codes.Unauthenticated, "sign: stale request")
+	}
+	if !v.useNonce(string(data[1:signedLen]), ts.Add(window), now, window) {
+		return nil, status.Error(codes.Unauthenticated, "sign: replayed request")
+	}
+	if slot, ok := ctx.Value(callerKey{}).(*callerSlot); ok {
+		slot.mu.Lock()
+		slot.caller = &Caller{Name: name, PublicKey: append([]byte(nil), publicKey...)}
+		slot.mu.Unlock()
+	}
+	return payload, nil
+}
+
+// useNonce records the nonce until expiry, it returns false if the nonce has
+// been seen.
+func (v *Verifier) useNonce(nonce string, expiry, now time.Time, window time.Duration) bool {
+	v.nonceMu.Lock()
+	defer v.nonceMu.Unlock()
+	if now.Sub(v.lastPurge) > window {
+		for n, e := range v.nonces {
+			if now.After(e) {
+				delete(v.nonces, n)
+			}
+		}
+		v.lastPurge = now
+	}
+	if _, ok := v.nonces[nonce]; ok {
+		return false
+	}
+	v.nonces[nonce] = expiry
+	return true
+}
+
+// digest returns the hash signed for the request of method, header is the
+// signed part of its header.
+func digest(h *crypto.Blake2b, method string, header, payload []byte) []byte {
+	const label = "xrpc/sign"
+	b := make([]byte, 0, len(label)+len(method)+1+len(header)+h.Size())
+	b = append(append(append(b, label...), method...), 0)
+	b = append(append(b, header...), h.HashBytes(payload)...)
+	return h.HashBytes(b)
+}
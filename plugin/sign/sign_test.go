@@ -0,0 +1,104 @@
+package sign_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"x.io/xrpc"
+	"x.io/xrpc/pkg/codes"
+	pkgcrypto "x.io/xrpc/pkg/crypto"
+	xnet "x.io/xrpc/pkg/net"
+	"x.io/xrpc/pkg/status"
+	"x.io/xrpc/plugin/sign"
+
+	"github.com/stretchr/testify/assert"
+	_ "x.io/xrpc/pkg/encoding/gzip"
+	_ "x.io/xrpc/pkg/encoding/proto"
+	greeter_pb "x.io/xrpc/protocol/greeter"
+)
+
+const signAddr = "localhost:9921"
+
+func TestVerifier(t *testing.T) {
+	client, other := pkgcrypto.RandomKeyPair(), pkgcrypto.RandomKeyPair()
+	v := sign.NewVerifier()
+	v.AddTrustedKey("client", client.PublicKey)
+	ctx := context.Background()
+	signer := sign.NewSigner(client)
+
+	data, err := signer.PreWriteResponse(ctx, []byte("hello"))
+	assert.Equal(t, nil, err)
+	payload, err := v.PreReadRequest(ctx, data)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []byte("hello"), payload)
+
+	// the replayed, the tampered and the untrusted requests are rejected
+	_, err = v.PreReadRequest(ctx, data)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	data, _ = signer.PreWriteResponse(ctx, []byte("hello"))
+	data[len(data)-1] ^= 1
+	_, err = v.PreReadRequest(ctx, data)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	data, _ = sign.NewSigner(other).PreWriteResponse(ctx, []byte("hello"))
+	_, err = v.PreReadRequest(ctx, data)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = v.PreReadRequest(ctx, []byte("hello"))
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// the stale requests are rejected
+	v.SetWindow(100 * time.Millisecond)
+	data, _ = signer.PreWriteResponse(ctx, []byte("hello"))
+	time.Sleep(200 * time.Millisecond)
+	_, err = v.PreReadRequest(ctx, data)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	v.RemoveTrustedKey("client")
+	data, _ = signer.PreWriteResponse(ctx, []byte("hello"))
+	_, err = v.PreReadRequest(ctx, data)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+type greeter struct {
+	greeter_pb.UnimplementedGreeterServer
+}
+
+// SayHello replies with the name of the caller.
+func (g *greeter) SayHello(ctx context.Context, req *greeter_pb.HelloRequest) (*greeter_pb.HelloReply, error) {
+	caller, ok := sign.FromContext(ctx)
+	if !ok {
+		return &greeter_pb.HelloReply{Message: "anonymous"}, nil
+	}
+	return &greeter_pb.HelloReply{Message: "hello " + caller.Name}, nil
+}
+
+func TestSignedCall(t *testing.T) {
+	client, billing := pkgcrypto.RandomKeyPair(), pkgcrypto.RandomKeyPair()
+	v := sign.NewVerifier()
+	v.AddTrustedKey("client", client.PublicKey)
+	v.AddTrustedKey("billing", billing.PublicKey)
+	lis, err := xnet.Listen(context.Background(), xnet.TCP, signAddr)
+	assert.Equal(t, nil, err)
+	s := xrpc.NewServer()
+	s.ApplyPlugins(v)
+	greeter_pb.RegisterGreeterServer(s, &greeter{})
+	go s.Serve(lis)
+	defer s.Stop()
+
+	call := func(identity *pkgcrypto.KeyPair) (*greeter_pb.HelloReply, error) {
+		conn, err := xrpc.Dial(xnet.TCP, signAddr, xrpc.WithInsecure())
+		assert.Equal(t, nil, err)
+		defer conn.Close()
+		conn.ApplyPlugins(sign.NewSigner(identity))
+		return greeter_pb.NewGreeterClient(conn).SayHello(context.Background(), &greeter_pb.HelloRequest{Name: "sign"})
+	}
+	// the handlers get the names of the callers
+	r, err := call(client)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "hello client", r.GetMessage())
+	r, err = call(billing)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "hello billing", r.GetMessage())
+	_, err = call(pkgcrypto.RandomKeyPair())
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
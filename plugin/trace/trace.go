@@ -154,7 +154,7 @@ func SetSpanTags(span opentracing.Span, err error, server bool) {
 	if err == nil {
 		return
 	}
-	if !server || code == codes.ServerError {
+	if !server || code.ServerError() {
 		ext.Error.Set(span, true)
 	}
 }
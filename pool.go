@@ -0,0 +1,306 @@
+package xrpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"x.io/xrpc/pkg/codes"
+	"x.io/xrpc/pkg/connectivity"
+	"x.io/xrpc/pkg/net"
+	"x.io/xrpc/pkg/status"
+)
+
+// DefaultMaxIdle is the maximum number of the idle connections per target
+// of a Pool whose MaxIdle is not set.
+const DefaultMaxIdle = 2
+
+// ErrPoolClosed is returned by Get on a closed Pool.
+var ErrPoolClosed = errors.New("xrpc: the pool is closed")
+
+// PoolOptions configures a Pool.
+type PoolOptions struct {
+	// MaxIdle is the maximum number of the idle connections kept per target,
+	// DefaultMaxIdle if it is not positive.
+	MaxIdle int
+	// MaxActive is the maximum number of the connections per target, both
+	// checked out and idle, 0 means no limit. Get waits for a connection to
+	// be put back when the limit is reached.
+	MaxActive int
+	// IdleTimeout closes the connections idle for longer, 0 keeps them.
+	IdleTimeout time.Duration
+	// HealthCheck checks an idle connection before it is checked out, the
+	// connection is closed if it fails. By default a connection is healthy
+	// if it is Ready.
+	HealthCheck func(cc *ClientConn) error
+	// DialOptions are the options to Dial the new connections.
+	DialOptions []DialOption
+}
+
+// PoolStats is the metrics of a Pool.
+type PoolStats struct {
+	// Active is the number of the open connections, both checked out and idle.
+	Active int
+	// Idle is the number of the idle connections.
+	Idle int
+	// Hits is the number of Gets served by an idle connection, Misses the
+	// number of Gets which dialed a new one.
+	Hits   uint64
+	Misses uint64
+	// Timeouts is the number of Gets which gave up waiting for a connection.
+	Timeouts uint64
+	// Unhealthy is the number of idle connections which failed the health check.
+	Unhealthy uint64
+	// Expired is the number of idle connections closed after IdleTimeout.
+	Expired uint64
+}
+
+// Pool is a pool of ClientConns per target, it lets many short-lived callers
+// share the connections to the same servers. A connection is checked out by
+// Get and put back by Put.
+type Pool struct {
+	network net.Network
+	opts    PoolOptions
+
+	mu      sync.Mutex
+	targets map[string]*targetPool
+	stats   PoolStats
+	closed  bool
+	stop    chan struct{}
+}
+
+// targetPool holds the connections to a target.
+type targetPool struct {
+	// idle is a stack, the most recently used connection is checked out first.
+	idle []idleConn
+	// active is the number of the open connections, both checked out and idle,
+	// and the connections being dialed.
+	active int
+	// conns is the open connections created by the pool, true if checked out.
+	conns map[*ClientConn]bool
+	// wait is closed and replaced when a connection is put back or closed,
+	// it wakes up the Gets waiting for MaxActive.
+	wait chan struct{}
+}
+
+type idleConn struct {
+	cc    *ClientConn
+	since time.Time
+}
+
+// NewPool creates a Pool of the connections to the targets of network.
+func NewPool(network net.Network, opts PoolOptions) *Pool {
+	if opts.MaxIdle <= 0 {
+		opts.MaxIdle = DefaultMaxIdle
+	}
+	if opts.HealthCheck == nil {
+		opts.HealthCheck = readyCheck
+	}
+	p := &Pool{
+		network: network,
+		opts:    opts,
+		targets: map[string]*targetPool{},
+		stop:    make(chan struct{}),
+	}
+	if opts.IdleTimeout > 0 {
+		go p.reap()
+	}
+	return p
+}
+
+func readyCheck(cc *ClientConn) error {
+	if s := cc.GetState(); s != connectivity.Ready {
+		return status.Errorf(codes.Unavailable, "xrpc: the connection is %v", s)
+	}
+	return nil
+}
+
+func (p *Pool) targetPool(target string) *targetPool {
+	tp, ok := p.targets[target]
+	if !ok {
+		tp = &targetPool{conns: map[*ClientConn]bool{}, wait: make(chan struct{})}
+		p.targets[target] = tp
+	}
+	return tp
+}
+
+// release forgets a closed connection of tp, or a failed dial if cc is nil,
+// and wakes up a waiter, p.mu is held.
+func (p *Pool) release(tp *targetPool, cc *ClientConn) {
+	tp.active--
+	delete(tp.conns, cc)
+	close(tp.wait)
+	tp.wait = make(chan struct{})
+}
+
+// Get checks out a connection to target, an idle one which passes the health
+// check or a new one. It waits until a connection is put back or ctx is done
+// if the target has MaxActive connections, a new connection is dialed until
+// ctx is done.
+func (p *Pool) Get(ctx context.Context, target string) (*ClientConn, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrPoolClosed
+		}
+		tp := p.targetPool(target)
+		if n := len(tp.idle); n > 0 {
+			ic := tp.idle[n-1]
+			tp.idle = tp.idle[:n-1]
+			if p.expired(ic) {
+				p.stats.Expired++
+				p.release(tp, ic.cc)
+				p.mu.Unlock()
+				ic.cc.Close()
+				continue
+			}
+			p.mu.Unlock()
+			if err := p.opts.HealthCheck(ic.cc); err != nil {
+				ic.cc.Close()
+				p.mu.Lock()
+				p.stats.Unhealthy++
+				p.release(tp, ic.cc)
+				p.mu.Unlock()
+				continue
+			}
+			p.mu.Lock()
+			p.stats.Hits++
+			tp.conns[ic.cc] = true
+			p.mu.Unlock()
+			return ic.cc, nil
+		}
+		if p.opts.MaxActive <= 0 || tp.active < p.opts.MaxActive {
+			tp.active++
+			p.stats.Misses++
+			p.mu.Unlock()
+			cc, err := DialContext(ctx, p.network, target, p.opts.DialOptions...)
+			p.mu.Lock()
+			if err != nil {
+				p.release(tp, nil)
+				if ctx.Err() != nil {
+					p.stats.Timeouts++
+					err = status.FromContextError(ctx.Err()).Err()
+				}
+				p.mu.Unlock()
+				return nil, err
+			}
+			tp.conns[cc] = true
+			p.mu.Unlock()
+			return cc, nil
+		}
+		wait := tp.wait
+		p.mu.Unlock()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			p.mu.Lock()
+			p.stats.Timeouts++
+			p.mu.Unlock()
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// Put puts back a connection checked out by Get. The connection is closed if
+// it is shut down, the target has MaxIdle idle connections or the Pool is
+// closed. A connection not created by the Pool is closed and one already put
+// back is ignored.
+func (p *Pool) Put(cc *ClientConn) {
+	p.mu.Lock()
+	var out, known bool
+	tp, ok := p.targets[cc.Addr()]
+	if ok {
+		out, known = tp.conns[cc]
+	}
+	if !out {
+		p.mu.Unlock()
+		if !known {
+			cc.Close()
+		}
+		return
+	}
+	if p.closed || len(tp.idle) >= p.opts.MaxIdle || cc.GetState() == connectivity.Shutdown {
+		p.release(tp, cc)
+		p.mu.Unlock()
+		cc.Close()
+		return
+	}
+	tp.conns[cc] = false
+	tp.idle = append(tp.idle, idleConn{cc: cc, since: time.Now()})
+	close(tp.wait)
+	tp.wait = make(chan struct{})
+	p.mu.Unlock()
+}
+
+func (p *Pool) expired(ic idleConn) bool {
+	return p.opts.IdleTimeout > 0 && time.Since(ic.since) > p.opts.IdleTimeout
+}
+
+// reap closes the connections idle for longer than IdleTimeout.
+func (p *Pool) reap() {
+	ticker := time.NewTicker(p.opts.IdleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.stop:
+			return
+		}
+		var expired []*ClientConn
+		p.mu.Lock()
+		for _, tp := range p.targets {
+			// the oldest connections are at the bottom of the stack
+			n := 0
+			for n < len(tp.idle) && p.expired(tp.idle[n]) {
+				expired = append(expired, tp.idle[n].cc)
+				p.stats.Expired++
+				p.release(tp, tp.idle[n].cc)
+				n++
+			}
+			tp.idle = tp.idle[n:]
+		}
+		p.mu.Unlock()
+		for _, cc := range expired {
+			cc.Close()
+		}
+	}
+}
+
+// Stats returns the metrics of the Pool.
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.stats
+	for _, tp := range p.targets {
+		stats.Active += tp.active
+		stats.Idle += len(tp.idle)
+	}
+	return stats
+}
+
+// Close closes the idle connections and the connections put back later, the
+// later Gets fail with ErrPoolClosed.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.stop)
+	var idle []*ClientConn
+	for _, tp := range p.targets {
+		for _, ic := range tp.idle {
+			idle = append(idle, ic.cc)
+			p.release(tp, ic.cc)
+		}
+		tp.idle = nil
+	}
+	p.mu.Unlock()
+	for _, cc := range idle {
+		cc.Close()
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package xrpc_test
+
+import (
+	"context"
+	"errors"
+	gonet "net"
+	"testing"
+	"time"
+
+	"x.io/xrpc"
+	"x.io/xrpc/pkg/codes"
+	"x.io/xrpc/pkg/connectivity"
+	"x.io/xrpc/pkg/credentials"
+	"x.io/xrpc/pkg/status"
+
+	"github.com/stretchr/testify/assert"
+	rg_pb "x.io/xrpc/protocol/routeguide"
+)
+
+func newRouteGuidePool(t *testing.T, opts xrpc.PoolOptions) *xrpc.Pool {
+	newRouteGuideConn(t)
+	opts.DialOptions = []xrpc.DialOption{xrpc.WithInsecure()}
+	return xrpc.NewPool("tcp", opts)
+}
+
+func TestPoolReuse(t *testing.T) {
+	p := newRouteGuidePool(t, xrpc.PoolOptions{})
+	defer p.Close()
+	conn, err := p.Get(ctx, routeGuideAddr)
+	assert.Equal(t, nil, err)
+	_, err = rg_pb.NewRouteGuideClient(conn).GetFeature(ctx, &rg_pb.Point{Latitude: 1, Longitude: 1})
+	assert.Equal(t, nil, err)
+	p.Put(conn)
+	assert.Equal(t, xrpc.PoolStats{Active: 1, Idle: 1, Misses: 1}, p.Stats())
+
+	again, err := p.Get(ctx, routeGuideAddr)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, conn, again)
+	assert.Equal(t, xrpc.PoolStats{Active: 1, Hits: 1, Misses: 1}, p.Stats())
+	p.Put(again)
+
+	assert.Equal(t, nil, p.Close())
+	_, err = p.Get(ctx, routeGuideAddr)
+	assert.Equal(t, xrpc.ErrPoolClosed, err)
+	assert.Equal(t, 0, p.Stats().Active)
+}
+
+func TestPoolMaxActive(t *testing.T) {
+	p := newRouteGuidePool(t, xrpc.PoolOptions{MaxActive: 1})
+	defer p.Close()
+	conn, err := p.Get(ctx, routeGuideAddr)
+	assert.Equal(t, nil, err)
+
+	tctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = p.Get(tctx, routeGuideAddr)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	assert.Equal(t, uint64(1), p.Stats().Timeouts)
+
+	got := make(chan *xrpc.ClientConn)
+	go func() {
+		c, err := p.Get(ctx, routeGuideAddr)
+		assert.Equal(t, nil, err)
+		got <- c
+	}()
+	time.Sleep(10 * time.Millisecond)
+	p.Put(conn)
+	assert.Equal(t, conn, <-got)
+}
+
+func TestPoolHealthCheck(t *testing.T) {
+	p := newRouteGuidePool(t, xrpc.PoolOptions{HealthCheck: func(cc *xrpc.ClientConn) error {
+		return errors.New("unhealthy")
+	}})
+	defer p.Close()
+	conn, err := p.Get(ctx, routeGuideAddr)
+	assert.Equal(t, nil, err)
+	p.Put(conn)
+	again, err := p.Get(ctx, routeGuideAddr)
+	assert.Equal(t, nil, err)
+	assert.NotEqual(t, conn, again)
+	assert.Equal(t, xrpc.PoolStats{Active: 1, Misses: 2, Unhealthy: 1}, p.Stats())
+}
+
+func TestPoolIdleTimeout(t *testing.T) {
+	p := newRouteGuidePool(t, xrpc.PoolOptions{IdleTimeout: 20 * time.Millisecond})
+	defer p.Close()
+	conn, err := p.Get(ctx, routeGuideAddr)
+	assert.Equal(t, nil, err)
+	p.Put(conn)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, xrpc.PoolStats{Misses: 1, Expired: 1}, p.Stats())
+}
+
+// silentHandshaker waits for the server which never answers the handshake.
+type silentHandshaker struct{}
+
+func (silentHandshaker) ClientHandshake(ctx context.Context, conn gonet.Conn) (credentials.AuthInfo, error) {
+	_, err := conn.Read(make([]byte, 1))
+	return nil, err
+}
+
+func (silentHandshaker) ServerHandshake(conn gonet.Conn) (credentials.AuthInfo, error) {
+	return nil, nil
+}
+
+func TestPoolDialContext(t *testing.T) {
+	lis, err := gonet.Listen("tcp", "localhost:0")
+	assert.Equal(t, nil, err)
+	defer lis.Close()
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	p := xrpc.NewPool("tcp", xrpc.PoolOptions{
+		MaxActive:   1,
+		DialOptions: []xrpc.DialOption{xrpc.WithInsecure(), xrpc.WithHandshaker(silentHandshaker{})},
+	})
+	defer p.Close()
+
+	// the dial is given up with the caller and its slot is released
+	tctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = p.Get(tctx, lis.Addr().String())
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Equal(t, xrpc.PoolStats{Misses: 1, Timeouts: 1}, p.Stats())
+}
+
+func TestPoolPutUnknown(t *testing.T) {
+	p := newRouteGuidePool(t, xrpc.PoolOptions{MaxActive: 1})
+	defer p.Close()
+	conn, err := p.Get(ctx, routeGuideAddr)
+	assert.Equal(t, nil, err)
+
+	// the connections not created by the pool do not release a slot
+	other := newRouteGuideConn(t)
+	p.Put(other)
+	assert.Equal(t, connectivity.Shutdown, other.GetState())
+	tctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = p.Get(tctx, routeGuideAddr)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	// a connection put back twice is idle once
+	p.Put(conn)
+	p.Put(conn)
+	assert.Equal(t, xrpc.PoolStats{Active: 1, Idle: 1, Misses: 1, Timeouts: 1}, p.Stats())
+}
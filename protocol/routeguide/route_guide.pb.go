@@ -0,0 +1,599 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: route_guide.proto
+
+package routeguide
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	math "math"
+	xrpc "x.io/xrpc"
+	codes "x.io/xrpc/pkg/codes"
+	status "x.io/xrpc/pkg/status"
+	types "x.io/xrpc/types"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type Point struct {
+	Latitude             int32    `protobuf:"varint,1,opt,name=latitude,proto3" json:"latitude,omitempty"`
+	Longitude            int32    `protobuf:"varint,2,opt,name=longitude,proto3" json:"longitude,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Point) Reset()         { *m = Point{} }
+func (m *Point) String() string { return proto.CompactTextString(m) }
+func (*Point) ProtoMessage()    {}
+func (*Point) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b7d679f20da65b7b, []int{0}
+}
+
+func (m *Point) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Point.Unmarshal(m, b)
+}
+func (m *Point) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Point.Marshal(b, m, deterministic)
+}
+func (m *Point) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Point.Merge(m, src)
+}
+func (m *Point) XXX_Size() int {
+	return xxx_messageInfo_Point.Size(m)
+}
+func (m *Point) XXX_DiscardUnknown() {
+	xxx_messageInfo_Point.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Point proto.InternalMessageInfo
+
+func (m *Point) GetLatitude() int32 {
+	if m != nil {
+		return m.Latitude
+	}
+	return 0
+}
+
+func (m *Point) GetLongitude() int32 {
+	if m != nil {
+		return m.Longitude
+	}
+	return 0
+}
+
+type Rectangle struct {
+	Lo                   *Point   `protobuf:"bytes,1,opt,name=lo,proto3" json:"lo,omitempty"`
+	Hi                   *Point   `protobuf:"bytes,2,opt,name=hi,proto3" json:"hi,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Rectangle) Reset()         { *m = Rectangle{} }
+func (m *Rectangle) String() string { return proto.CompactTextString(m) }
+func (*Rectangle) ProtoMessage()    {}
+func (*Rectangle) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b7d679f20da65b7b, []int{1}
+}
+
+func (m *Rectangle) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Rectangle.Unmarshal(m, b)
+}
+func (m *Rectangle) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Rectangle.Marshal(b, m, deterministic)
+}
+func (m *Rectangle) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Rectangle.Merge(m, src)
+}
+func (m *Rectangle) XXX_Size() int {
+	return xxx_messageInfo_Rectangle.Size(m)
+}
+func (m *Rectangle) XXX_DiscardUnknown() {
+	xxx_messageInfo_Rectangle.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Rectangle proto.InternalMessageInfo
+
+func (m *Rectangle) GetLo() *Point {
+	if m != nil {
+		return m.Lo
+	}
+	return nil
+}
+
+func (m *Rectangle) GetHi() *Point {
+	if m != nil {
+		return m.Hi
+	}
+	return nil
+}
+
+type Feature struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Location             *Point   `protobuf:"bytes,2,opt,name=location,proto3" json:"location,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Feature) Reset()         { *m = Feature{} }
+func (m *Feature) String() string { return proto.CompactTextString(m) }
+func (*Feature) ProtoMessage()    {}
+func (*Feature) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b7d679f20da65b7b, []int{2}
+}
+
+func (m *Feature) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Feature.Unmarshal(m, b)
+}
+func (m *Feature) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Feature.Marshal(b, m, deterministic)
+}
+func (m *Feature) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Feature.Merge(m, src)
+}
+func (m *Feature) XXX_Size() int {
+	return xxx_messageInfo_Feature.Size(m)
+}
+func (m *Feature) XXX_DiscardUnknown() {
+	xxx_messageInfo_Feature.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Feature proto.InternalMessageInfo
+
+func (m *Feature) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Feature) GetLocation() *Point {
+	if m != nil {
+		return m.Location
+	}
+	return nil
+}
+
+type RouteNote struct {
+	Location             *Point   `protobuf:"bytes,1,opt,name=location,proto3" json:"location,omitempty"`
+	Message              string   `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RouteNote) Reset()         { *m = RouteNote{} }
+func (m *RouteNote) String() string { return proto.CompactTextString(m) }
+func (*RouteNote) ProtoMessage()    {}
+func (*RouteNote) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b7d679f20da65b7b, []int{3}
+}
+
+func (m *RouteNote) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RouteNote.Unmarshal(m, b)
+}
+func (m *RouteNote) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RouteNote.Marshal(b, m, deterministic)
+}
+func (m *RouteNote) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RouteNote.Merge(m, src)
+}
+func (m *RouteNote) XXX_Size() int {
+	return xxx_messageInfo_RouteNote.Size(m)
+}
+func (m *RouteNote) XXX_DiscardUnknown() {
+	xxx_messageInfo_RouteNote.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RouteNote proto.InternalMessageInfo
+
+func (m *RouteNote) GetLocation() *Point {
+	if m != nil {
+		return m.Location
+	}
+	return nil
+}
+
+func (m *RouteNote) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+type RouteSummary struct {
+	PointCount           int32    `protobuf:"varint,1,opt,name=point_count,json=pointCount,proto3" json:"point_count,omitempty"`
+	FeatureCount         int32    `protobuf:"varint,2,opt,name=feature_count,json=featureCount,proto3" json:"feature_count,omitempty"`
+	Distance             int32    `protobuf:"varint,3,opt,name=distance,proto3" json:"distance,omitempty"`
+	ElapsedTime          int32    `protobuf:"varint,4,opt,name=elapsed_time,json=elapsedTime,proto3" json:"elapsed_time,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RouteSummary) Reset()         { *m = RouteSummary{} }
+func (m *RouteSummary) String() string { return proto.CompactTextString(m) }
+func (*RouteSummary) ProtoMessage()    {}
+func (*RouteSummary) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b7d679f20da65b7b, []int{4}
+}
+
+func (m *RouteSummary) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RouteSummary.Unmarshal(m, b)
+}
+func (m *RouteSummary) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RouteSummary.Marshal(b, m, deterministic)
+}
+func (m *RouteSummary) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RouteSummary.Merge(m, src)
+}
+func (m *RouteSummary) XXX_Size() int {
+	return xxx_messageInfo_RouteSummary.Size(m)
+}
+func (m *RouteSummary) XXX_DiscardUnknown() {
+	xxx_messageInfo_RouteSummary.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RouteSummary proto.InternalMessageInfo
+
+func (m *RouteSummary) GetPointCount() int32 {
+	if m != nil {
+		return m.PointCount
+	}
+	return 0
+}
+
+func (m *RouteSummary) GetFeatureCount() int32 {
+	if m != nil {
+		return m.FeatureCount
+	}
+	return 0
+}
+
+func (m *RouteSummary) GetDistance() int32 {
+	if m != nil {
+		return m.Distance
+	}
+	return 0
+}
+
+func (m *RouteSummary) GetElapsedTime() int32 {
+	if m != nil {
+		return m.ElapsedTime
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterType((*Point)(nil), "routeguide.Point")
+	proto.RegisterType((*Rectangle)(nil), "routeguide.Rectangle")
+	proto.RegisterType((*Feature)(nil), "routeguide.Feature")
+	proto.RegisterType((*RouteNote)(nil), "routeguide.RouteNote")
+	proto.RegisterType((*RouteSummary)(nil), "routeguide.RouteSummary")
+}
+
+func init() { proto.RegisterFile("route_guide.proto", fileDescriptor_b7d679f20da65b7b) }
+
+var fileDescriptor_b7d679f20da65b7b = []byte{
+	// 401 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x53, 0xdd, 0xca, 0xd3, 0x40,
+	0x10, 0xfd, 0x36, 0x7e, 0x9f, 0x6d, 0x26, 0x11, 0xe9, 0x88, 0x10, 0xa2, 0xa0, 0x8d, 0x37, 0xbd,
+	0x31, 0x94, 0x0a, 0x5e, 0x56, 0x6c, 0xc1, 0xde, 0x14, 0xa9, 0xb1, 0xf7, 0x65, 0x4d, 0xc6, 0x74,
+	0x61, 0x93, 0x0d, 0xc9, 0x06, 0xf4, 0x01, 0x7c, 0x02, 0x5f, 0x58, 0xb2, 0x49, 0xda, 0x54, 0x5b,
+	0xbc, 0xdb, 0x39, 0x73, 0xce, 0xfc, 0x9c, 0x61, 0x61, 0x52, 0xaa, 0x5a, 0xd3, 0x21, 0xad, 0x45,
+	0x42, 0x61, 0x51, 0x2a, 0xad, 0x10, 0x0c, 0x64, 0x90, 0xe0, 0x23, 0x3c, 0xec, 0x94, 0xc8, 0x35,
+	0xfa, 0x30, 0x96, 0x5c, 0x0b, 0x5d, 0x27, 0xe4, 0xb1, 0xd7, 0x6c, 0xf6, 0x10, 0x9d, 0x62, 0x7c,
+	0x09, 0xb6, 0x54, 0x79, 0xda, 0x26, 0x2d, 0x93, 0x3c, 0x03, 0xc1, 0x17, 0xb0, 0x23, 0x8a, 0x35,
+	0xcf, 0x53, 0x49, 0x38, 0x05, 0x4b, 0x2a, 0x53, 0xc0, 0x59, 0x4c, 0xc2, 0x73, 0xa3, 0xd0, 0x74,
+	0x89, 0x2c, 0xa9, 0x1a, 0xca, 0x51, 0x78, 0xd6, 0x4d, 0xca, 0x51, 0x04, 0x5b, 0x18, 0x7d, 0x22,
+	0xae, 0xeb, 0x92, 0x10, 0xe1, 0x3e, 0xe7, 0x59, 0x3b, 0x93, 0x1d, 0x99, 0x37, 0xbe, 0x85, 0xb1,
+	0x54, 0x31, 0xd7, 0x42, 0xe5, 0xb7, 0xeb, 0x9c, 0x28, 0xc1, 0x1e, 0xec, 0xa8, 0xc9, 0x7e, 0x56,
+	0xfa, 0x52, 0xcb, 0xfe, 0xab, 0x45, 0x0f, 0x46, 0x19, 0x55, 0x15, 0x4f, 0xdb, 0xc5, 0xed, 0xa8,
+	0x0f, 0x83, 0xdf, 0x0c, 0x5c, 0x53, 0xf6, 0x6b, 0x9d, 0x65, 0xbc, 0xfc, 0x89, 0xaf, 0xc0, 0x29,
+	0x1a, 0xf5, 0x21, 0x56, 0x75, 0xae, 0x3b, 0x13, 0xc1, 0x40, 0xeb, 0x06, 0xc1, 0x37, 0xf0, 0xe4,
+	0x7b, 0xbb, 0x55, 0x47, 0x69, 0xad, 0x74, 0x3b, 0xb0, 0x25, 0xf9, 0x30, 0x4e, 0x44, 0xa5, 0x79,
+	0x1e, 0x93, 0xf7, 0xa8, 0xbd, 0x43, 0x1f, 0xe3, 0x14, 0x5c, 0x92, 0xbc, 0xa8, 0x28, 0x39, 0x68,
+	0x91, 0x91, 0x77, 0x6f, 0xf2, 0x4e, 0x87, 0xed, 0x45, 0x46, 0x8b, 0x5f, 0x16, 0x80, 0x99, 0x6a,
+	0xd3, 0xac, 0x83, 0xef, 0x01, 0x36, 0xa4, 0x7b, 0x2f, 0xff, 0xdd, 0xd4, 0x7f, 0x36, 0x84, 0x3a,
+	0x5e, 0x70, 0x87, 0x4b, 0x70, 0xb7, 0xa2, 0xea, 0x85, 0x15, 0x3e, 0x1f, 0xd2, 0x4e, 0xd7, 0xbe,
+	0xa1, 0x9e, 0x33, 0x5c, 0x82, 0x13, 0x51, 0xac, 0xca, 0xc4, 0xcc, 0x72, 0xad, 0xb1, 0x77, 0x51,
+	0x71, 0xe0, 0x63, 0x70, 0x37, 0x63, 0xf8, 0xa1, 0x3b, 0xd9, 0xfa, 0xc8, 0xf5, 0x5f, 0xcd, 0xfb,
+	0x4b, 0xfa, 0xd7, 0xe1, 0x46, 0x3e, 0x67, 0xab, 0x39, 0xbc, 0x10, 0x2a, 0x4c, 0xcb, 0x22, 0x0e,
+	0xe9, 0x07, 0xcf, 0x0a, 0x49, 0xd5, 0x80, 0xbe, 0x7a, 0x7a, 0xf6, 0x68, 0xd7, 0xfc, 0x89, 0x1d,
+	0xfb, 0xf6, 0xd8, 0x7c, 0x8e, 0x77, 0x7f, 0x06, 0x00, 0xc8, 0xe4, 0xef, 0xe6, 0x31, 0x03, 0x00,
+	0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ xrpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the xrpc package it is being compiled against.
+const _ = xrpc.SupportPackageIsVersion4
+
+// RouteGuideClient is the client API for RouteGuide service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/x.io/xrpc#ClientConn.NewStream.
+type RouteGuideClient interface {
+	GetFeature(ctx context.Context, in *Point, opts ...xrpc.CallOption) (*Feature, error)
+	ListFeatures(ctx context.Context, in *Rectangle, opts ...xrpc.CallOption) (RouteGuide_ListFeaturesClient, error)
+	RecordRoute(ctx context.Context, opts ...xrpc.CallOption) (RouteGuide_RecordRouteClient, error)
+	RouteChat(ctx context.Context, opts ...xrpc.CallOption) (RouteGuide_RouteChatClient, error)
+}
+
+type routeGuideClient struct {
+	cc *xrpc.ClientConn
+}
+
+func NewRouteGuideClient(cc *xrpc.ClientConn) RouteGuideClient {
+	return &routeGuideClient{cc}
+}
+
+func (c *routeGuideClient) GetFeature(ctx context.Context, in *Point, opts ...xrpc.CallOption) (*Feature, error) {
+	out := new(Feature)
+	err := c.cc.Invoke(ctx, "/routeguide.RouteGuide/GetFeature", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *routeGuideClient) ListFeatures(ctx context.Context, in *Rectangle, opts ...xrpc.CallOption) (RouteGuide_ListFeaturesClient, error) {
+	stream, err := c.cc.NewStream(ctx, types.XRPC, &_RouteGuide_serviceDesc.Streams[0], "/routeguide.RouteGuide/ListFeatures", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &routeGuideListFeaturesClient{stream}
+	if err := x.ClientStream.SendMsg(x.ClientStream.Context(), in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type RouteGuide_ListFeaturesClient interface {
+	Recv() (*Feature, error)
+	types.ClientStream
+}
+
+type routeGuideListFeaturesClient struct {
+	types.ClientStream
+}
+
+func (x *routeGuideListFeaturesClient) Recv() (*Feature, error) {
+	m := new(Feature)
+	if _, err := x.ClientStream.RecvMsg(x.ClientStream.Context(), m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *routeGuideClient) RecordRoute(ctx context.Context, opts ...xrpc.CallOption) (RouteGuide_RecordRouteClient, error) {
+	stream, err := c.cc.NewStream(ctx, types.XRPC, &_RouteGuide_serviceDesc.Streams[1], "/routeguide.RouteGuide/RecordRoute", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &routeGuideRecordRouteClient{stream}
+	return x, nil
+}
+
+type RouteGuide_RecordRouteClient interface {
+	Send(*Point) error
+	CloseAndRecv() (*RouteSummary, error)
+	types.ClientStream
+}
+
+type routeGuideRecordRouteClient struct {
+	types.ClientStream
+}
+
+func (x *routeGuideRecordRouteClient) Send(m *Point) error {
+	return x.ClientStream.SendMsg(x.ClientStream.Context(), m)
+}
+
+func (x *routeGuideRecordRouteClient) CloseAndRecv() (*RouteSummary, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(RouteSummary)
+	if _, err := x.ClientStream.RecvMsg(x.ClientStream.Context(), m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *routeGuideClient) RouteChat(ctx context.Context, opts ...xrpc.CallOption) (RouteGuide_RouteChatClient, error) {
+	stream, err := c.cc.NewStream(ctx, types.XRPC, &_RouteGuide_serviceDesc.Streams[2], "/routeguide.RouteGuide/RouteChat", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &routeGuideRouteChatClient{stream}
+	return x, nil
+}
+
+type RouteGuide_RouteChatClient interface {
+	Send(*RouteNote) error
+	Recv() (*RouteNote, error)
+	types.ClientStream
+}
+
+type routeGuideRouteChatClient struct {
+	types.ClientStream
+}
+
+func (x *routeGuideRouteChatClient) Send(m *RouteNote) error {
+	return x.ClientStream.SendMsg(x.ClientStream.Context(), m)
+}
+
+func (x *routeGuideRouteChatClient) Recv() (*RouteNote, error) {
+	m := new(RouteNote)
+	if _, err := x.ClientStream.RecvMsg(x.ClientStream.Context(), m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// RouteGuideServer is the server API for RouteGuide service.
+type RouteGuideServer interface {
+	GetFeature(context.Context, *Point) (*Feature, error)
+	ListFeatures(*Rectangle, RouteGuide_ListFeaturesServer) error
+	RecordRoute(RouteGuide_RecordRouteServer) error
+	RouteChat(RouteGuide_RouteChatServer) error
+}
+
+// UnimplementedRouteGuideServer can be embedded to have forward compatible implementations.
+type UnimplementedRouteGuideServer struct {
+}
+
+func (*UnimplementedRouteGuideServer) GetFeature(ctx context.Context, req *Point) (*Feature, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetFeature not implemented")
+}
+func (*UnimplementedRouteGuideServer) ListFeatures(req *Rectangle, srv RouteGuide_ListFeaturesServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListFeatures not implemented")
+}
+func (*UnimplementedRouteGuideServer) RecordRoute(srv RouteGuide_RecordRouteServer) error {
+	return status.Errorf(codes.Unimplemented, "method RecordRoute not implemented")
+}
+func (*UnimplementedRouteGuideServer) RouteChat(srv RouteGuide_RouteChatServer) error {
+	return status.Errorf(codes.Unimplemented, "method RouteChat not implemented")
+}
+
+func RegisterRouteGuideServer(s *xrpc.Server, srv RouteGuideServer) {
+	s.RegisterService(&_RouteGuide_serviceDesc, srv)
+}
+
+func _RouteGuide_GetFeature_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor types.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Point)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RouteGuideServer).GetFeature(ctx, in)
+	}
+	info := &types.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/routeguide.RouteGuide/GetFeature",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RouteGuideServer).GetFeature(ctx, req.(*Point))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RouteGuide_ListFeatures_Handler(srv interface{}, stream types.ServerStream) error {
+	m := new(Rectangle)
+	if _, err := stream.RecvMsg(stream.Context(), m); err != nil {
+		return err
+	}
+	return srv.(RouteGuideServer).ListFeatures(m, &routeGuideListFeaturesServer{stream})
+}
+
+type RouteGuide_ListFeaturesServer interface {
+	Send(*Feature) error
+	types.ServerStream
+}
+
+type routeGuideListFeaturesServer struct {
+	types.ServerStream
+}
+
+func (x *routeGuideListFeaturesServer) Send(m *Feature) error {
+	return x.ServerStream.SendMsg(x.ServerStream.Context(), m)
+}
+
+func _RouteGuide_RecordRoute_Handler(srv interface{}, stream types.ServerStream) error {
+	return srv.(RouteGuideServer).RecordRoute(&routeGuideRecordRouteServer{stream})
+}
+
+type RouteGuide_RecordRouteServer interface {
+	SendAndClose(*RouteSummary) error
+	Recv() (*Point, error)
+	types.ServerStream
+}
+
+type routeGuideRecordRouteServer struct {
+	types.ServerStream
+}
+
+func (x *routeGuideRecordRouteServer) SendAndClose(m *RouteSummary) error {
+	return x.ServerStream.SendMsg(x.ServerStream.Context(), m)
+}
+
+func (x *routeGuideRecordRouteServer) Recv() (*Point, error) {
+	m := new(Point)
+	if _, err := x.ServerStream.RecvMsg(x.ServerStream.Context(), m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _RouteGuide_RouteChat_Handler(srv interface{}, stream types.ServerStream) error {
+	return srv.(RouteGuideServer).RouteChat(&routeGuideRouteChatServer{stream})
+}
+
+type RouteGuide_RouteChatServer interface {
+	Send(*RouteNote) error
+	Recv() (*RouteNote, error)
+	types.ServerStream
+}
+
+type routeGuideRouteChatServer struct {
+	types.ServerStream
+}
+
+func (x *routeGuideRouteChatServer) Send(m *RouteNote) error {
+	return x.ServerStream.SendMsg(x.ServerStream.Context(), m)
+}
+
+func (x *routeGuideRouteChatServer) Recv() (*RouteNote, error) {
+	m := new(RouteNote)
+	if _, err := x.ServerStream.RecvMsg(x.ServerStream.Context(), m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+var _RouteGuide_serviceDesc = types.ServiceDesc{
+	ServiceName: "routeguide.RouteGuide",
+	HandlerType: (*RouteGuideServer)(nil),
+	Methods: []types.MethodDesc{
+		{
+			MethodName: "GetFeature",
+			Handler:    _RouteGuide_GetFeature_Handler,
+		},
+	},
+	Streams: []types.StreamDesc{
+		{
+			StreamName:    "ListFeatures",
+			Handler:       _RouteGuide_ListFeatures_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "RecordRoute",
+			Handler:       _RouteGuide_RecordRoute_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "RouteChat",
+			Handler:       _RouteGuide_RouteChat_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "route_guide.proto",
+}
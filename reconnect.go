@@ -0,0 +1,469 @@
+package xrpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"x.io/xrpc/pkg/balancer"
+	"x.io/xrpc/pkg/codes"
+	"x.io/xrpc/pkg/connectivity"
+	"x.io/xrpc/pkg/net"
+	"x.io/xrpc/pkg/peer"
+	"x.io/xrpc/pkg/resolver"
+	"x.io/xrpc/pkg/status"
+	"x.io/xrpc/types"
+
+	"github.com/xtaci/smux"
+)
+
+// errConnClosing is returned by the calls on a ClientConn which is closed.
+var errConnClosing = status.Error(codes.Canceled, "xrpc: the client connection is closing")
+
+// monitoredConn reports the first read or write error of the connection
+// under a session, the session is dead after it.
+type monitoredConn struct {
+	net.Conn
+	once sync.Once
+	dead chan struct{}
+}
+
+func (mc *monitoredConn) Read(p []byte) (int, error) {
+	n, err := mc.Conn.Read(p)
+	if err != nil {
+		mc.once.Do(func() { close(mc.dead) })
+	}
+	return n, err
+}
+
+func (mc *monitoredConn) Write(p []byte) (int, error) {
+	n, err := mc.Conn.Write(p)
+	if err != nil {
+		mc.once.Do(func() { close(mc.dead) })
+	}
+	return n, err
+}
+
+// addrConn is the connection of a ClientConn to one of its resolved
+// addresses. It reconnects with exponential backoff when the connection is
+// lost until it is removed from the ClientConn.
+type addrConn struct {
+	cc   *ClientConn
+	addr resolver.Address
+
+	// state, session, conn, peer and err are guarded by cc.stateMu, peer is
+	// the server of the session and err is the error of the last attempt to
+	// connect.
+	state   connectivity.State
+	session *smux.Session
+	conn    net.Conn
+	peer    *peer.Peer
+	err     error
+
+	// removed is closed when the addrConn is removed from the ClientConn or
+	// the ClientConn is closed, ctx is canceled along with it.
+	removed    chan struct{}
+	removeOnce sync.Once
+	ctx        context.Context
+	cancel     context.CancelFunc
+
+	// active is the number of the calls in flight on the addrConn.
+	active int32
+}
+
+// Address returns the resolved address of the addrConn, cc.stateMu is held.
+func (ac *addrConn) Address() resolver.Address {
+	return ac.addr
+}
+
+// ActiveStreams returns the number of the calls in flight on the addrConn.
+func (ac *addrConn) ActiveStreams() int {
+	return int(atomic.LoadInt32(&ac.active))
+}
+
+// connect dials the address and sets up the session, the addrConn is Ready
+// when it succeeds.
+func (ac *addrConn) connect() error {
+	ctx, cancel := context.WithTimeout(ac.ctx, defaultConnectTimeout)
+	conn, err := net.Dial(ctx, ac.addr.Network, ac.addr.Addr)
+	cancel()
+	if err != nil {
+		return err
+	}
+	p := &peer.Peer{Addr: conn.RemoteAddr()}
+	if creds := ac.cc.dopts.creds; creds != nil {
+		ctx, cancel := context.WithTimeout(ac.ctx, defaultHandshakeTimeout)
+		conn, p.AuthInfo, err = creds.ClientHandshake(ctx, ac.addr.Addr, conn)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+	n, err := conn.Write([]byte(types.Preface))
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if n != len(types.Preface) {
+		conn.Close()
+		return errors.New("wrote Preface length isn't match")
+	}
+	if h := ac.cc.dopts.handshaker; h != nil {
+		ctx, cancel := context.WithTimeout(ac.ctx, defaultHandshakeTimeout)
+		p.HandshakeInfo, err = h.ClientHandshake(ctx, conn)
+		cancel()
+		if err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	mc := &monitoredConn{Conn: conn, dead: make(chan struct{})}
+	session, err := smux.Client(mc, ac.cc.dopts.smuxConfig)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	ctl, err := openControlStream(session)
+	if err != nil {
+		session.Close()
+		return err
+	}
+
+	ac.cc.stateMu.Lock()
+	select {
+	case <-ac.removed:
+		ac.cc.stateMu.Unlock()
+		session.Close()
+		return errConnClosing
+	default:
+	}
+	ac.conn = conn
+	ac.session = session
+	ac.peer = p
+	ac.err = nil
+	ac.setStateLocked(connectivity.Ready)
+	ac.cc.stateMu.Unlock()
+	go ac.monitor(mc, session)
+	go ac.control(session, ctl)
+	return nil
+}
+
+// monitor waits for the session to die and reconnects the addrConn if the
+// session was still in use.
+func (ac *addrConn) monitor(mc *monitoredConn, session *smux.Session) {
+	select {
+	case <-mc.dead:
+	case <-ac.removed:
+	}
+	session.Close()
+	if ac.detach(session, connectivity.TransientFailure) {
+		ac.cc.resolveNow()
+		ac.reconnect()
+	}
+}
+
+// goAway moves the addrConn off the session the server is draining, the
+// calls in flight finish on it while the addrConn connects a new session.
+func (ac *addrConn) goAway(session *smux.Session) {
+	if ac.detach(session, connectivity.Connecting) {
+		go ac.reconnect()
+	}
+	ac.cc.dropStreams(session)
+}
+
+// hasSession reports whether session is the current session of the addrConn.
+func (ac *addrConn) hasSession(session *smux.Session) bool {
+	ac.cc.stateMu.Lock()
+	defer ac.cc.stateMu.Unlock()
+	return ac.session == session
+}
+
+// detach removes the session from the addrConn and moves it to the state s.
+// It reports whether the session was the current one of the addrConn, the
+// caller reconnects it then.
+func (ac *addrConn) detach(session *smux.Session, s connectivity.State) bool {
+	ac.cc.stateMu.Lock()
+	defer ac.cc.stateMu.Unlock()
+	select {
+	case <-ac.removed:
+		return false
+	default:
+	}
+	if ac.session != session {
+		return false
+	}
+	ac.session, ac.peer = nil, nil
+	ac.setStateLocked(s)
+	return true
+}
+
+// reconnect connects the addrConn with exponential backoff until it
+// succeeds or the addrConn is removed.
+func (ac *addrConn) reconnect() {
+	for retries := 0; ; retries++ {
+		ac.setState(connectivity.Connecting, nil)
+		err := ac.connect()
+		if err == nil {
+			return
+		}
+		ac.setState(connectivity.TransientFailure, err)
+		timer := time.NewTimer(ac.cc.dopts.bs.backoff(retries))
+		select {
+		case <-timer.C:
+		case <-ac.removed:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// setState moves the addrConn to the state s, err is the reason of a
+// TransientFailure.
+func (ac *addrConn) setState(s connectivity.State, err error) {
+	ac.cc.stateMu.Lock()
+	defer ac.cc.stateMu.Unlock()
+	select {
+	case <-ac.removed:
+		return
+	default:
+	}
+	if err != nil {
+		ac.err = err
+	}
+	ac.setStateLocked(s)
+}
+
+func (ac *addrConn) setStateLocked(s connectivity.State) {
+	ac.state = s
+	ac.cc.updateStateLocked()
+}
+
+// tearDown stops the addrConn and closes its session, cc.stateMu is held.
+func (ac *addrConn) tearDown() {
+	ac.removeOnce.Do(func() {
+		close(ac.removed)
+		ac.cancel()
+		ac.state = connectivity.Shutdown
+		if ac.session != nil {
+			ac.session.Close()
+		}
+	})
+}
+
+// updateAddresses replaces the addresses of the ClientConn with the resolved
+// ones. The addrConns of the kept addresses live on, the new addresses get a
+// new addrConn and the addrConns of the others are torn down.
+func (cc *ClientConn) updateAddresses(addrs []resolver.Address) {
+	cc.stateMu.Lock()
+	defer cc.stateMu.Unlock()
+	if cc.state == connectivity.Shutdown {
+		return
+	}
+	old := make(map[string]*addrConn, len(cc.conns))
+	for _, ac := range cc.conns {
+		old[ac.addr.String()] = ac
+	}
+	conns := make([]*addrConn, 0, len(addrs))
+	seen := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		if addr.Network == "" {
+			addr.Network = cc.protocol
+		}
+		key := addr.String()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if ac, ok := old[key]; ok {
+			ac.addr.Attributes = addr.Attributes
+			conns = append(conns, ac)
+			delete(old, key)
+			continue
+		}
+		ac := &addrConn{
+			cc:      cc,
+			addr:    addr,
+			state:   connectivity.Connecting,
+			removed: make(chan struct{}),
+		}
+		ac.ctx, ac.cancel = context.WithCancel(cc.ctx)
+		conns = append(conns, ac)
+		go ac.reconnect()
+	}
+	for _, ac := range old {
+		ac.tearDown()
+	}
+	cc.conns = conns
+	cc.resolverErr = nil
+	cc.resolved = true
+	cc.updateStateLocked()
+}
+
+// reportResolverError records the error of the resolver, the ClientConn
+// keeps its addresses but fails if it has none.
+func (cc *ClientConn) reportResolverError(err error) {
+	cc.stateMu.Lock()
+	defer cc.stateMu.Unlock()
+	cc.resolverErr = err
+	cc.resolved = true
+	cc.updateStateLocked()
+}
+
+// ccResolverWrapper is the resolver.ClientConn of the resolver of a
+// ClientConn.
+type ccResolverWrapper struct {
+	cc *ClientConn
+}
+
+func (w ccResolverWrapper) UpdateState(s resolver.State) {
+	w.cc.updateAddresses(s.Addresses)
+}
+
+func (w ccResolverWrapper) ReportError(err error) {
+	w.cc.reportResolverError(err)
+}
+
+// resolveNow asks the resolver to resolve the target again.
+func (cc *ClientConn) resolveNow() {
+	cc.stateMu.Lock()
+	r := cc.resolver
+	cc.stateMu.Unlock()
+	if r != nil {
+		r.ResolveNow()
+	}
+}
+
+// updateStateLocked derives the state of the ClientConn from its addrConns.
+// It is Ready if any addrConn is Ready, Connecting while the target is being
+// resolved or any addrConn is connecting, TransientFailure otherwise. The
+// picker is rebuilt when the ready addrConns change.
+func (cc *ClientConn) updateStateLocked() {
+	s := connectivity.TransientFailure
+	if !cc.resolved {
+		s = connectivity.Connecting
+	}
+	var ready []*addrConn
+	for _, ac := range cc.conns {
+		switch ac.state {
+		case connectivity.Ready:
+			ready = append(ready, ac)
+			s = connectivity.Ready
+		case connectivity.Connecting:
+			if s != connectivity.Ready {
+				s = connectivity.Connecting
+			}
+		}
+	}
+	if !sameAddrConns(ready, cc.ready) {
+		cc.ready = ready
+		subConns := make([]balancer.SubConn, len(ready))
+		for i, ac := range ready {
+			subConns[i] = ac
+		}
+		cc.picker = cc.balancer.Build(subConns)
+	}
+	cc.setStateLocked(s)
+}
+
+func sameAddrConns(a, b []*addrConn) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// lastErrLocked returns the reason why the ClientConn is in
+// TransientFailure.
+func (cc *ClientConn) lastErrLocked() error {
+	for _, ac := range cc.conns {
+		if ac.err != nil {
+			return ac.err
+		}
+	}
+	if cc.resolverErr != nil {
+		return cc.resolverErr
+	}
+	return errors.New("xrpc: no address is resolved for " + cc.target)
+}
+
+// setState moves the ClientConn to the state s and wakes up the waiters of
+// the state change, a ClientConn never leaves Shutdown.
+func (cc *ClientConn) setState(s connectivity.State) {
+	cc.stateMu.Lock()
+	defer cc.stateMu.Unlock()
+	cc.setStateLocked(s)
+}
+
+func (cc *ClientConn) setStateLocked(s connectivity.State) {
+	if cc.state == s || cc.state == connectivity.Shutdown {
+		return
+	}
+	cc.state = s
+	close(cc.stateCh)
+	cc.stateCh = make(chan struct{})
+}
+
+// GetState returns the connectivity.State of ClientConn.
+func (cc *ClientConn) GetState() connectivity.State {
+	cc.stateMu.Lock()
+	defer cc.stateMu.Unlock()
+	return cc.state
+}
+
+// WaitForStateChange waits until the connectivity.State of ClientConn changes
+// from sourceState or ctx expires. A true value is returned in former case and
+// false in latter.
+func (cc *ClientConn) WaitForStateChange(ctx context.Context, sourceState connectivity.State) bool {
+	for {
+		cc.stateMu.Lock()
+		state, ch := cc.state, cc.stateCh
+		cc.stateMu.Unlock()
+		if state != sourceState {
+			return true
+		}
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// readySession returns the Ready addrConn picked by the balancer for the
+// call of method, its session and the peer of the session. A fail fast call fails with Unavailable if
+// the ClientConn is not Ready, otherwise the call waits until it is Ready or
+// ctx is done.
+func (cc *ClientConn) readySession(ctx context.Context, failFast bool, method string) (*addrConn, *smux.Session, *peer.Peer, error) {
+	for {
+		cc.stateMu.Lock()
+		state, ch := cc.state, cc.stateCh
+		if state == connectivity.Ready {
+			sc, err := cc.picker.Pick(balancer.PickInfo{FullMethod: method, Ctx: ctx})
+			if err == nil {
+				ac := sc.(*addrConn)
+				session, p := ac.session, ac.peer
+				cc.stateMu.Unlock()
+				return ac, session, p, nil
+			}
+		}
+		cc.stateMu.Unlock()
+		if state == connectivity.Shutdown {
+			return nil, nil, nil, errConnClosing
+		}
+		if failFast {
+			return nil, nil, nil, status.Errorf(codes.Unavailable, "xrpc: the connection is %v", state)
+		}
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return nil, nil, nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
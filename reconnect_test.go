@@ -0,0 +1,140 @@
+package xrpc_test
+
+import (
+	"context"
+	"io"
+	stdnet "net"
+	"sync"
+	"testing"
+	"time"
+
+	"x.io/xrpc"
+	"x.io/xrpc/pkg/codes"
+	"x.io/xrpc/pkg/connectivity"
+	"x.io/xrpc/pkg/net"
+	"x.io/xrpc/pkg/status"
+
+	"github.com/stretchr/testify/assert"
+	rg_pb "x.io/xrpc/protocol/routeguide"
+)
+
+const (
+	proxyAddr = "localhost:9899"
+)
+
+// proxy forwards the connections to backend, stop drops all of them to
+// simulate a restart of the server.
+type proxy struct {
+	backend string
+	lis     stdnet.Listener
+
+	mu    sync.Mutex
+	conns []stdnet.Conn
+}
+
+func (p *proxy) start(t *testing.T, addr string) {
+	lis, err := stdnet.Listen("tcp", addr)
+	assert.Equal(t, nil, err)
+	p.lis = lis
+	go func() {
+		for {
+			c, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			b, err := stdnet.Dial("tcp", p.backend)
+			if err != nil {
+				c.Close()
+				continue
+			}
+			p.mu.Lock()
+			p.conns = append(p.conns, c, b)
+			p.mu.Unlock()
+			go io.Copy(b, c)
+			go io.Copy(c, b)
+		}
+	}()
+}
+
+func (p *proxy) stop() {
+	p.lis.Close()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range p.conns {
+		c.Close()
+	}
+	p.conns = nil
+}
+
+func TestReconnectAndWaitForReady(t *testing.T) {
+	newRouteGuideConn(t)
+	p := &proxy{backend: routeGuideAddr}
+	p.start(t, proxyAddr)
+
+	conn, err := xrpc.Dial("tcp", proxyAddr, xrpc.WithInsecure(), xrpc.WithBackoffConfig(xrpc.BackoffConfig{
+		BaseDelay:  10 * time.Millisecond,
+		Multiplier: 1.6,
+		MaxDelay:   100 * time.Millisecond,
+	}))
+	assert.Equal(t, nil, err)
+	defer conn.Close()
+	assert.Equal(t, connectivity.Ready, conn.GetState())
+	client := rg_pb.NewRouteGuideClient(conn)
+	point := &rg_pb.Point{Latitude: 1, Longitude: 1}
+	_, err = client.GetFeature(ctx, point)
+	assert.Equal(t, nil, err)
+
+	// the server goes away
+	p.stop()
+	tctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	assert.Equal(t, true, conn.WaitForStateChange(tctx, connectivity.Ready))
+	_, err = client.GetFeature(ctx, point)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	// the call waits for the server to come back
+	done := make(chan error)
+	go func() {
+		_, err := client.GetFeature(tctx, point, xrpc.WaitForReady(true))
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	p.start(t, proxyAddr)
+	defer p.stop()
+	assert.Equal(t, nil, <-done)
+	assert.Equal(t, connectivity.Ready, conn.GetState())
+	f, err := client.GetFeature(ctx, point)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "a", f.Name)
+
+	assert.Equal(t, nil, conn.Close())
+	assert.Equal(t, connectivity.Shutdown, conn.GetState())
+}
+
+// blackhole is the network whose dials hang until they are given up, the
+// contexts of the dials are sent on dials.
+const blackhole = "blackhole"
+
+var dials = make(chan context.Context, 1)
+
+func init() {
+	net.RegisterDialer(blackhole, func(ctx context.Context, addr string) (net.Conn, error) {
+		dials <- ctx
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+}
+
+func TestDialCanceled(t *testing.T) {
+	// the dial in flight is given up along with DialContext
+	tctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err := xrpc.DialContext(tctx, blackhole, "localhost:9897", xrpc.WithInsecure())
+	assert.Equal(t, context.DeadlineExceeded, err)
+	dctx := <-dials
+	select {
+	case <-dctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the dial is not canceled")
+	}
+}
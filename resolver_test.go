@@ -0,0 +1,73 @@
+package xrpc_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"x.io/xrpc"
+	"x.io/xrpc/pkg/codes"
+	"x.io/xrpc/pkg/connectivity"
+	"x.io/xrpc/pkg/resolver"
+	"x.io/xrpc/pkg/status"
+
+	"github.com/stretchr/testify/assert"
+	rg_pb "x.io/xrpc/protocol/routeguide"
+)
+
+// deadAddr is an address nobody listens on.
+const deadAddr = "localhost:9901"
+
+func TestStaticResolver(t *testing.T) {
+	newRouteGuideConn(t)
+	conn, err := xrpc.Dial("tcp", "static:///"+deadAddr+","+routeGuideAddr, xrpc.WithInsecure())
+	assert.Equal(t, nil, err)
+	defer conn.Close()
+	assert.Equal(t, connectivity.Ready, conn.GetState())
+	f, err := rg_pb.NewRouteGuideClient(conn).GetFeature(ctx, &rg_pb.Point{Latitude: 1, Longitude: 1})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "a", f.Name)
+
+	_, err = xrpc.Dial("tcp", "static:///"+deadAddr, xrpc.WithInsecure())
+	assert.NotEqual(t, nil, err)
+}
+
+func TestFileResolverUpdate(t *testing.T) {
+	newRouteGuideConn(t)
+	dir, err := ioutil.TempDir("", "resolver")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "endpoints.yaml")
+	writeEndpoints := func(addr string) {
+		err := ioutil.WriteFile(path, []byte("endpoints:\n  - addr: "+addr+"\n"), 0644)
+		assert.Equal(t, nil, err)
+	}
+	interval := resolver.FileResolveInterval
+	resolver.FileResolveInterval = 10 * time.Millisecond
+	defer func() { resolver.FileResolveInterval = interval }()
+
+	writeEndpoints(routeGuideAddr)
+	conn, err := xrpc.Dial("tcp", "file://"+path, xrpc.WithInsecure())
+	assert.Equal(t, nil, err)
+	defer conn.Close()
+	client := rg_pb.NewRouteGuideClient(conn)
+	point := &rg_pb.Point{Latitude: 1, Longitude: 1}
+	_, err = client.GetFeature(ctx, point)
+	assert.Equal(t, nil, err)
+
+	// the server is replaced by a dead one
+	writeEndpoints(deadAddr)
+	tctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	assert.Equal(t, true, conn.WaitForStateChange(tctx, connectivity.Ready))
+	_, err = client.GetFeature(ctx, point)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	// and comes back
+	writeEndpoints("tcp://" + routeGuideAddr)
+	_, err = client.GetFeature(tctx, point, xrpc.WaitForReady(true))
+	assert.Equal(t, nil, err)
+}
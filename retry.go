@@ -1 +1,106 @@
 package xrpc
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+
+	"x.io/xrpc/pkg/codes"
+	"x.io/xrpc/pkg/status"
+)
+
+// maxRetryAttempts caps the MaxAttempts of the retry policies.
+const maxRetryAttempts = 5
+
+// RetryPolicy defines how the failed unary calls are retried. Only the calls
+// which are safe to send again, e.g. idempotent ones, should get a policy.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts of a call including the
+	// original one, it must be greater than 1 and is capped at 5.
+	MaxAttempts int
+	// InitialBackoff, MaxBackoff and BackoffMultiplier bound the random
+	// backoff before the nth retry to
+	// min(InitialBackoff*BackoffMultiplier^(n-1), MaxBackoff).
+	InitialBackoff    time.Duration
+	MaxBackoff        time.Duration
+	BackoffMultiplier float64
+	// RetryableStatusCodes is the set of the codes the calls are retried on.
+	RetryableStatusCodes map[codes.Code]bool
+}
+
+var errInvalidRetryPolicy = errors.New("xrpc: invalid retry policy, MaxAttempts must be greater than 1, the backoffs and BackoffMultiplier must be positive and RetryableStatusCodes must not be empty")
+
+func (rp *RetryPolicy) validate() error {
+	if rp.MaxAttempts <= 1 || rp.InitialBackoff <= 0 || rp.MaxBackoff <= 0 ||
+		rp.BackoffMultiplier <= 0 || len(rp.RetryableStatusCodes) == 0 {
+		return errInvalidRetryPolicy
+	}
+	if rp.MaxAttempts > maxRetryAttempts {
+		rp.MaxAttempts = maxRetryAttempts
+	}
+	return nil
+}
+
+// backoff returns the time to wait before the retry after the given number of
+// attempts.
+func (rp *RetryPolicy) backoff(attempts int) time.Duration {
+	cur := float64(rp.InitialBackoff) * math.Pow(rp.BackoffMultiplier, float64(attempts-1))
+	if max := float64(rp.MaxBackoff); cur > max {
+		cur = max
+	}
+	return time.Duration(rand.Int63n(int64(cur) + 1))
+}
+
+// Attempts returns a CallOption that retrieves the number of attempts of a
+// unary call, it is greater than 1 if the call is retried.
+func Attempts(n *int) CallOption {
+	return &attemptsCallOption{attempts: n}
+}
+
+type attemptsCallOption struct {
+	attempts *int
+}
+
+func (o *attemptsCallOption) before(c *callInfo) error { return nil }
+func (o *attemptsCallOption) after(c *callInfo)        {}
+
+// invokeWithRetry is the UnaryInvoker under the interceptors of the
+// ClientConn, it sends the call again as the retry policy of the method
+// allows. The retries never go beyond the deadline of the call.
+func invokeWithRetry(ctx context.Context, method string, req, reply interface{}, cc *ClientConn, opts ...CallOption) (err error) {
+	var rp *RetryPolicy
+	if mc := cc.dopts.sc.methodConfig(method); mc != nil {
+		rp = mc.RetryPolicy
+	}
+	attempts := 0
+	defer func() {
+		for _, o := range opts {
+			if ao, ok := o.(*attemptsCallOption); ok {
+				*ao.attempts = attempts
+			}
+		}
+	}()
+	for {
+		attempts++
+		err = invoke(ctx, method, req, reply, cc, opts...)
+		if err == nil || rp == nil || attempts >= rp.MaxAttempts {
+			return
+		}
+		if !rp.RetryableStatusCodes[status.Code(err)] {
+			return
+		}
+		backoff := rp.backoff(attempts)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+			return
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
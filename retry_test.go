@@ -0,0 +1,138 @@
+package xrpc_test
+
+import (
+	"context"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"x.io/xrpc"
+	"x.io/xrpc/pkg/codes"
+	"x.io/xrpc/pkg/net"
+	"x.io/xrpc/pkg/status"
+
+	"github.com/stretchr/testify/assert"
+	greeter_pb "x.io/xrpc/protocol/greeter"
+)
+
+const (
+	retryAddr = "localhost:9900"
+
+	retryServiceConfig = `{
+		"methodConfig": [{
+		  "name": [{"service": "greeter.Greeter"}],
+		  "waitForReady": true,
+		  "retryPolicy": {
+			  "MaxAttempts": 4,
+			  "InitialBackoff": ".01s",
+			  "MaxBackoff": ".01s",
+			  "BackoffMultiplier": 1.0,
+			  "RetryableStatusCodes": [ "UNAVAILABLE" ]
+		  }
+		}]}`
+)
+
+// failingGreeter fails the first three requests of every name with
+// Unavailable and passes the fourth, the name "invalid" always fails with
+// InvalidArgument.
+type failingGreeter struct {
+	greeter_pb.UnimplementedGreeterServer
+
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+func (g *failingGreeter) SayHello(ctx context.Context, req *greeter_pb.HelloRequest) (*greeter_pb.HelloReply, error) {
+	if req.Name == "invalid" {
+		return nil, status.Error(codes.InvalidArgument, "invalid name")
+	}
+	g.mu.Lock()
+	g.requests[req.Name]++
+	n := g.requests[req.Name]
+	g.mu.Unlock()
+	if n%4 != 0 {
+		return nil, status.Errorf(codes.Unavailable, "request %d failed", n)
+	}
+	return &greeter_pb.HelloReply{Message: req.Name}, nil
+}
+
+var retryOnce sync.Once
+
+func newRetryClient(t *testing.T, opts ...xrpc.DialOption) greeter_pb.GreeterClient {
+	retryOnce.Do(func() {
+		lis, err := net.Listen(context.Background(), "tcp", retryAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		s := xrpc.NewServer()
+		greeter_pb.RegisterGreeterServer(s, &failingGreeter{requests: map[string]int{}})
+		go s.Serve(lis)
+	})
+	conn, err := xrpc.Dial("tcp", retryAddr, append([]xrpc.DialOption{xrpc.WithInsecure()}, opts...)...)
+	assert.Equal(t, nil, err)
+	return greeter_pb.NewGreeterClient(conn)
+}
+
+func TestRetryServiceConfig(t *testing.T) {
+	client := newRetryClient(t, xrpc.WithDefaultServiceConfig(retryServiceConfig))
+	var attempts int
+	r, err := client.SayHello(ctx, &greeter_pb.HelloRequest{Name: "config"}, xrpc.Attempts(&attempts))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "config", r.Message)
+	assert.Equal(t, 4, attempts)
+
+	// the codes which are not retryable fail at once
+	_, err = client.SayHello(ctx, &greeter_pb.HelloRequest{Name: "invalid"}, xrpc.Attempts(&attempts))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, 1, attempts)
+}
+
+func TestRetryMethodConfig(t *testing.T) {
+	client := newRetryClient(t, xrpc.WithMethodConfig("greeter.Greeter/SayHello", xrpc.MethodConfig{
+		RetryPolicy: &xrpc.RetryPolicy{
+			MaxAttempts:          2,
+			InitialBackoff:       time.Millisecond,
+			MaxBackoff:           time.Millisecond,
+			BackoffMultiplier:    1,
+			RetryableStatusCodes: map[codes.Code]bool{codes.Unavailable: true},
+		},
+	}))
+	var attempts int
+	_, err := client.SayHello(ctx, &greeter_pb.HelloRequest{Name: "method"}, xrpc.Attempts(&attempts))
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, 2, attempts)
+	r, err := client.SayHello(ctx, &greeter_pb.HelloRequest{Name: "method"}, xrpc.Attempts(&attempts))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "method", r.Message)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestRetryDeadline(t *testing.T) {
+	client := newRetryClient(t, xrpc.WithMethodConfig("", xrpc.MethodConfig{
+		RetryPolicy: &xrpc.RetryPolicy{
+			MaxAttempts:          4,
+			InitialBackoff:       time.Hour,
+			MaxBackoff:           time.Hour,
+			BackoffMultiplier:    1,
+			RetryableStatusCodes: map[codes.Code]bool{codes.Unavailable: true},
+		},
+	}))
+	tctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	var attempts int
+	start := time.Now()
+	_, err := client.SayHello(tctx, &greeter_pb.HelloRequest{Name: "deadline"}, xrpc.Attempts(&attempts))
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, true, attempts < 4)
+	assert.Equal(t, true, time.Since(start) < time.Second)
+}
+
+func TestRetryInvalidConfig(t *testing.T) {
+	_, err := xrpc.Dial("tcp", retryAddr, xrpc.WithInsecure(), xrpc.WithDefaultServiceConfig(`{
+		"methodConfig": [{
+		  "name": [{"service": "greeter.Greeter"}],
+		  "retryPolicy": {"MaxAttempts": 1, "InitialBackoff": ".01s", "MaxBackoff": ".01s", "BackoffMultiplier": 1.0}
+		}]}`))
+	assert.NotEqual(t, nil, err)
+}
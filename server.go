@@ -3,32 +3,47 @@ package xrpc
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"reflect"
 	"sync"
 	"time"
 
+	"x.io/xrpc/pkg/auth"
+	"x.io/xrpc/pkg/codes"
 	"x.io/xrpc/pkg/encoding"
 	"x.io/xrpc/pkg/log"
 	"x.io/xrpc/pkg/net"
+	"x.io/xrpc/pkg/peer"
+	"x.io/xrpc/pkg/status"
 	"x.io/xrpc/plugin"
 	"x.io/xrpc/types"
 
 	"github.com/xtaci/smux"
 )
 
-func NewServer() *Server {
+func NewServer(opt ...ServerOption) *Server {
+	opts := defaultServerOptions()
+	for _, o := range opt {
+		o(opts)
+	}
 	pc := plugin.NewPluginContainer()
 	s := &Server{
 		CustomServer: NewCustomServer(pc),
+		opts:         opts,
 		m:            map[string]*service{},
 		mu:           &sync.Mutex{},
 		lis:          map[net.Listener]bool{},
 		conns:        map[net.Conn]bool{},
-		sessions:     map[*smux.Session]bool{},
+		sessions:     map[*smux.Session]*serverKeepalive{},
 		pc:           pc,
-		ctx:          context.Background(),
 		auth:         NewEmptyAuthenticator(),
+		quit:         make(chan struct{}),
+		done:         make(chan struct{}),
 	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.cv = sync.NewCond(s.mu)
 	return s
 }
 
@@ -50,30 +65,131 @@ type Server struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 
-	auth Authenticator
+	auth  Authenticator
+	authz Authorizer
 
+	// lis, conns and sessions are guarded by mu, lis and conns are nil after
+	// the server is stopped. conns holds the accepted connections until their
+	// sessions end, cv is signaled when one of them is removed.
 	lis      map[net.Listener]bool
 	conns    map[net.Conn]bool
-	sessions map[*smux.Session]bool
+	sessions map[*smux.Session]*serverKeepalive
 	pc       plugin.Container
 
-	mu       *sync.Mutex
-	cv       *sync.Cond
+	mu *sync.Mutex
+	cv *sync.Cond
+	// quit is closed when the server starts to stop, done when it is stopped.
 	quit     chan struct{}
 	done     chan struct{}
 	quitOnce sync.Once
 	doneOnce sync.Once
 }
 
+// ErrServerStopped is returned by Serve after the server is stopped.
+var ErrServerStopped = errors.New("xrpc: the server has been stopped")
+
+var errNoListener = errors.New("xrpc: no listener to serve")
+
+const (
+	// stopTimeout bounds the time Stop waits for the sessions to end.
+	stopTimeout = time.Second
+	// serveAllGrace bounds the graceful stop of ServeAll after a listener
+	// fails.
+	serveAllGrace = 5 * time.Second
+)
+
+// Serve accepts the connections on lis and serves them until lis fails or the
+// server is stopped, it returns nil if the server is stopped by Stop or
+// GracefulStop. A server may serve several listeners at the same time.
 func (s *Server) Serve(lis net.Listener) error {
+	s.mu.Lock()
+	if s.lis == nil {
+		s.mu.Unlock()
+		lis.Close()
+		return ErrServerStopped
+	}
+	s.lis[lis] = true
+	s.serve = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		if s.lis != nil && s.lis[lis] {
+			lis.Close()
+			delete(s.lis, lis)
+		}
+		s.mu.Unlock()
+	}()
 	err := s.listen(lis)
+	select {
+	case <-s.quit:
+		return nil
+	default:
+	}
+	return fmt.Errorf("xrpc: failed to serve %s://%v: %w", lis.Addr().Network(), lis.Addr(), err)
+}
+
+// ServeAll serves the listeners at the same time, e.g. the same services over
+// tcp, kcp, quic and unix. It returns the first error of the listeners, or
+// nil when ctx is done or the server is stopped. The server is stopped
+// gracefully before ServeAll returns, so all the listeners shut down together.
+// After a listener fails the calls in flight get serveAllGrace to end before
+// the server is stopped at once, so the error is returned promptly.
+func (s *Server) ServeAll(ctx context.Context, listeners ...net.Listener) error {
+	if len(listeners) == 0 {
+		return errNoListener
+	}
+	errCh := make(chan error, len(listeners))
+	for _, lis := range listeners {
+		go func(lis net.Listener) {
+			errCh <- s.Serve(lis)
+		}(lis)
+	}
+	var err error
+	running := len(listeners)
+	select {
+	case err = <-errCh:
+		running--
+	case <-ctx.Done():
+	}
+	if err != nil {
+		s.stopWithin(serveAllGrace)
+	} else {
+		s.GracefulStop()
+	}
+	for ; running > 0; running-- {
+		<-errCh
+	}
 	return err
 }
 
+// stopWithin stops the server gracefully, it is stopped at once if the
+// calls in flight do not end within d.
+func (s *Server) stopWithin(d time.Duration) {
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-stopped:
+	case <-timer.C:
+		s.Stop()
+	}
+}
+
 func (s *Server) SetAuthenticator(authenticator Authenticator) {
 	s.auth = authenticator
 }
 
+// SetAuthorizer sets the Authorizer of the calls, all the calls authenticated
+// are allowed by default.
+func (s *Server) SetAuthorizer(authorizer Authorizer) {
+	s.authz = authorizer
+}
+
+// Shutdown stops the plugins of the server.
 func (s *Server) Shutdown() (err error) {
 	if s.pc != nil {
 		err = s.pc.Stop()
@@ -94,10 +210,102 @@ func (s *Server) ApplyPlugins(plugins ...plugin.Plugin) {
 	}
 }
 
+// ApplyPluginWithPriority applies the plugin with priority instead of the one
+// it declares, the lower runs first.
+func (s *Server) ApplyPluginWithPriority(p plugin.Plugin, priority int) {
+	s.pc.AddWithPriority(p, priority)
+}
+
+// PluginChain returns the plugins of the server in the order their inbound
+// hooks run, the outbound hooks run in the reverse order.
+func (s *Server) PluginChain() []plugin.Plugin {
+	return s.pc.Chain()
+}
+
+// Start blocks until the server is stopped.
 func (s *Server) Start() {
-	for {
-		time.Sleep(time.Millisecond * 100)
+	<-s.done
+}
+
+// Stop stops the server at once. It closes the listeners and the
+// connections, the contexts of the calls in flight are canceled and their
+// streams are closed. Stop waits for the sessions to end for stopTimeout at
+// most, a handler which ignores its context is left running after it.
+func (s *Server) Stop() {
+	s.quitOnce.Do(func() { close(s.quit) })
+	defer s.doneOnce.Do(func() { close(s.done) })
+
+	s.mu.Lock()
+	listeners := s.lis
+	s.lis = nil
+	sessions := s.sessions
+	s.sessions = nil
+	conns := make([]net.Conn, 0, len(s.conns))
+	for conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	s.mu.Unlock()
+
+	for lis := range listeners {
+		lis.Close()
+	}
+	for session := range sessions {
+		session.Close()
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+	s.cancel()
+
+	ended := make(chan struct{})
+	go func() {
+		s.mu.Lock()
+		for len(s.conns) != 0 {
+			s.cv.Wait()
+		}
+		s.mu.Unlock()
+		close(ended)
+	}()
+	timer := time.NewTimer(stopTimeout)
+	defer timer.Stop()
+	select {
+	case <-ended:
+	case <-timer.C:
+		log.Warnf("xrpc: the sessions have not ended %v after Stop, the handlers ignore their contexts", stopTimeout)
+	}
+	s.mu.Lock()
+	s.conns = nil
+	s.cv.Broadcast()
+	s.mu.Unlock()
+}
+
+// GracefulStop stops the server gracefully. It stops accepting new
+// connections and sends a goaway to the sessions so that the clients stop
+// opening streams on them, each session is closed once its calls in flight
+// end. GracefulStop returns when all the sessions have ended.
+func (s *Server) GracefulStop() {
+	s.quitOnce.Do(func() { close(s.quit) })
+	defer s.doneOnce.Do(func() { close(s.done) })
+
+	s.mu.Lock()
+	if s.conns == nil {
+		s.mu.Unlock()
+		return
+	}
+	for lis := range s.lis {
+		lis.Close()
+	}
+	s.lis = nil
+	for _, ka := range s.sessions {
+		go ka.drain(goAwayShutdown, 0)
 	}
+	for len(s.conns) != 0 {
+		s.cv.Wait()
+	}
+	s.conns = nil
+	s.sessions = nil
+	s.mu.Unlock()
+	s.cancel()
 }
 
 func (s *Server) RegisterService(sd *types.ServiceDesc, ss interface{}) {
@@ -137,68 +345,277 @@ func (s *Server) register(sd *types.ServiceDesc, ss interface{}) {
 	s.pc.DoRegisterService(sd, ss)
 }
 
+// listen accepts the connections of lis until it fails, the temporary
+// errors are retried with a backoff of 5ms up to 1s.
 func (s *Server) listen(lis net.Listener) (e error) {
+	var tempDelay time.Duration
 	for {
 		conn, err := lis.Accept()
 		if err != nil {
+			if ne, ok := err.(interface{ Temporary() bool }); ok && ne.Temporary() {
+				if tempDelay == 0 {
+					tempDelay = 5 * time.Millisecond
+				} else if tempDelay *= 2; tempDelay > time.Second {
+					tempDelay = time.Second
+				}
+				log.Warnf("xrpc: failed to accept on %v: %v, retrying in %v", lis.Addr(), err, tempDelay)
+				timer := time.NewTimer(tempDelay)
+				select {
+				case <-timer.C:
+				case <-s.quit:
+					timer.Stop()
+					return nil
+				}
+				continue
+			}
 			e = err
 			break
 		}
-		p := make([]byte, len(types.Preface))
-		n, err := conn.Read(p)
-		if err != nil || n != len(types.Preface) {
-			continue
+		tempDelay = 0
+		if !s.addConn(conn) {
+			conn.Close()
+			break
 		}
-		session, err := smux.Server(conn, nil)
+		go s.handleConn(conn)
+	}
+	return
+}
+
+// addConn tracks an accepted connection, it fails if the server is stopped.
+func (s *Server) addConn(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conns == nil {
+		return false
+	}
+	s.conns[conn] = true
+	return true
+}
+
+func (s *Server) removeConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conns != nil {
+		delete(s.conns, conn)
+		s.cv.Broadcast()
+	}
+}
+
+// handleConn does the handshake of the credentials, reads the preface of a
+// new connection and does the handshake of the session within the connection
+// timeout, then it serves the session over the connection.
+func (s *Server) handleConn(conn net.Conn) {
+	defer s.removeConn(conn)
+	if s.opts.connectionTimeout > 0 {
+		conn.SetDeadline(time.Now().Add(s.opts.connectionTimeout))
+	}
+	p := &peer.Peer{Addr: conn.RemoteAddr()}
+	if s.opts.creds != nil {
+		secureConn, authInfo, err := s.opts.creds.ServerHandshake(conn)
 		if err != nil {
-			continue
+			log.Debugf("xrpc: the handshake with %v failed: %v", conn.RemoteAddr(), err)
+			conn.Close()
+			return
 		}
-		s.sessions[session] = true
-		// DoConnect
-		conn, ok := s.pc.DoConnect(conn)
-		if !ok {
+		conn, p.AuthInfo = secureConn, authInfo
+	}
+	preface := make([]byte, len(types.Preface))
+	if _, err := io.ReadFull(conn, preface); err != nil {
+		log.Debugf("xrpc: failed to read the preface: %v", err)
+		conn.Close()
+		return
+	}
+	if s.opts.handshaker != nil {
+		info, err := s.opts.handshaker.ServerHandshake(conn)
+		if err != nil {
+			log.Debugf("xrpc: the session handshake with %v failed: %v", conn.RemoteAddr(), err)
 			conn.Close()
-			continue
+			return
 		}
-		go s.handleSession(conn, session)
+		p.HandshakeInfo = info
 	}
-	return
+	conn.SetDeadline(time.Time{})
+	session, err := smux.Server(conn, s.opts.smuxConfig)
+	if err != nil {
+		log.Errorf("xrpc: failed to create the session: %v", err)
+		conn.Close()
+		return
+	}
+	// DoConnect
+	conn, ok := s.pc.DoConnect(conn)
+	if !ok {
+		session.Close()
+		return
+	}
+	s.handleSession(conn, session, p)
+}
+
+// sessionStreams counts the open streams of a session to enforce the max
+// concurrent streams, and the calls in flight on them for the idle timeout. A
+// cached unary stream stays open between its calls.
+type sessionStreams struct {
+	mu     sync.Mutex
+	active uint32
+	calls  uint32
+	// idle fires when the session has had no call for idleTimeout.
+	idle        *time.Timer
+	idleTimeout time.Duration
+}
+
+// acquire counts a new stream, it fails if the session has max streams.
+func (st *sessionStreams) acquire(max uint32) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if max > 0 && st.active >= max {
+		return false
+	}
+	st.active++
+	return true
+}
+
+// release uncounts a stream.
+func (st *sessionStreams) release() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.active--
+}
+
+// startCall counts a call in flight, it stops the idle timer.
+func (st *sessionStreams) startCall() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.calls++
+	if st.idle != nil {
+		st.idle.Stop()
+	}
+}
+
+// endCall uncounts a call, the idle timer restarts with the last call.
+func (st *sessionStreams) endCall() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.calls--
+	if st.calls > 0 {
+		return
+	}
+	if st.idle != nil {
+		st.idle.Reset(st.idleTimeout)
+	}
+}
+
+// count returns the number of the calls in flight.
+func (st *sessionStreams) count() uint32 {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.calls
 }
 
-func (s *Server) handleSession(conn net.Conn, session *smux.Session) {
+// handleSession serves the streams of the session with the peer p.
+func (s *Server) handleSession(conn net.Conn, session *smux.Session, p *peer.Peer) {
 	log.Debug("handle server session")
 	defer log.Debug("close server session")
+	streams := &sessionStreams{idleTimeout: s.opts.idleTimeout}
+	ka := s.newServerKeepalive(session, streams)
+	defer ka.stop()
+	s.mu.Lock()
+	if s.sessions == nil {
+		// the server is stopped
+		s.mu.Unlock()
+		session.Close()
+		return
+	}
+	s.sessions[session] = ka
+	select {
+	case <-s.quit:
+		// the server is stopping gracefully
+		go ka.drain(goAwayShutdown, 0)
+	default:
+	}
+	s.mu.Unlock()
+	// the streams end before the session is disconnected
+	var wg sync.WaitGroup
+	defer func() {
+		session.Close()
+		s.mu.Lock()
+		if s.sessions != nil {
+			delete(s.sessions, session)
+		}
+		s.mu.Unlock()
+	}()
+	if s.opts.idleTimeout > 0 {
+		streams.idle = time.AfterFunc(s.opts.idleTimeout, ka.closeIdle)
+		defer streams.idle.Stop()
+	}
 	for {
 		stream, err := session.AcceptStream()
 		if err != nil {
 			break
 		}
-		pf, data, err := recv(stream)
+		pf, data, err := recv(stream, s.opts.maxRecvMsgSize)
 		if err != nil {
-			return
+			stream.Close()
+			continue
 		}
 		if pf == types.CmdHeader {
 			header := &types.StreamHeader{}
 			err = json.Unmarshal(data, header)
+			putBuffer(data)
+			if err != nil {
+				stream.Close()
+				continue
+			}
+			if header.Cmd == types.Control {
+				go ka.serve(stream)
+				continue
+			}
+			id, err := s.authenticate(p, header)
 			if err != nil {
+				log.Debugf("xrpc: the call of %s from %v is rejected: %v", header.FullMethod, p.Addr, err)
+				sendMeta(stream, newTrailer(nil, err))
+				stream.Close()
 				continue
 			}
-			if err = s.auth.Authenticate(header.Args); err != nil {
-				log.Error(err.Error())
+			if !streams.acquire(s.opts.maxConcurrentStreams) {
+				sendMeta(stream, newTrailer(nil, status.Errorf(codes.ResourceExhausted,
+					"xrpc: the number of concurrent streams exceeds %d", s.opts.maxConcurrentStreams)))
 				stream.Close()
 				continue
 			}
 			ss := &serverStream{
-				stream: &streamConn{stream},
-				codec:  encoding.GetCodec(types.GetCodecArg(header)),
-				cp:     encoding.GetCompressor(types.GetCompressorArg(header)),
-				sc:     s.pc,
-				header: header,
+				stream:         &streamConn{stream},
+				codec:          encoding.GetCodec(types.GetCodecArg(header)),
+				cp:             encoding.GetCompressor(types.GetCompressorArg(header)),
+				sc:             s.pc,
+				header:         header,
+				maxRecvMsgSize: s.opts.maxRecvMsgSize,
+				maxSendMsgSize: s.opts.maxSendMsgSize,
+				calls:          streams,
+				unary:          !s.isStreamingMethod(header),
 			}
+			// the call is in flight from its header, the idle timer does not
+			// close the session under it
+			ss.addCall()
 
-			ctx := context.Background()
+			// the handler context ends with the server, the deadline of the
+			// call or the client giving it up
+			var ctx context.Context
+			if header.Timeout > 0 {
+				ctx, ss.cancel = context.WithTimeout(s.ctx, header.Timeout)
+			} else {
+				ctx, ss.cancel = context.WithCancel(s.ctx)
+			}
+			ctx = peer.NewContext(ctx, p)
+			if id != nil {
+				ctx = auth.NewContext(ctx, id)
+			}
 			// DoOpenStream
 			if ctx, err = s.pc.DoOpenStream(ctx, stream); err != nil {
+				log.Debugf("xrpc: the stream of %s from %v is rejected by a plugin: %v", header.FullMethod, p.Addr, err)
+				sendMeta(stream, newTrailer(nil, toStatusError(err, codes.PermissionDenied)))
+				stream.Close()
+				ss.cancel()
+				ss.endCalls()
+				streams.release()
 				continue
 			}
 
@@ -207,62 +624,138 @@ func (s *Server) handleSession(conn net.Conn, session *smux.Session) {
 					ctx = types.SetCookie(ctx, k, vv)
 				}
 			}
-			go s.processStream(ctx, ss, header)
+			ctx = newContextWithServerStream(ctx, ss)
+			ss.ctx = ctx
+			ss.recvCh = make(chan *frame, 1)
+			go ss.recvLoop()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.processStream(ctx, ss, header)
+				ss.endCalls()
+				streams.release()
+			}()
 		}
 	}
+	session.Close()
+	wg.Wait()
 	// DoDisconnect
 	s.pc.DoDisconnect(conn)
 }
 
 func (s *Server) processStream(ctx context.Context, stream types.ServerStream, header *types.StreamHeader) {
-	defer s.pc.DoCloseStream(ctx, stream.(*serverStream).stream)
+	ss := stream.(*serverStream)
+	defer s.pc.DoCloseStream(ctx, ss.stream)
+	defer stream.Close()
+	defer ss.cancel()
 	service, method := header.SplitMethod()
 	if service == "" || method == "" {
+		ss.finish(status.Errorf(codes.Unimplemented, "xrpc: malformed method name %q", header.FullMethod))
 		return
 	}
 	if header.RpcType == types.RawRPC {
 		// RawRPC
-		var newCtx context.Context
-
-		dec := func(m interface{}) (err error) {
-			newCtx, err = stream.RecvMsg(newCtx, m)
+		if !s.CustomServer.hasMethod(service, method) {
+			ss.finish(status.Errorf(codes.Unimplemented, "xrpc: unknown method %v for service %v", method, service))
 			return
 		}
-		for {
-			newCtx = ctx
-			reply, err := s.RpcCall(newCtx, service, method, dec, s.pc.DoIntercept)
-			if err != nil {
-				break
-			}
+		s.processUnaryRPC(ctx, ss, func(ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+			reply, err := s.RpcCall(ctx, service, method, dec, s.pc.DoIntercept)
 			if res, ok := reply.([]interface{}); ok {
 				if len(res) == 1 {
 					reply = res[0]
 				}
 			}
-			if err = stream.SendMsg(newCtx, reply); err != nil {
-				break
-			}
-		}
+			return reply, err
+		})
 		return
 	}
 
 	// XRPC
-	srv := s.m[service].server
-	desc := s.m[service].md[method]
-	var newCtx context.Context
-
-	dec := func(m interface{}) (err error) {
-		newCtx, err = stream.RecvMsg(newCtx, m)
+	srv, ok := s.m[service]
+	if !ok {
+		ss.finish(status.Errorf(codes.Unimplemented, "xrpc: unknown service %v", service))
+		return
+	}
+	if desc, ok := srv.sd[method]; ok {
+		s.processStreamingRPC(ss, srv, desc)
+		return
+	}
+	desc, ok := srv.md[method]
+	if !ok {
+		ss.finish(status.Errorf(codes.Unimplemented, "xrpc: unknown method %v for service %v", method, service))
 		return
 	}
+	s.processUnaryRPC(ctx, ss, func(ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+		return desc.Handler(srv.server, ctx, dec, s.pc.DoIntercept)
+	})
+}
+
+// isStreamingMethod reports whether the method of the stream header is a
+// streaming method of a registered service.
+func (s *Server) isStreamingMethod(header *types.StreamHeader) bool {
+	if header.RpcType == types.RawRPC {
+		return false
+	}
+	service, method := header.SplitMethod()
+	srv, ok := s.m[service]
+	if !ok {
+		return false
+	}
+	_, ok = srv.sd[method]
+	return ok
+}
+
+// processUnaryRPC serves the unary calls sent on the stream one after another,
+// each call ends with a trailer which carries its status. It returns when the
+// client closes the stream or the stream is broken.
+func (s *Server) processUnaryRPC(ctx context.Context, ss *serverStream, call func(context.Context, func(interface{}) error) (interface{}, error)) {
+	// the stream is authenticated when it is opened, the later calls on it
+	// are rejected once the identity expires
+	id, _ := auth.FromContext(ctx)
 	for {
-		newCtx = ctx
-		reply, err := desc.Handler(srv, newCtx, dec, s.pc.DoIntercept)
-		if err != nil {
-			break
+		newCtx := ctx
+		var recvErr error
+		expired := false
+		dec := func(m interface{}) (err error) {
+			newCtx, err = ss.RecvMsg(newCtx, m)
+			if _, ok := status.FromError(err); !ok {
+				recvErr = err
+			}
+			if err == nil && id.Expired() {
+				expired = true
+				err = errIdentityExpired
+			}
+			return
 		}
-		if err = stream.SendMsg(newCtx, reply); err != nil {
-			break
+		reply, err := call(newCtx, dec)
+		if recvErr != nil {
+			// the client has closed the stream
+			return
+		}
+		if expired {
+			err = errIdentityExpired
+		} else if err == nil {
+			err = ss.SendMsg(newCtx, reply)
+		}
+		// the call is in flight from its request to its trailer
+		err = ss.finish(err)
+		ss.doneCall()
+		if err != nil || expired || ctx.Err() != nil {
+			return
 		}
 	}
 }
+
+// processStreamingRPC hands the stream over to the handler of a server-streaming,
+// client-streaming or bidi method, the trailer which carries the status of the
+// call is sent and the stream is closed when the handler returns.
+func (s *Server) processStreamingRPC(stream *serverStream, srv *service, desc *types.StreamDesc) {
+	err := desc.Handler(srv.server, stream)
+	if err != nil {
+		log.Debugf("xrpc: stream handler %s returned error: %v", desc.StreamName, err)
+	}
+	if err = stream.finish(err); err != nil {
+		log.Debugf("xrpc: failed to send the trailer of %s: %v", desc.StreamName, err)
+	}
+}
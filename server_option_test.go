@@ -0,0 +1,130 @@
+package xrpc_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log"
+	stdnet "net"
+	"sync"
+	"testing"
+	"time"
+
+	"x.io/xrpc"
+	"x.io/xrpc/pkg/codes"
+	"x.io/xrpc/pkg/connectivity"
+	"x.io/xrpc/pkg/net"
+	"x.io/xrpc/pkg/status"
+
+	"github.com/stretchr/testify/assert"
+	greeter_pb "x.io/xrpc/protocol/greeter"
+)
+
+const (
+	sizeLimitAddr   = "localhost:9904"
+	streamLimitAddr = "localhost:9905"
+)
+
+// echoGreeter replies with the name, except a reply of 4KB for "big", no
+// reply until the call is done for "block", a reply after 500ms for "slow"
+// and a reply after 3s for "hang", which ignores the end of the call.
+type echoGreeter struct {
+	greeter_pb.UnimplementedGreeterServer
+}
+
+func (g *echoGreeter) SayHello(ctx context.Context, req *greeter_pb.HelloRequest) (*greeter_pb.HelloReply, error) {
+	switch req.Name {
+	case "block":
+		<-ctx.Done()
+		return nil, status.FromContextError(ctx.Err()).Err()
+	case "big":
+		return &greeter_pb.HelloReply{Message: randomString(4096)}, nil
+	case "slow":
+		time.Sleep(500 * time.Millisecond)
+	case "hang":
+		time.Sleep(3 * time.Second)
+	}
+	return &greeter_pb.HelloReply{Message: req.Name}, nil
+}
+
+var limitOnce sync.Once
+
+// randomString returns a string of n hex digits which does not compress.
+func randomString(n int) string {
+	b := make([]byte, n/2)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func newLimitClient(t *testing.T, addr string) (*xrpc.ClientConn, greeter_pb.GreeterClient) {
+	limitOnce.Do(func() {
+		servers := map[string]*xrpc.Server{
+			sizeLimitAddr: xrpc.NewServer(xrpc.MaxRecvMsgSize(1024), xrpc.MaxSendMsgSize(1024)),
+			streamLimitAddr: xrpc.NewServer(xrpc.MaxConcurrentStreams(1),
+				xrpc.ConnectionTimeout(50*time.Millisecond), xrpc.IdleTimeout(50*time.Millisecond)),
+		}
+		for addr, s := range servers {
+			lis, err := net.Listen(context.Background(), "tcp", addr)
+			if err != nil {
+				log.Fatal(err)
+			}
+			greeter_pb.RegisterGreeterServer(s, &echoGreeter{})
+			go s.Serve(lis)
+		}
+	})
+	conn, err := xrpc.Dial("tcp", addr, xrpc.WithInsecure())
+	assert.Equal(t, nil, err)
+	return conn, greeter_pb.NewGreeterClient(conn)
+}
+
+func TestServerMaxMsgSize(t *testing.T) {
+	conn, client := newLimitClient(t, sizeLimitAddr)
+	defer conn.Close()
+	_, err := client.SayHello(ctx, &greeter_pb.HelloRequest{Name: randomString(4096)})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	_, err = client.SayHello(ctx, &greeter_pb.HelloRequest{Name: "big"})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	r, err := client.SayHello(ctx, &greeter_pb.HelloRequest{Name: name})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, name, r.Message)
+}
+
+func TestServerMaxConcurrentStreams(t *testing.T) {
+	conn, client := newLimitClient(t, streamLimitAddr)
+	defer conn.Close()
+	done := make(chan error)
+	go func() {
+		tctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		_, err := client.SayHello(tctx, &greeter_pb.HelloRequest{Name: "block"})
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	_, err := client.SayHello(ctx, &greeter_pb.HelloRequest{Name: name})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(<-done))
+}
+
+func TestServerConnectionTimeout(t *testing.T) {
+	newLimitClient(t, streamLimitAddr)
+	conn, err := stdnet.Dial("tcp", streamLimitAddr)
+	assert.Equal(t, nil, err)
+	defer conn.Close()
+	// the server closes the connection without the preface
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestServerIdleTimeout(t *testing.T) {
+	conn, _ := newLimitClient(t, streamLimitAddr)
+	defer conn.Close()
+	assert.Equal(t, connectivity.Ready, conn.GetState())
+	tctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	// the session without streams is closed by the server
+	assert.Equal(t, true, conn.WaitForStateChange(tctx, connectivity.Ready))
+}
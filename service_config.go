@@ -0,0 +1,174 @@
+package xrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"x.io/xrpc/pkg/codes"
+)
+
+// MethodConfig defines the configuration recommended by the service providers
+// for the calls of a service or a method.
+type MethodConfig struct {
+	// WaitForReady is the default WaitForReady of the calls, nil leaves the
+	// default of the ClientConn.
+	WaitForReady *bool
+	// RetryPolicy is the retry policy of the unary calls, nil disables retries.
+	RetryPolicy *RetryPolicy
+}
+
+// serviceConfig holds the MethodConfigs by name. A name is either
+// "service/method", "service" for all the methods of the service or empty for
+// all the methods of the ClientConn.
+type serviceConfig map[string]*MethodConfig
+
+// methodConfig returns the MethodConfig of the full method "/service/method",
+// the config of the method takes precedence over the config of the service.
+func (sc serviceConfig) methodConfig(fullMethod string) *MethodConfig {
+	name := strings.TrimPrefix(fullMethod, "/")
+	if mc, ok := sc[name]; ok {
+		return mc
+	}
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		if mc, ok := sc[name[:i]]; ok {
+			return mc
+		}
+	}
+	return sc[""]
+}
+
+type jsonName struct {
+	Service string
+	Method  string
+}
+
+func (n jsonName) String() string {
+	if n.Method == "" {
+		return n.Service
+	}
+	return n.Service + "/" + n.Method
+}
+
+type jsonRetryPolicy struct {
+	MaxAttempts          int
+	InitialBackoff       string
+	MaxBackoff           string
+	BackoffMultiplier    float64
+	RetryableStatusCodes []codes.Code
+}
+
+type jsonMethodConfig struct {
+	Name         []jsonName
+	WaitForReady *bool
+	RetryPolicy  *jsonRetryPolicy
+}
+
+type jsonServiceConfig struct {
+	MethodConfig []jsonMethodConfig
+}
+
+// parseServiceConfig parses the service config in the json format of gRPC,
+// e.g.
+//
+//	{
+//	  "methodConfig": [{
+//	    "name": [{"service": "routeguide.RouteGuide", "method": "GetFeature"}],
+//	    "waitForReady": true,
+//	    "retryPolicy": {
+//	      "maxAttempts": 4,
+//	      "initialBackoff": ".01s",
+//	      "maxBackoff": ".1s",
+//	      "backoffMultiplier": 2.0,
+//	      "retryableStatusCodes": ["UNAVAILABLE"]
+//	    }
+//	  }]
+//	}
+func parseServiceConfig(js string) (serviceConfig, error) {
+	var rsc jsonServiceConfig
+	if err := json.Unmarshal([]byte(js), &rsc); err != nil {
+		return nil, fmt.Errorf("xrpc: failed to parse the service config: %v", err)
+	}
+	sc := serviceConfig{}
+	for _, m := range rsc.MethodConfig {
+		mc := &MethodConfig{WaitForReady: m.WaitForReady}
+		if m.RetryPolicy != nil {
+			rp, err := convertRetryPolicy(m.RetryPolicy)
+			if err != nil {
+				return nil, err
+			}
+			mc.RetryPolicy = rp
+		}
+		if len(m.Name) == 0 {
+			sc[""] = mc
+		}
+		for _, n := range m.Name {
+			if n.Service == "" && n.Method != "" {
+				return nil, fmt.Errorf("xrpc: the method %q of the service config has no service", n.Method)
+			}
+			sc[n.String()] = mc
+		}
+	}
+	return sc, nil
+}
+
+func convertRetryPolicy(jrp *jsonRetryPolicy) (*RetryPolicy, error) {
+	initialBackoff, err := time.ParseDuration(jrp.InitialBackoff)
+	if err != nil {
+		return nil, fmt.Errorf("xrpc: invalid initialBackoff of the retry policy: %v", err)
+	}
+	maxBackoff, err := time.ParseDuration(jrp.MaxBackoff)
+	if err != nil {
+		return nil, fmt.Errorf("xrpc: invalid maxBackoff of the retry policy: %v", err)
+	}
+	rp := &RetryPolicy{
+		MaxAttempts:          jrp.MaxAttempts,
+		InitialBackoff:       initialBackoff,
+		MaxBackoff:           maxBackoff,
+		BackoffMultiplier:    jrp.BackoffMultiplier,
+		RetryableStatusCodes: map[codes.Code]bool{},
+	}
+	for _, code := range jrp.RetryableStatusCodes {
+		rp.RetryableStatusCodes[code] = true
+	}
+	if err = rp.validate(); err != nil {
+		return nil, err
+	}
+	return rp, nil
+}
+
+// initServiceConfig merges the service config of WithDefaultServiceConfig
+// into the MethodConfigs of WithMethodConfig and validates the retry policies.
+func (dopts *dialOptions) initServiceConfig() error {
+	sc := serviceConfig{}
+	if dopts.scJSON != "" {
+		parsed, err := parseServiceConfig(dopts.scJSON)
+		if err != nil {
+			return err
+		}
+		sc = parsed
+	}
+	for name, mc := range dopts.sc {
+		if mc.RetryPolicy != nil {
+			rp := *mc.RetryPolicy
+			if err := rp.validate(); err != nil {
+				return err
+			}
+			mc.RetryPolicy = &rp
+		}
+		sc[name] = mc
+	}
+	dopts.sc = sc
+	return nil
+}
+
+// callOptions returns the default CallOptions of the MethodConfig of the full
+// method, the options of the ClientConn and the call override them.
+func (sc serviceConfig) callOptions(fullMethod string) []CallOption {
+	mc := sc.methodConfig(fullMethod)
+	if mc == nil || mc.WaitForReady == nil {
+		return nil
+	}
+	return []CallOption{WaitForReady(*mc.WaitForReady)}
+}
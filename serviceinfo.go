@@ -0,0 +1,243 @@
+package xrpc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+var (
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+	contextType  = reflect.TypeOf((*context.Context)(nil)).Elem()
+	xcontextType = reflect.TypeOf((*XContext)(nil))
+	bytesType    = reflect.TypeOf([]byte(nil))
+)
+
+// GetServiceInfo returns the services registered on the server, both the
+// generated and the custom ones, keyed by the service names.
+func (s *Server) GetServiceInfo() map[string]ServiceInfo {
+	infos := map[string]ServiceInfo{}
+	s.mu.Lock()
+	for name, srv := range s.m {
+		infos[name] = srv.info(name)
+	}
+	s.mu.Unlock()
+	s.CustomServer.mu.Lock()
+	for name, srv := range s.CustomServer.m {
+		infos[name] = srv.info()
+	}
+	s.CustomServer.mu.Unlock()
+	return infos
+}
+
+// info describes a generated service. The methods of a proto service are
+// described by the descriptor of its proto file, the methods of the other
+// services by the json schemas of their arguments and results.
+func (srv *service) info(name string) ServiceInfo {
+	info := ServiceInfo{Name: name, PkgPath: pkgPath(srv.server)}
+	var protoMethods map[string]*MethodInfo
+	if file, ok := srv.mdata.(string); ok {
+		if fd := fileDescriptor(file); fd != nil {
+			info.FileDescriptor, _ = proto.Marshal(fd)
+			protoMethods = serviceMethods(fd, name)
+		}
+	}
+	v := reflect.ValueOf(srv.server)
+	for method := range srv.md {
+		if mi, ok := protoMethods[method]; ok {
+			info.Methods = append(info.Methods, mi)
+		} else if m := v.MethodByName(method); m.IsValid() {
+			info.Methods = append(info.Methods, funcInfo(method, m.Type()))
+		}
+	}
+	for method, desc := range srv.sd {
+		mi, ok := protoMethods[method]
+		if !ok {
+			mi = &MethodInfo{Name: method}
+		}
+		mi.IsClientStream = desc.ClientStreams
+		mi.IsServerStream = desc.ServerStreams
+		info.Methods = append(info.Methods, mi)
+	}
+	sortMethods(info.Methods)
+	return info
+}
+
+// info describes a custom service by the json schemas of the arguments and
+// results of its functions.
+func (srv *customService) info() ServiceInfo {
+	info := ServiceInfo{Name: srv.name, PkgPath: pkgPath(srv.ss)}
+	for method, fn := range srv.md {
+		info.Methods = append(info.Methods, funcInfo(method, fn.Type()))
+	}
+	sortMethods(info.Methods)
+	return info
+}
+
+func pkgPath(v interface{}) string {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return ""
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.PkgPath()
+}
+
+func sortMethods(methods []*MethodInfo) {
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].Name < methods[j].Name
+	})
+}
+
+// fileDescriptor returns the descriptor of a registered proto file, nil if
+// the file is unknown.
+func fileDescriptor(file string) *descriptor.FileDescriptorProto {
+	gz := proto.FileDescriptor(file)
+	if gz == nil {
+		return nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(gz))
+	if err != nil {
+		return nil
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil
+	}
+	fd := &descriptor.FileDescriptorProto{}
+	if err = proto.Unmarshal(b, fd); err != nil {
+		return nil
+	}
+	return fd
+}
+
+// serviceMethods returns the methods of service defined in fd by name.
+func serviceMethods(fd *descriptor.FileDescriptorProto, service string) map[string]*MethodInfo {
+	methods := map[string]*MethodInfo{}
+	for _, sd := range fd.Service {
+		name := sd.GetName()
+		if fd.GetPackage() != "" {
+			name = fd.GetPackage() + "." + name
+		}
+		if name != service {
+			continue
+		}
+		for _, md := range sd.Method {
+			methods[md.GetName()] = &MethodInfo{
+				Name:      md.GetName(),
+				ReqName:   strings.TrimPrefix(md.GetInputType(), "."),
+				ReplyName: strings.TrimPrefix(md.GetOutputType(), "."),
+			}
+		}
+	}
+	return methods
+}
+
+// funcInfo describes a unary method by its function type. The request is the
+// array of the arguments but the context, the reply is the single result or
+// the array of the results but the error.
+func funcInfo(name string, t reflect.Type) *MethodInfo {
+	var ins, outs []reflect.Type
+	for i := 0; i < t.NumIn(); i++ {
+		if in := t.In(i); in != contextType && in != xcontextType {
+			ins = append(ins, in)
+		}
+	}
+	for i := 0; i < t.NumOut(); i++ {
+		if out := t.Out(i); out != errorType {
+			outs = append(outs, out)
+		}
+	}
+	info := &MethodInfo{Name: name, ReqName: typeNames(ins), ReplyName: typeNames(outs)}
+	req, _ := json.Marshal(tupleSchema(ins))
+	info.Req = string(req)
+	var reply []byte
+	if len(outs) == 1 {
+		reply, _ = json.Marshal(jsonSchema(outs[0], map[reflect.Type]bool{}))
+	} else {
+		reply, _ = json.Marshal(tupleSchema(outs))
+	}
+	info.Reply = string(reply)
+	return info
+}
+
+func typeNames(ts []reflect.Type) string {
+	names := make([]string, len(ts))
+	for i, t := range ts {
+		names[i] = t.String()
+	}
+	return strings.Join(names, ", ")
+}
+
+func tupleSchema(ts []reflect.Type) map[string]interface{} {
+	items := make([]interface{}, len(ts))
+	for i, t := range ts {
+		items[i] = jsonSchema(t, map[reflect.Type]bool{})
+	}
+	return map[string]interface{}{"type": "array", "items": items}
+}
+
+// jsonSchema returns the json schema of the values of t encoded by
+// encoding/json, seen holds the structs being described to stop at the
+// recursive types.
+func jsonSchema(t reflect.Type, seen map[reflect.Type]bool) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t == bytesType {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": jsonSchema(t.Elem(), seen)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": jsonSchema(t.Elem(), seen)}
+	case reflect.Struct:
+		schema := map[string]interface{}{"type": "object", "title": t.String()}
+		if seen[t] {
+			return schema
+		}
+		seen[t] = true
+		defer delete(seen, t)
+		props := map[string]interface{}{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			name := f.Name
+			if tag := f.Tag.Get("json"); tag != "" {
+				if tag == "-" {
+					continue
+				}
+				if n := strings.Split(tag, ",")[0]; n != "" {
+					name = n
+				}
+			}
+			props[name] = jsonSchema(f.Type, seen)
+		}
+		schema["properties"] = props
+		return schema
+	}
+	// interfaces, funcs and channels
+	return map[string]interface{}{}
+}
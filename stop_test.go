@@ -0,0 +1,194 @@
+package xrpc_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"x.io/xrpc"
+	"x.io/xrpc/pkg/net"
+
+	"github.com/stretchr/testify/assert"
+	greeter_pb "x.io/xrpc/protocol/greeter"
+)
+
+const (
+	gracefulStopAddr = "localhost:9911"
+	stopAddr         = "localhost:9912"
+	stopHangAddr     = "localhost:9923"
+)
+
+// hookCounter counts the calls of the Disconnect and CloseStream hooks.
+type hookCounter struct {
+	disconnects  int32
+	closeStreams int32
+}
+
+func (h *hookCounter) Disconnect(conn net.Conn) bool {
+	atomic.AddInt32(&h.disconnects, 1)
+	return true
+}
+
+func (h *hookCounter) CloseStream(ctx context.Context, conn net.Conn) (context.Context, error) {
+	atomic.AddInt32(&h.closeStreams, 1)
+	return ctx, nil
+}
+
+func startStopServer(t *testing.T, addr string) (*xrpc.Server, *hookCounter, chan error) {
+	lis, err := net.Listen(context.Background(), "tcp", addr)
+	assert.Equal(t, nil, err)
+	s := xrpc.NewServer()
+	h := &hookCounter{}
+	s.ApplyPlugins(h)
+	greeter_pb.RegisterGreeterServer(s, &echoGreeter{})
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(lis)
+	}()
+	return s, h, served
+}
+
+func TestGracefulStop(t *testing.T) {
+	s, h, served := startStopServer(t, gracefulStopAddr)
+	conn, err := xrpc.Dial("tcp", gracefulStopAddr, xrpc.WithInsecure())
+	assert.Equal(t, nil, err)
+	defer conn.Close()
+	client := greeter_pb.NewGreeterClient(conn)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.SayHello(ctx, &greeter_pb.HelloRequest{Name: "slow"})
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	// the call in flight finishes before the server stops
+	assert.Equal(t, nil, <-done)
+	<-stopped
+	assert.Equal(t, nil, <-served)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&h.disconnects))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&h.closeStreams))
+
+	_, err = xrpc.Dial("tcp", gracefulStopAddr, xrpc.WithInsecure())
+	assert.NotEqual(t, nil, err)
+}
+
+func TestStop(t *testing.T) {
+	s, h, served := startStopServer(t, stopAddr)
+	conn, err := xrpc.Dial("tcp", stopAddr, xrpc.WithInsecure())
+	assert.Equal(t, nil, err)
+	defer conn.Close()
+	client := greeter_pb.NewGreeterClient(conn)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.SayHello(ctx, &greeter_pb.HelloRequest{Name: "block"})
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	s.Stop()
+	// the call in flight is aborted
+	assert.NotEqual(t, nil, <-done)
+	assert.Equal(t, nil, <-served)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&h.disconnects))
+
+	lis, err := net.Listen(context.Background(), "tcp", stopAddr)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, xrpc.ErrServerStopped, s.Serve(lis))
+	s.Start()
+}
+
+func TestStopHangingHandler(t *testing.T) {
+	s, _, served := startStopServer(t, stopHangAddr)
+	conn, err := xrpc.Dial("tcp", stopHangAddr, xrpc.WithInsecure())
+	assert.Equal(t, nil, err)
+	defer conn.Close()
+	client := greeter_pb.NewGreeterClient(conn)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.SayHello(ctx, &greeter_pb.HelloRequest{Name: "hang"})
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	// Stop does not wait for the handler which ignores its context
+	start := time.Now()
+	s.Stop()
+	assert.True(t, time.Since(start) < 2*time.Second)
+	assert.NotEqual(t, nil, <-done)
+	assert.Equal(t, nil, <-served)
+}
+
+func TestServeAll(t *testing.T) {
+	sock := filepath.Join(os.TempDir(), "xrpc_serve_all.sock")
+	os.Remove(sock)
+	addrs := map[net.Network]string{
+		net.TCP:  "localhost:9913",
+		net.KCP:  "localhost:9914",
+		net.UNIX: sock,
+	}
+	s := xrpc.NewServer()
+	greeter_pb.RegisterGreeterServer(s, &echoGreeter{})
+	var listeners []net.Listener
+	for network, addr := range addrs {
+		lis, err := net.Listen(context.Background(), network, addr)
+		assert.Equal(t, nil, err)
+		listeners = append(listeners, lis)
+	}
+	sctx, cancel := context.WithCancel(ctx)
+	served := make(chan error, 1)
+	go func() {
+		served <- s.ServeAll(sctx, listeners...)
+	}()
+
+	// the services are reachable over all the listeners
+	for network, addr := range addrs {
+		conn, err := xrpc.Dial(network, addr, xrpc.WithInsecure())
+		assert.Equal(t, nil, err)
+		r, err := greeter_pb.NewGreeterClient(conn).SayHello(ctx, &greeter_pb.HelloRequest{Name: network})
+		assert.Equal(t, nil, err)
+		assert.Equal(t, network, r.GetMessage())
+		conn.Close()
+	}
+	cancel()
+	assert.Equal(t, nil, <-served)
+	_, err := xrpc.Dial(net.TCP, addrs[net.TCP], xrpc.WithInsecure())
+	assert.NotEqual(t, nil, err)
+}
+
+func TestServeAllError(t *testing.T) {
+	s := xrpc.NewServer()
+	greeter_pb.RegisterGreeterServer(s, &echoGreeter{})
+	lis1, err := net.Listen(context.Background(), net.TCP, "localhost:9915")
+	assert.Equal(t, nil, err)
+	lis2, err := net.Listen(context.Background(), net.TCP, "localhost:9916")
+	assert.Equal(t, nil, err)
+	served := make(chan error, 1)
+	go func() {
+		served <- s.ServeAll(ctx, lis1, lis2)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	conn, err := xrpc.Dial(net.TCP, "localhost:9916", xrpc.WithInsecure())
+	assert.Equal(t, nil, err)
+	defer conn.Close()
+	go greeter_pb.NewGreeterClient(conn).SayHello(ctx, &greeter_pb.HelloRequest{Name: "block"})
+	time.Sleep(50 * time.Millisecond)
+	// the failure of one listener shuts down the others, the call in flight
+	// does not hold up the error
+	start := time.Now()
+	lis1.Close()
+	assert.NotEqual(t, nil, <-served)
+	assert.True(t, time.Since(start) < 10*time.Second)
+	_, err = xrpc.Dial(net.TCP, "localhost:9916", xrpc.WithInsecure())
+	assert.NotEqual(t, nil, err)
+
+	// there is nothing to serve without listeners
+	assert.NotEqual(t, nil, xrpc.NewServer().ServeAll(ctx))
+}
@@ -3,19 +3,26 @@ package xrpc
 import (
 	"bytes"
 	"context"
-	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"sync"
+	"sync/atomic"
 
+	"x.io/xrpc/pkg/codes"
 	"x.io/xrpc/pkg/encoding"
 	"x.io/xrpc/pkg/net"
+	"x.io/xrpc/pkg/peer"
+	"x.io/xrpc/pkg/status"
 	"x.io/xrpc/pkg/transport"
 	"x.io/xrpc/plugin"
 	"x.io/xrpc/types"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/xtaci/smux"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
 )
 
 type clientStream struct {
@@ -28,12 +35,120 @@ type clientStream struct {
 	cp     encoding.Compressor
 
 	pioc plugin.IOContainer
+
+	// cached is set on the unary streams shared by the calls of a method,
+	// the other streams are owned by a single call.
+	cached bool
+	// key is the key of the idle cached streams of the method on the address.
+	key string
+	// session is the session of the connection the stream is opened on and
+	// peer is the server of it, which is put into the contexts of the plugins.
+	session *smux.Session
+	peer    *peer.Peer
+	// active is the addrConn which counts the call in flight on the stream.
+	active *addrConn
+	// singleReply is set on the client-streaming calls, the trailer is read
+	// along with their only reply.
+	singleReply bool
+	// maxRecvMsgSize is the max size of the frames read from the stream.
+	maxRecvMsgSize int
+
+	// recvSem serializes the readers of the stream, sendMu the writers and mu
+	// guards the state of the current call.
+	recvSem    chan struct{}
+	sendMu     sync.Mutex
+	mu         sync.Mutex
+	headerMD   types.MD
+	trailerMD  types.MD
+	headerDone bool
+	// headerReady is closed when headerDone is set, Header waits on it while
+	// another reader holds recvSem.
+	headerReady chan struct{}
+	done        bool
+	pending     *frame
+	ctxErr      error
+	// statusErr is the error carried by the trailer of a failed call.
+	statusErr error
+
+	// closed is closed when the stream is closed, it stops watching the
+	// context of the call.
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// frame is a message frame read ahead of RecvMsg, e.g. by Header.
+type frame struct {
+	pf  types.PayloadFormat
+	msg []byte
 }
 
 func (cs *clientStream) Close() error {
+	cs.endCall()
+	cs.closeOnce.Do(func() {
+		if cs.closed != nil {
+			close(cs.closed)
+		}
+	})
 	return cs.stream.Close()
 }
 
+// startCall counts a new call on the stream as active on ac.
+func (cs *clientStream) startCall(ac *addrConn) {
+	atomic.AddInt32(&ac.active, 1)
+	cs.mu.Lock()
+	cs.active = ac
+	cs.mu.Unlock()
+}
+
+// endCall ends the active call on the stream, if any, it returns the
+// addrConn of the call.
+func (cs *clientStream) endCall() *addrConn {
+	cs.mu.Lock()
+	ac := cs.active
+	cs.active = nil
+	cs.mu.Unlock()
+	if ac != nil {
+		atomic.AddInt32(&ac.active, -1)
+	}
+	return ac
+}
+
+// watch aborts the call when its context is done before the stream is closed.
+func (cs *clientStream) watch(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		cs.abort(ctx.Err())
+	case <-cs.closed:
+	}
+}
+
+// abort tells the server that the client has given up the call and closes
+// the stream, the pending and later operations on it return the status of err.
+func (cs *clientStream) abort(err error) {
+	cs.mu.Lock()
+	cs.ctxErr = status.FromContextError(err).Err()
+	cs.mu.Unlock()
+	cs.sendMu.Lock()
+	sendCmd(cs.stream, &types.StreamHeader{
+		FullMethod: cs.header.FullMethod,
+		Cmd:        types.Close,
+		RpcType:    cs.header.RpcType,
+	})
+	cs.sendMu.Unlock()
+	cs.Close()
+}
+
+// toCtxErr returns the status of the context error if the call was aborted,
+// otherwise err.
+func (cs *clientStream) toCtxErr(err error) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.ctxErr != nil {
+		return cs.ctxErr
+	}
+	return err
+}
+
 func (cs *clientStream) Context() context.Context {
 	return cs.ctx
 }
@@ -68,40 +183,149 @@ func (cs *clientStream) SendMsg(ctx context.Context, m interface{}) error {
 		data = compData
 		comp = true
 	}
-	if data, err = cs.pioc.DoPreWriteResponse(ctx, data); err != nil {
+	if data, err = cs.pioc.DoPreWriteResponse(cs.pluginContext(ctx), data); err != nil {
 		return err
 	}
 	hdr := types.MsgHeader(data, comp)
 
-	if _, err = cs.stream.Write(hdr); err != nil {
-		return err
+	cs.sendMu.Lock()
+	defer cs.sendMu.Unlock()
+	if err = writeFrame(cs.stream, hdr, data); err != nil {
+		return cs.toCtxErr(err)
 	}
-	if _, err = cs.stream.Write(data); err != nil {
+	return nil
+}
+
+// send writes a control frame of format pf which carries v as json to conn.
+func send(conn io.Writer, pf types.PayloadFormat, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
 		return err
 	}
-	return nil
+	hdr := types.MsgHeader(data, false)
+	hdr[0] = byte(pf)
+	return writeFrame(conn, hdr, data)
+}
+
+// sendCmd writes a CmdHeader frame which carries the stream header to conn.
+func sendCmd(conn io.Writer, header *types.StreamHeader) error {
+	return send(conn, types.CmdHeader, header)
+}
+
+// sendMeta writes a MetaHeader frame which carries header or trailer metadata to conn.
+func sendMeta(conn io.Writer, meta *types.StreamMeta) error {
+	return send(conn, types.MetaHeader, meta)
 }
 
-func recv(conn io.Reader) (pf types.PayloadFormat, msg []byte, err error) {
-	header := make([]byte, types.HeaderLen, types.HeaderLen)
-	if _, err := conn.Read(header[:]); err != nil {
-		return 0, nil, err
+// newTrailer returns the trailer of a call which ended with err.
+func newTrailer(md types.MD, err error) *types.StreamMeta {
+	meta := &types.StreamMeta{Trailer: true, MD: md}
+	if err == nil {
+		return meta
 	}
+	data, e := proto.Marshal(status.Convert(err).Proto())
+	if e != nil {
+		data, _ = proto.Marshal(status.New(codes.Internal, e.Error()).Proto())
+	}
+	meta.Status = data
+	return meta
+}
 
-	pf = types.PayloadFormat(header[0])
-	length := binary.BigEndian.Uint32(header[1:])
+// newCall resets the metadata of the stream, a cached unary stream carries
+// one call after another.
+func (cs *clientStream) newCall() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.headerMD = nil
+	cs.trailerMD = nil
+	cs.headerDone = false
+	cs.headerReady = make(chan struct{})
+	cs.done = false
+	cs.statusErr = nil
+}
 
-	if length == 0 {
-		return pf, nil, nil
+// setHeaderDoneLocked marks the header of the call as received, cs.mu is
+// held.
+func (cs *clientStream) setHeaderDoneLocked() {
+	if !cs.headerDone {
+		cs.headerDone = true
+		close(cs.headerReady)
+	}
+}
+
+// recvFrame reads the next frame of the call. A header frame is consumed and
+// reported with a nil frame, the trailer ends the call with io.EOF.
+func (cs *clientStream) recvFrame() (*frame, error) {
+	if f := cs.pending; f != nil {
+		cs.pending = nil
+		return f, nil
+	}
+	cs.mu.Lock()
+	done, statusErr := cs.done, cs.statusErr
+	cs.mu.Unlock()
+	if done {
+		if statusErr != nil {
+			return nil, statusErr
+		}
+		return nil, io.EOF
+	}
+	pf, msg, err := recv(cs.stream, cs.maxRecvMsgSize)
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if err != nil {
+		cs.setHeaderDoneLocked()
+		return nil, err
+	}
+	if pf != types.MetaHeader {
+		cs.setHeaderDoneLocked()
+		return &frame{pf: pf, msg: msg}, nil
+	}
+	meta := &types.StreamMeta{}
+	err = json.Unmarshal(msg, meta)
+	putBuffer(msg)
+	if err != nil {
+		return nil, err
+	}
+	cs.setHeaderDoneLocked()
+	if meta.Trailer {
+		cs.trailerMD = meta.MD
+		cs.done = true
+		if !cs.cached {
+			// the call is over, the stream is not used anymore
+			go cs.Close()
+		}
+		if len(meta.Status) > 0 {
+			st := &spb.Status{}
+			if err = proto.Unmarshal(meta.Status, st); err != nil {
+				cs.statusErr = status.Errorf(codes.Internal, "xrpc: failed to unmarshal the status %v", err)
+			} else {
+				cs.statusErr = status.ErrorProto(st)
+			}
+			return nil, cs.statusErr
+		}
+		return nil, io.EOF
 	}
-	msg = make([]byte, int(length))
-	if _, err := conn.Read(msg); err != nil {
+	cs.headerMD = meta.MD
+	return nil, nil
+}
+
+// recvTrailer reads until the trailer of the call, it returns the status
+// error of a failed call.
+func (cs *clientStream) recvTrailer() error {
+	cs.recvSem <- struct{}{}
+	defer func() { <-cs.recvSem }()
+	for {
+		f, err := cs.recvFrame()
 		if err == io.EOF {
-			err = io.ErrUnexpectedEOF
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if f != nil {
+			return errors.New("xrpc: unexpected message before the trailer")
 		}
-		return 0, nil, err
 	}
-	return pf, msg, nil
 }
 
 func (cs *clientStream) RecvMsg(ctx context.Context, m interface{}) (context.Context, error) {
@@ -109,16 +333,27 @@ func (cs *clientStream) RecvMsg(ctx context.Context, m interface{}) (context.Con
 		// 通过transporter接收
 		return cs.t.RecvMsg(ctx, m)
 	}
-	pf, msg, err := recv(cs.stream)
+	cs.recvSem <- struct{}{}
+	var f *frame
+	var err error
+	for f == nil && err == nil {
+		f, err = cs.recvFrame()
+	}
+	<-cs.recvSem
 	if err != nil {
-		return ctx, err
+		return ctx, cs.toCtxErr(err)
 	}
-	if msg, err = cs.pioc.DoPreReadRequest(ctx, msg); err != nil {
+	defer putBuffer(f.msg)
+	pf, msg := f.pf, f.msg
+	if msg, err = cs.pioc.DoPreReadRequest(cs.pluginContext(ctx), msg); err != nil {
 		return ctx, err
 	}
 	var data []byte
 	if pf == types.CompressionMade {
 		dc, _ := cs.cp.Decompress(bytes.NewReader(msg))
+		if dc == nil {
+			return ctx, status.Error(codes.Internal, "xrpc: decompress failed")
+		}
 		data, err = ioutil.ReadAll(dc)
 		if err != nil {
 			return ctx, err
@@ -130,19 +365,84 @@ func (cs *clientStream) RecvMsg(ctx context.Context, m interface{}) (context.Con
 	if err = cs.codec.Unmarshal(data[l:], m); err != nil {
 		return ctx, errors.New(fmt.Sprintf("xrpc: failed to unmarshal the received message %v", err))
 	}
+	if cs.singleReply {
+		// the call ends with the reply, its trailer is ready after it
+		return ctx, cs.recvTrailer()
+	}
 	return ctx, nil
 }
 
+// pluginContext returns ctx with the method and the peer of the stream for
+// the plugins.
+func (cs *clientStream) pluginContext(ctx context.Context) context.Context {
+	ctx = context.WithValue(ctx, methodKey{}, cs.header.FullMethod)
+	if cs.peer == nil {
+		return ctx
+	}
+	return peer.NewContext(ctx, cs.peer)
+}
+
+// Header returns the header metadata sent by the server. It blocks until the
+// header, the first message or the end of the call arrives, it may be called
+// while another goroutine is receiving the messages.
 func (cs *clientStream) Header() (types.MD, error) {
-	panic("implement me")
+	cs.mu.Lock()
+	ready := cs.headerReady
+	cs.mu.Unlock()
+	select {
+	case <-ready:
+	case cs.recvSem <- struct{}{}:
+		// no other reader, the header is read here
+		err := cs.readHeader()
+		<-cs.recvSem
+		if err != nil {
+			return nil, err
+		}
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.headerMD == nil && cs.statusErr != nil {
+		return nil, cs.statusErr
+	}
+	return cs.headerMD.Copy(), nil
+}
+
+// readHeader reads until the header of the call, the first message read is
+// kept for RecvMsg. cs.recvSem is held.
+func (cs *clientStream) readHeader() error {
+	for {
+		cs.mu.Lock()
+		headerDone := cs.headerDone
+		cs.mu.Unlock()
+		if headerDone || cs.pending != nil {
+			return nil
+		}
+		f, err := cs.recvFrame()
+		if err != nil && err != io.EOF {
+			return err
+		}
+		cs.pending = f
+	}
 }
 
+// Trailer returns the trailer metadata sent by the server. It is only
+// complete after RecvMsg has returned a non-nil error.
 func (cs *clientStream) Trailer() types.MD {
-	panic("implement me")
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.trailerMD.Copy()
 }
 
+// CloseSend tells the server that no more messages will be sent on this
+// stream, the server side RecvMsg returns io.EOF after that.
 func (cs *clientStream) CloseSend() error {
-	panic("implement me")
+	cs.sendMu.Lock()
+	defer cs.sendMu.Unlock()
+	return sendCmd(cs.stream, &types.StreamHeader{
+		FullMethod: cs.header.FullMethod,
+		Cmd:        types.HalfClose,
+		RpcType:    cs.header.RpcType,
+	})
 }
 
 type streamConn struct {
@@ -164,6 +464,30 @@ type serverStream struct {
 	cp    encoding.Compressor
 
 	sc plugin.IOContainer
+
+	// cancel cancels ctx, it is called when the client closes the stream or
+	// the call ends.
+	cancel context.CancelFunc
+	// recvCh carries the frames read by recvLoop, it is closed with recvErr
+	// set when no more messages can be received.
+	recvCh  chan *frame
+	recvErr error
+
+	maxRecvMsgSize int
+	maxSendMsgSize int
+	// calls counts the calls in flight of the session.
+	calls *sessionStreams
+	// unary is set on the streams of the unary calls, each request read on
+	// them starts a call.
+	unary bool
+	// pending is the number of the calls of the stream from their request to
+	// their trailer, the stream is in flight while it is not zero.
+	pending int32
+
+	mu         sync.Mutex
+	headerMD   types.MD
+	trailerMD  types.MD
+	headerSent bool
 }
 
 func (ss *serverStream) Close() error {
@@ -210,14 +534,14 @@ func (ss *serverStream) SendMsg(ctx context.Context, m interface{}) (err error)
 	if data, err = ss.sc.DoPreWriteResponse(ctx, data); err != nil {
 		return err
 	}
-	hdr := types.MsgHeader(data, comp)
-	if _, err = ss.stream.Write(hdr); err != nil {
-		return err
+	if ss.maxSendMsgSize > 0 && len(data) > ss.maxSendMsgSize {
+		return status.Errorf(codes.ResourceExhausted, "xrpc: trying to send message larger than max (%d vs. %d)", len(data), ss.maxSendMsgSize)
 	}
-	if _, err = ss.stream.Write(data); err != nil {
+	if err = ss.sendHeader(); err != nil {
 		return err
 	}
-	return err
+	hdr := types.MsgHeader(data, comp)
+	return writeFrame(ss.stream, hdr, data)
 }
 
 func (ss *serverStream) RecvMsg(ctx context.Context, m interface{}) (context.Context, error) {
@@ -225,10 +549,13 @@ func (ss *serverStream) RecvMsg(ctx context.Context, m interface{}) (context.Con
 		// 通过transporter接收
 		return ss.t.RecvMsg(ctx, m)
 	}
-	pf, msg, err := recv(ss.stream)
-	if err != nil {
-		return ctx, err
+	f, ok := <-ss.recvCh
+	if !ok {
+		return ctx, ss.recvErr
 	}
+	defer putBuffer(f.msg)
+	pf, msg := f.pf, f.msg
+	var err error
 	// DoPreReadRequest
 	if msg, err = ss.sc.DoPreReadRequest(ctx, msg); err != nil {
 		return ctx, err
@@ -237,32 +564,174 @@ func (ss *serverStream) RecvMsg(ctx context.Context, m interface{}) (context.Con
 	if pf == types.CompressionMade {
 		dc, _ := ss.cp.Decompress(bytes.NewReader(msg))
 		if dc == nil {
-			return ctx, errors.New("decompress failed")
+			return ctx, status.Error(codes.Internal, "xrpc: decompress failed")
 		}
 		data, err = ioutil.ReadAll(dc)
 		if err != nil {
-			return ctx, err
+			return ctx, status.Errorf(codes.Internal, "xrpc: decompress failed %v", err)
 		}
 	} else {
 		data = msg
 	}
 	ctx, l := types.ReadCookiesHeader(ctx, data)
 	if err = ss.codec.Unmarshal(data[l:], m); err != nil {
-		err = errors.New(fmt.Sprintf("xrpc: failed to unmarshal the received message for %v", err))
+		err = status.Errorf(codes.Internal, "xrpc: failed to unmarshal the received message for %v", err)
 	}
 	// DoPostReadRequest
 	err = ss.sc.DoPostReadRequest(ctx, m, err)
 	return ctx, err
 }
 
-func (ss *serverStream) SetHeader(types.MD) error {
-	panic("implement me")
+// recvLoop reads the frames of the stream ahead of RecvMsg, so that the
+// handler context is cancelled as soon as the client gives up the call even
+// if the handler is not receiving.
+func (ss *serverStream) recvLoop() {
+	defer close(ss.recvCh)
+	// the call of the first request was counted with the stream header
+	first := true
+	for {
+		pf, msg, err := recv(ss.stream, ss.maxRecvMsgSize)
+		if err != nil {
+			// the client has gone away or the message is too large
+			ss.recvErr = err
+			ss.cancel()
+			return
+		}
+		if pf == types.CmdHeader {
+			header := &types.StreamHeader{}
+			err = json.Unmarshal(msg, header)
+			putBuffer(msg)
+			if err != nil {
+				ss.recvErr = err
+				return
+			}
+			switch header.Cmd {
+			case types.HalfClose:
+				// no more messages, keep reading for the end of the stream
+				ss.recvErr = io.EOF
+				go ss.discard()
+			case types.Close:
+				ss.recvErr = io.EOF
+				ss.cancel()
+			default:
+				ss.recvErr = errors.New("xrpc: unexpected stream command " + string(header.Cmd))
+			}
+			return
+		}
+		if ss.unary && !first {
+			ss.addCall()
+		}
+		first = false
+		select {
+		case ss.recvCh <- &frame{pf: pf, msg: msg}:
+		case <-ss.ctx.Done():
+			ss.recvErr = status.FromContextError(ss.ctx.Err()).Err()
+			return
+		}
+	}
+}
+
+// addCall counts a call of the stream in flight from its request.
+func (ss *serverStream) addCall() {
+	if atomic.AddInt32(&ss.pending, 1) == 1 {
+		ss.calls.startCall()
+	}
+}
+
+// doneCall uncounts a call of the stream when its trailer is sent.
+func (ss *serverStream) doneCall() {
+	if atomic.AddInt32(&ss.pending, -1) == 0 {
+		ss.calls.endCall()
+	}
+}
+
+// endCalls uncounts the calls of the stream when it ends.
+func (ss *serverStream) endCalls() {
+	if atomic.SwapInt32(&ss.pending, 0) > 0 {
+		ss.calls.endCall()
+	}
+}
+
+// discard reads and drops the frames after a HalfClose command until the
+// client closes the stream, then cancels the call.
+func (ss *serverStream) discard() {
+	for {
+		pf, msg, err := recv(ss.stream, ss.maxRecvMsgSize)
+		if err != nil {
+			ss.cancel()
+			return
+		}
+		if pf == types.CmdHeader {
+			header := &types.StreamHeader{}
+			if json.Unmarshal(msg, header) == nil && header.Cmd == types.Close {
+				ss.cancel()
+				return
+			}
+		}
+		putBuffer(msg)
+	}
+}
+
+// SetHeader sets the header metadata, it is merged with the previous calls
+// and sent with the first message or SendHeader.
+func (ss *serverStream) SetHeader(md types.MD) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.headerSent {
+		return errors.New("xrpc: SetHeader called after the header was sent")
+	}
+	ss.headerMD = types.Join(ss.headerMD, md)
+	return nil
+}
+
+// SendHeader sends the header metadata, it can be called at most once.
+func (ss *serverStream) SendHeader(md types.MD) error {
+	ss.mu.Lock()
+	if ss.headerSent {
+		ss.mu.Unlock()
+		return errors.New("xrpc: SendHeader called more than once")
+	}
+	ss.headerMD = types.Join(ss.headerMD, md)
+	ss.mu.Unlock()
+	return ss.sendHeader()
+}
+
+// SetTrailer sets the trailer metadata, it is merged with the previous calls
+// and sent when the call ends.
+func (ss *serverStream) SetTrailer(md types.MD) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.trailerMD = types.Join(ss.trailerMD, md)
 }
 
-func (ss *serverStream) SendHeader(types.MD) error {
-	panic("implement me")
+// sendHeader sends the header metadata if it was set and not yet sent.
+func (ss *serverStream) sendHeader() error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.headerSent {
+		return nil
+	}
+	ss.headerSent = true
+	if ss.t != nil || ss.headerMD.Len() == 0 {
+		return nil
+	}
+	return sendMeta(ss.stream, &types.StreamMeta{MD: ss.headerMD})
 }
 
-func (ss *serverStream) SetTrailer(types.MD) {
-	panic("implement me")
+// finish sends the trailer with the status of err which ends the current call,
+// and resets the metadata for the next call on the stream.
+func (ss *serverStream) finish(err error) error {
+	if err := ss.sendHeader(); err != nil {
+		return err
+	}
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	meta := newTrailer(ss.trailerMD, err)
+	ss.headerMD = nil
+	ss.trailerMD = nil
+	ss.headerSent = false
+	if ss.t != nil {
+		return nil
+	}
+	return sendMeta(ss.stream, meta)
 }
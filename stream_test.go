@@ -0,0 +1,458 @@
+package xrpc_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"x.io/xrpc"
+	"x.io/xrpc/pkg/codes"
+	"x.io/xrpc/pkg/net"
+	"x.io/xrpc/pkg/status"
+	"x.io/xrpc/types"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	rg_pb "x.io/xrpc/protocol/routeguide"
+)
+
+const routeGuideAddr = "localhost:9897"
+
+var (
+	routeGuideOnce sync.Once
+	// routeGuideAuthAddr is the address of the server which authenticates
+	// the calls and routeGuideRejectAddr of the one whose plugin rejects
+	// the streams, they listen on free ports.
+	routeGuideAuthAddr   string
+	routeGuideRejectAddr string
+
+	// blocked is the point on which GetFeature waits for the call to be
+	// abandoned, the error of the handler context is sent to abandoned.
+	blocked   = &rg_pb.Point{Latitude: -1, Longitude: -1}
+	abandoned = make(chan error, 1)
+	// missing is the point on which GetFeature fails with NotFound.
+	missing = &rg_pb.Point{Latitude: -2, Longitude: -2}
+
+	features = []*rg_pb.Feature{
+		{Name: "a", Location: &rg_pb.Point{Latitude: 1, Longitude: 1}},
+		{Name: "b", Location: &rg_pb.Point{Latitude: 2, Longitude: 2}},
+		{Name: "c", Location: &rg_pb.Point{Latitude: 3, Longitude: 3}},
+	}
+)
+
+type RouteGuideImpl struct {
+	rg_pb.UnimplementedRouteGuideServer
+}
+
+func (r *RouteGuideImpl) GetFeature(ctx context.Context, point *rg_pb.Point) (*rg_pb.Feature, error) {
+	if err := xrpc.SetHeader(ctx, types.Pairs("method", "GetFeature")); err != nil {
+		return nil, err
+	}
+	if err := xrpc.SetTrailer(ctx, types.Pairs("count", strconv.Itoa(len(features)))); err != nil {
+		return nil, err
+	}
+	if proto.Equal(blocked, point) {
+		<-ctx.Done()
+		abandoned <- ctx.Err()
+		return nil, ctx.Err()
+	}
+	if proto.Equal(missing, point) {
+		return nil, status.Error(codes.NotFound, "feature not found")
+	}
+	for _, f := range features {
+		if proto.Equal(f.Location, point) {
+			return f, nil
+		}
+	}
+	return &rg_pb.Feature{Location: point}, nil
+}
+
+func (r *RouteGuideImpl) ListFeatures(rect *rg_pb.Rectangle, stream rg_pb.RouteGuide_ListFeaturesServer) error {
+	if rect.Lo == nil || rect.Hi == nil {
+		return status.Error(codes.InvalidArgument, "the rectangle is not closed")
+	}
+	if err := stream.SendHeader(types.Pairs("method", "ListFeatures")); err != nil {
+		return err
+	}
+	defer stream.SetTrailer(types.Pairs("count", strconv.Itoa(len(features))))
+	for _, f := range features {
+		if f.Location.Latitude >= rect.Lo.Latitude && f.Location.Latitude <= rect.Hi.Latitude {
+			if err := stream.Send(f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *RouteGuideImpl) RecordRoute(stream rg_pb.RouteGuide_RecordRouteServer) error {
+	var count int32
+	for {
+		_, err := stream.Recv()
+		if err == io.EOF {
+			stream.SetTrailer(types.Pairs("count", strconv.Itoa(int(count))))
+			return stream.SendAndClose(&rg_pb.RouteSummary{PointCount: count})
+		}
+		if err != nil {
+			return err
+		}
+		count++
+	}
+}
+
+func (r *RouteGuideImpl) RouteChat(stream rg_pb.RouteGuide_RouteChatServer) error {
+	if err := stream.SendHeader(types.Pairs("method", "RouteChat")); err != nil {
+		return err
+	}
+	for {
+		in, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = stream.Send(in); err != nil {
+			return err
+		}
+	}
+}
+
+func newRouteGuideConn(t testing.TB, opts ...xrpc.DialOption) *xrpc.ClientConn {
+	routeGuideOnce.Do(func() {
+		lis, err := net.Listen(context.Background(), "tcp", routeGuideAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		s := xrpc.NewServer()
+		rg_pb.RegisterRouteGuideServer(s, &RouteGuideImpl{})
+		go s.Serve(lis)
+
+		lis, err = net.Listen(context.Background(), "tcp", "localhost:0")
+		if err != nil {
+			log.Fatal(err)
+		}
+		routeGuideAuthAddr = lis.Addr().String()
+		s = xrpc.NewServer()
+		s.SetAuthenticator(xrpc.NewAdminAuthenticator(user, pass))
+		rg_pb.RegisterRouteGuideServer(s, &RouteGuideImpl{})
+		go s.Serve(lis)
+
+		lis, err = net.Listen(context.Background(), "tcp", "localhost:0")
+		if err != nil {
+			log.Fatal(err)
+		}
+		routeGuideRejectAddr = lis.Addr().String()
+		s = xrpc.NewServer()
+		s.ApplyPlugins(rejectPlugin{})
+		rg_pb.RegisterRouteGuideServer(s, &RouteGuideImpl{})
+		go s.Serve(lis)
+	})
+	conn, err := xrpc.Dial("tcp", routeGuideAddr, append([]xrpc.DialOption{xrpc.WithInsecure()}, opts...)...)
+	assert.Equal(t, nil, err)
+	return conn
+}
+
+func newRouteGuideClient(t testing.TB) rg_pb.RouteGuideClient {
+	return rg_pb.NewRouteGuideClient(newRouteGuideConn(t))
+}
+
+func TestRouteGuideGetFeature(t *testing.T) {
+	client := newRouteGuideClient(t)
+	f, err := client.GetFeature(ctx, &rg_pb.Point{Latitude: 2, Longitude: 2})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "b", f.Name)
+}
+
+func TestRouteGuideGetFeatureMetadata(t *testing.T) {
+	client := newRouteGuideClient(t)
+	var header, trailer types.MD
+	_, err := client.GetFeature(ctx, &rg_pb.Point{Latitude: 1, Longitude: 1}, xrpc.Header(&header), xrpc.Trailer(&trailer))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"GetFeature"}, header.Get("method"))
+	assert.Equal(t, []string{"3"}, trailer.Get("count"))
+
+	// the metadata of the previous call is not carried over to the next one
+	header, trailer = nil, nil
+	_, err = client.GetFeature(ctx, &rg_pb.Point{Latitude: 2, Longitude: 2}, xrpc.Header(&header), xrpc.Trailer(&trailer))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"GetFeature"}, header.Get("method"))
+	assert.Equal(t, []string{"3"}, trailer.Get("count"))
+}
+
+func TestRouteGuideGetFeatureDeadline(t *testing.T) {
+	client := newRouteGuideClient(t)
+	tctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err := client.GetFeature(tctx, blocked)
+	assert.Equal(t, status.FromContextError(context.DeadlineExceeded).Code(), status.Code(err))
+	select {
+	case err = <-abandoned:
+		// the server deadline races with the client giving up the call
+		assert.NotEqual(t, nil, err)
+	case <-time.After(time.Second):
+		t.Fatal("the handler context is not done after the deadline")
+	}
+}
+
+func TestRouteGuideGetFeatureCancel(t *testing.T) {
+	client := newRouteGuideClient(t)
+	cctx, cancel := context.WithCancel(ctx)
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err := client.GetFeature(cctx, blocked)
+	assert.Equal(t, status.FromContextError(context.Canceled).Code(), status.Code(err))
+	select {
+	case err = <-abandoned:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(time.Second):
+		t.Fatal("the handler context is not cancelled with the call")
+	}
+}
+
+func TestRouteGuideListFeatures(t *testing.T) {
+	client := newRouteGuideClient(t)
+	rect := &rg_pb.Rectangle{Lo: &rg_pb.Point{Latitude: 2}, Hi: &rg_pb.Point{Latitude: 3}}
+	stream, err := client.ListFeatures(ctx, rect)
+	assert.Equal(t, nil, err)
+	var names []string
+	for {
+		f, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		assert.Equal(t, nil, err)
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"b", "c"}, names)
+}
+
+func TestRouteGuideRecordRoute(t *testing.T) {
+	client := newRouteGuideClient(t)
+	stream, err := client.RecordRoute(ctx)
+	assert.Equal(t, nil, err)
+	for _, f := range features {
+		assert.Equal(t, nil, stream.Send(f.Location))
+	}
+	summary, err := stream.CloseAndRecv()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int32(len(features)), summary.PointCount)
+	// the trailer is ready with the reply
+	assert.Equal(t, []string{strconv.Itoa(len(features))}, stream.Trailer().Get("count"))
+}
+
+func TestRouteGuideRouteChat(t *testing.T) {
+	client := newRouteGuideClient(t)
+	stream, err := client.RouteChat(ctx)
+	assert.Equal(t, nil, err)
+	for i, f := range features {
+		note := &rg_pb.RouteNote{Location: f.Location, Message: f.Name}
+		assert.Equal(t, nil, stream.Send(note))
+		in, err := stream.Recv()
+		assert.Equal(t, nil, err)
+		assert.Equal(t, features[i].Name, in.Message)
+	}
+	assert.Equal(t, nil, stream.CloseSend())
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestRouteGuideRouteChatHeader(t *testing.T) {
+	client := newRouteGuideClient(t)
+	stream, err := client.RouteChat(ctx)
+	assert.Equal(t, nil, err)
+	// the header is read while the messages are being received
+	go func() {
+		header, err := stream.Header()
+		assert.Equal(t, nil, err)
+		assert.Equal(t, []string{"RouteChat"}, header.Get("method"))
+		for _, f := range features {
+			stream.Send(&rg_pb.RouteNote{Location: f.Location, Message: f.Name})
+		}
+		stream.CloseSend()
+	}()
+	var count int
+	for {
+		_, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		assert.Equal(t, nil, err)
+		count++
+	}
+	assert.Equal(t, len(features), count)
+}
+
+func TestRouteGuideListFeaturesMetadata(t *testing.T) {
+	client := newRouteGuideClient(t)
+	rect := &rg_pb.Rectangle{Lo: &rg_pb.Point{Latitude: 1}, Hi: &rg_pb.Point{Latitude: 3}}
+	stream, err := client.ListFeatures(ctx, rect)
+	assert.Equal(t, nil, err)
+	header, err := stream.Header()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"ListFeatures"}, header.Get("method"))
+	var count int
+	for {
+		_, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		assert.Equal(t, nil, err)
+		count++
+	}
+	assert.Equal(t, len(features), count)
+	assert.Equal(t, []string{"3"}, stream.Trailer().Get("count"))
+}
+
+func TestRouteGuideStatus(t *testing.T) {
+	client := newRouteGuideClient(t)
+	_, err := client.GetFeature(ctx, missing)
+	st, ok := status.FromError(err)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, codes.NotFound, st.Code())
+	assert.Equal(t, "feature not found", st.Message())
+
+	// the client keeps working after a failed call
+	f, err := client.GetFeature(ctx, &rg_pb.Point{Latitude: 3, Longitude: 3})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "c", f.Name)
+}
+
+func TestRouteGuideStreamStatus(t *testing.T) {
+	client := newRouteGuideClient(t)
+	stream, err := client.ListFeatures(ctx, &rg_pb.Rectangle{})
+	assert.Equal(t, nil, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestRouteGuideUnimplemented(t *testing.T) {
+	conn := newRouteGuideConn(t)
+	err := conn.Invoke(ctx, "/routeguide.RouteGuide/GetFeatures", &rg_pb.Point{}, &rg_pb.Feature{})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+	err = conn.Invoke(ctx, "/routeguide.Guide/GetFeature", &rg_pb.Point{}, &rg_pb.Feature{})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func TestRouteGuideUnauthenticated(t *testing.T) {
+	newRouteGuideConn(t)
+	conn, err := xrpc.Dial("tcp", routeGuideAuthAddr, xrpc.WithInsecure())
+	assert.Equal(t, nil, err)
+	_, err = rg_pb.NewRouteGuideClient(conn).GetFeature(ctx, &rg_pb.Point{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	conn, err = xrpc.Dial("tcp", routeGuideAuthAddr, xrpc.WithInsecure())
+	assert.Equal(t, nil, err)
+	conn.SetHeaderArg("user", user)
+	conn.SetHeaderArg("pass", pass)
+	f, err := rg_pb.NewRouteGuideClient(conn).GetFeature(ctx, &rg_pb.Point{Latitude: 1, Longitude: 1})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "a", f.Name)
+}
+
+// rejectPlugin rejects all the streams when they are opened.
+type rejectPlugin struct{}
+
+func (rejectPlugin) OpenStream(ctx context.Context, conn net.Conn) (context.Context, error) {
+	return ctx, errors.New("the stream is rejected")
+}
+
+func TestRouteGuideRejectedStream(t *testing.T) {
+	newRouteGuideConn(t)
+	conn, err := xrpc.Dial("tcp", routeGuideRejectAddr, xrpc.WithInsecure())
+	assert.Equal(t, nil, err)
+	defer conn.Close()
+	tctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err = rg_pb.NewRouteGuideClient(conn).GetFeature(tctx, &rg_pb.Point{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestRouteGuideConcurrentCalls(t *testing.T) {
+	client := newRouteGuideClient(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				want := features[(i+j)%len(features)]
+				f, err := client.GetFeature(ctx, want.Location)
+				assert.Equal(t, nil, err)
+				assert.Equal(t, want.Name, f.GetName())
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func BenchmarkRouteGuideGetFeature(b *testing.B) {
+	client := newRouteGuideClient(b)
+	point := features[0].Location
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := client.GetFeature(ctx, point); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRouteGuideGetFeatureParallel(b *testing.B) {
+	client := newRouteGuideClient(b)
+	point := features[0].Location
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := client.GetFeature(ctx, point); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestRouteGuideUnaryInterceptor(t *testing.T) {
+	var calls []string
+	record := func(name string) xrpc.UnaryClientInterceptor {
+		return func(ctx context.Context, method string, req, reply interface{}, cc *xrpc.ClientConn, invoker xrpc.UnaryInvoker, opts ...xrpc.CallOption) error {
+			calls = append(calls, name+" "+method)
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+	}
+	conn := newRouteGuideConn(t,
+		xrpc.WithChainUnaryInterceptor(record("b"), record("c")),
+		xrpc.WithUnaryInterceptor(record("a")),
+	)
+	f, err := rg_pb.NewRouteGuideClient(conn).GetFeature(ctx, &rg_pb.Point{Latitude: 1, Longitude: 1})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "a", f.Name)
+	method := "/routeguide.RouteGuide/GetFeature"
+	assert.Equal(t, []string{"a " + method, "b " + method, "c " + method}, calls)
+}
+
+func TestRouteGuideStreamInterceptor(t *testing.T) {
+	var calls []string
+	record := func(name string) xrpc.StreamClientInterceptor {
+		return func(ctx context.Context, rpc types.Rpc, desc *types.StreamDesc, cc *xrpc.ClientConn, method string, streamer xrpc.Streamer, opts ...xrpc.CallOption) (types.ClientStream, error) {
+			calls = append(calls, name+" "+desc.StreamName)
+			return streamer(ctx, rpc, desc, cc, method, opts...)
+		}
+	}
+	conn := newRouteGuideConn(t,
+		xrpc.WithStreamInterceptor(record("a")),
+		xrpc.WithChainStreamInterceptor(record("b")),
+	)
+	client := rg_pb.NewRouteGuideClient(conn)
+	_, err := client.GetFeature(ctx, &rg_pb.Point{Latitude: 1, Longitude: 1})
+	assert.Equal(t, nil, err)
+	stream, err := client.ListFeatures(ctx, &rg_pb.Rectangle{Lo: &rg_pb.Point{Latitude: 1}, Hi: &rg_pb.Point{Latitude: 1}})
+	assert.Equal(t, nil, err)
+	f, err := stream.Recv()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "a", f.Name)
+	assert.Equal(t, []string{"a ListFeatures", "b ListFeatures"}, calls)
+}
@@ -3,6 +3,7 @@ package types
 import (
 	"encoding/binary"
 	"strings"
+	"time"
 )
 
 type PayloadFormat uint8
@@ -17,12 +18,21 @@ const (
 
 	compressionNone PayloadFormat = iota // no compression
 	CompressionMade                      // compressed
-	metaHeader
+	MetaHeader                           // header or trailer metadata
 	CmdHeader
 
-	Init    HeaderCmd = "init"
-	Close   HeaderCmd = "close"
-	Upgrade HeaderCmd = "upgrade"
+	Init      HeaderCmd = "init"
+	Close     HeaderCmd = "close"
+	HalfClose HeaderCmd = "half_close"
+	Upgrade   HeaderCmd = "upgrade"
+	// Control opens the control stream of a session, it carries the Ping,
+	// Pong and GoAway commands instead of a call.
+	Control HeaderCmd = "control"
+	Ping    HeaderCmd = "ping"
+	Pong    HeaderCmd = "pong"
+	// GoAway tells the client to move the new calls to a new session, its
+	// Payload is the reason.
+	GoAway HeaderCmd = "goaway"
 
 	Preface = "xrpc/cheers"
 
@@ -36,6 +46,19 @@ type StreamHeader struct {
 	RpcType    Rpc
 	Args       map[string]interface{}
 	Payload    []byte
+	// Timeout is the time left before the deadline of the call when the
+	// stream was opened, zero means the call has no deadline.
+	Timeout time.Duration
+}
+
+// StreamMeta is the payload of a MetaHeader frame. The header is sent before
+// the first message of a call and the trailer is always the last frame of it.
+type StreamMeta struct {
+	Trailer bool
+	MD      MD
+	// Status is the proto encoded status of the call carried by the trailer,
+	// it is empty when the call succeeded.
+	Status []byte
 }
 
 func (sh *StreamHeader) SplitMethod() (service, method string) {